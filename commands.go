@@ -0,0 +1,484 @@
+package main
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/csvcontact"
+	"ContactCleaner/dedupe"
+	"ContactCleaner/ical"
+	"ContactCleaner/jcard"
+	"ContactCleaner/jscontact"
+	"ContactCleaner/ldif"
+	"ContactCleaner/merge"
+	"ContactCleaner/parsing"
+	"ContactCleaner/photo"
+	"ContactCleaner/vcard"
+	"ContactCleaner/writing"
+	"ContactCleaner/xcard"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+func runDedupe(args []string) (int, error) {
+	fs := flag.NewFlagSet("dedupe", flag.ContinueOnError)
+	out := fs.String("o", "", "write the cleaned cards to this file")
+	dryRun := fs.Bool("dry-run", false, "print the planned merges without writing anything")
+	minConfidence := fs.Float64("min-confidence", dedupe.DefaultOptions.MinConfidence, "minimum confidence for two cards to be duplicates")
+	version := fs.String("vcard-version", vcard.VERSION40, "vCard version to write")
+	region := fs.String("region", "", "region for phone numbers without a country code, e.g. US")
+	maxPhoto := fs.Int("max-photo-bytes", 0, "shrink photos larger than this many bytes, 0 leaves them alone")
+	strict := fs.Bool("strict", false, "stop at the first spec violation instead of skipping bad lines")
+	columns := fs.String("columns", "", "column map of a CSV file that isn't a Google or Outlook export")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage, err
+	}
+	if len(files) != 1 {
+		return exitUsage, errUsage
+	}
+	// before -o is created, a bad version mustn't empty the file
+	if !validVersion(*version) {
+		return exitUsage, fmt.Errorf("%w: unknown vCard version %q", errUsage, *version)
+	}
+
+	// a CSV or LDIF file is written back as one, a CSV one in the same layout
+	cards, output, err := readInput(files[0], *strict, *columns)
+	if err != nil {
+		return exitError, err
+	}
+	clusters := dedupe.FindWithOptions(cards, dedupe.Options{MinConfidence: *minConfidence, Region: *region})
+
+	// the merged card takes the place of the first card in its cluster
+	replace := make(map[int]*contact.ContactCard)
+	skip := make(map[int]bool)
+	removed := 0
+	for i, cluster := range clusters {
+		opts := merge.DefaultOptions
+		opts.Region = *region
+		merged, report := merge.MergeWithOptions(cluster.Cards, opts)
+		if *dryRun {
+			printPlan(os.Stdout, i+1, cluster, merged, report)
+		}
+		replace[cluster.Indexes[0]] = merged
+		for _, idx := range cluster.Indexes[1:] {
+			skip[idx] = true
+		}
+		removed += len(cluster.Indexes) - 1
+	}
+
+	if *dryRun {
+		fmt.Fprintf(os.Stdout, "%d cards, %d duplicate clusters, %d cards would be merged away\n", len(cards), len(clusters), removed)
+		if len(clusters) > 0 {
+			return exitFindings, nil
+		}
+		return exitOK, nil
+	}
+
+	if output == nil {
+		output = vcardOutput(*version)
+	}
+	err = writeOutput(*out, func(w io.Writer) error {
+		writer := output(w)
+		for i, card := range cards {
+			if skip[i] {
+				continue
+			}
+			if merged, ok := replace[i]; ok {
+				card = merged
+			}
+			if *maxPhoto > 0 && card.Photo != nil {
+				shrunk, err := photo.Shrink(card.Photo, *maxPhoto)
+				if err != nil {
+					// better a big photo than none
+					fmt.Fprintf(os.Stderr, "card %d (%s): photo: %v\n", i+1, describe(card), err)
+				} else {
+					card.Photo = shrunk
+				}
+			}
+			if err := writer.Write(card); err != nil {
+				return err
+			}
+		}
+		return writer.Flush()
+	})
+	if err != nil {
+		return exitError, err
+	}
+	fmt.Fprintf(os.Stderr, "%d cards, %d duplicate clusters, %d cards merged away\n", len(cards), len(clusters), removed)
+	return exitOK, nil
+}
+
+// Writes cards as vCards, CSV rows or LDIF entries.
+type cardWriter interface {
+	Write(card *contact.ContactCard) error
+	Flush() error
+}
+
+func vcardOutput(version string) func(io.Writer) cardWriter {
+	return func(w io.Writer) cardWriter {
+		return vcardWriter{writing.NewWriter(w, version)}
+	}
+}
+
+func csvOutput(layout *csvcontact.Layout) func(io.Writer) cardWriter {
+	return func(w io.Writer) cardWriter {
+		return csvWriter{csvcontact.NewWriter(w, layout)}
+	}
+}
+
+func ldifOutput(baseDN string) func(io.Writer) cardWriter {
+	return func(w io.Writer) cardWriter {
+		lw := ldif.NewWriter(w)
+		lw.BaseDN = baseDN
+		return ldifWriter{lw}
+	}
+}
+
+type vcardWriter struct {
+	*writing.Writer
+}
+
+func (vcardWriter) Flush() error {
+	return nil
+}
+
+// says what didn't fit the layout
+type csvWriter struct {
+	*csvcontact.Writer
+}
+
+type ldifWriter struct {
+	*ldif.Writer
+}
+
+func (ldifWriter) Flush() error {
+	return nil
+}
+
+func (w csvWriter) Flush() error {
+	if err := w.Writer.Flush(); err != nil {
+		return err
+	}
+	if n := w.Dropped(); n > 0 {
+		fmt.Fprintf(os.Stderr, "%d values have no column in the CSV layout and were left out\n", n)
+	}
+	return nil
+}
+
+func printPlan(w io.Writer, n int, cluster dedupe.Cluster, merged *contact.ContactCard, report merge.Report) {
+	var reasons []string
+	for _, r := range cluster.Reasons {
+		reasons = append(reasons, string(r.Kind)+" "+r.Value)
+	}
+	fmt.Fprintf(w, "cluster %d (confidence %.2f): %s\n", n, cluster.Confidence, strings.Join(reasons, ", "))
+	for i, card := range cluster.Cards {
+		fmt.Fprintf(w, "  card %d: %s\n", cluster.Indexes[i]+1, describe(card))
+	}
+	fmt.Fprintf(w, "  merged: %s\n", describe(merged))
+	for _, c := range report.Conflicts {
+		fmt.Fprintf(w, "  %s: keep %q, drop %q\n", c.Field, c.Kept, c.Dropped)
+	}
+}
+
+func runValidate(args []string) (int, error) {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage, err
+	}
+	if len(files) != 1 {
+		return exitUsage, errUsage
+	}
+
+	r, err := openInput(files[0])
+	if err != nil {
+		return exitError, err
+	}
+	defer r.Close()
+
+	p := parsing.NewParser(r)
+	problems := 0
+	count := 0
+	seen := 0
+	for {
+		v, err := p.NextVCard()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return exitError, err
+		}
+		count++
+		// what the parser skipped or repaired on the way to this card
+		reported := make(map[string]bool)
+		for _, d := range p.Diagnostics()[seen:] {
+			fmt.Fprintf(os.Stdout, "card %d (%s): %v\n", count, cardName(v), d)
+			reported[d.Err.Error()] = true
+			problems++
+		}
+		seen = len(p.Diagnostics())
+		for _, finding := range vcard.Validate(v) {
+			if reported[finding.Error()] {
+				// a bad TYPE is found by both
+				continue
+			}
+			fmt.Fprintf(os.Stdout, "card %d (%s): %v\n", count, cardName(v), finding)
+			problems++
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "%d cards, %d problems\n", count, problems)
+	if problems > 0 {
+		return exitFindings, nil
+	}
+	return exitOK, nil
+}
+
+func validVersion(version string) bool {
+	for _, v := range vcard.PROPERTIES[vcard.VERSION].PosVals {
+		if string(v) == version {
+			return true
+		}
+	}
+	return false
+}
+
+func cardName(v *vcard.VCard) string {
+	if fn, ok := v.GetProperty(vcard.FN); ok {
+		return fn.Text()
+	}
+	if uid, ok := v.GetProperty(vcard.UID); ok {
+		return string(uid.Value)
+	}
+	return "no name"
+}
+
+// convert --to formats besides the vCard versions, each one is a
+// single document so it's written once all cards are read
+var documentFormats = map[string]func([]*vcard.VCard) ([]byte, error){
+	"jcard":     jcard.MarshalAll,
+	"jscontact": jscontact.MarshalAll,
+	"xcard":     xcard.MarshalAll,
+}
+
+// convert --to formats written from the contacts
+var contactFormats = map[string]func(io.Writer) cardWriter{
+	"google-csv":  csvOutput(csvcontact.Google),
+	"outlook-csv": csvOutput(csvcontact.Outlook),
+	"ldif":        ldifOutput(""),
+}
+
+func runConvert(args []string) (int, error) {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	out := fs.String("o", "", "write the converted cards to this file")
+	to := fs.String("to", vcard.VERSION40, "target format: 2.1, 3.0, 4.0, jcard, jscontact, xcard, google-csv, outlook-csv or ldif")
+	strict := fs.Bool("strict", false, "stop at the first spec violation instead of skipping bad lines")
+	columns := fs.String("columns", "", "column map of a CSV file that isn't a Google or Outlook export")
+	baseDN := fs.String("base-dn", "", "where LDIF entries go, e.g. ou=people,dc=example,dc=com")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage, err
+	}
+	if len(files) != 1 {
+		return exitUsage, errUsage
+	}
+	marshal, isDocument := documentFormats[*to]
+	output, toContacts := contactFormats[*to]
+	if !validVersion(*to) && !isDocument && !toContacts {
+		return exitUsage, fmt.Errorf("%w: unknown format %q", errUsage, *to)
+	}
+	if *to == "ldif" {
+		output = ldifOutput(*baseDN)
+	}
+
+	// CSV and LDIF have no property lines to keep, they go through the contacts
+	if toContacts || inputFormat(files[0], *columns) != "vcard" {
+		cards, _, err := readInput(files[0], *strict, *columns)
+		if err != nil {
+			return exitError, err
+		}
+		if isDocument {
+			vs := make([]*vcard.VCard, len(cards))
+			for i, card := range cards {
+				vs[i] = writing.FromContact(card)
+			}
+			return writeDocument(*out, marshal, vs)
+		}
+		if output == nil {
+			output = vcardOutput(*to)
+		}
+		err = writeOutput(*out, func(w io.Writer) error {
+			writer := output(w)
+			for _, card := range cards {
+				if err := writer.Write(card); err != nil {
+					return err
+				}
+			}
+			return writer.Flush()
+		})
+		if err != nil {
+			return exitError, err
+		}
+		return exitOK, nil
+	}
+
+	r, err := openInput(files[0])
+	if err != nil {
+		return exitError, err
+	}
+	defer r.Close()
+
+	// works on the property lines so nothing gets lost on the way
+	p := parsing.NewParser(r, parsing.WithMode(parseMode(*strict)))
+	if isDocument {
+		var cards []*vcard.VCard
+		for {
+			v, err := p.NextVCard()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return exitError, err
+			}
+			cards = append(cards, v)
+		}
+		return writeDocument(*out, marshal, cards)
+	}
+	err = writeOutput(*out, func(w io.Writer) error {
+		writer := writing.NewWriter(w, *to)
+		for {
+			v, err := p.NextVCard()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := writer.WriteVCard(v); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return exitError, err
+	}
+	return exitOK, nil
+}
+
+// The document is made before path is created, a card that can't be
+// converted leaves it alone.
+func writeDocument(path string, marshal func([]*vcard.VCard) ([]byte, error), cards []*vcard.VCard) (int, error) {
+	b, err := marshal(cards)
+	if err != nil {
+		return exitError, err
+	}
+	err = writeOutput(path, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+	if err != nil {
+		return exitError, err
+	}
+	return exitOK, nil
+}
+
+func runBirthdays(args []string) (int, error) {
+	fs := flag.NewFlagSet("birthdays", flag.ContinueOnError)
+	out := fs.String("o", "", "write the calendar to this file")
+	years := fs.Int("years", ical.DefaultOptions.Years, "years from now on with the age in the summary")
+	name := fs.String("name", ical.DefaultOptions.Name, "name of the calendar")
+	strict := fs.Bool("strict", false, "stop at the first spec violation instead of skipping bad lines")
+	columns := fs.String("columns", "", "column map of a CSV file that isn't a Google or Outlook export")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage, err
+	}
+	if len(files) != 1 || *years < 0 {
+		return exitUsage, errUsage
+	}
+
+	cards, _, err := readInput(files[0], *strict, *columns)
+	if err != nil {
+		return exitError, err
+	}
+	opts := ical.Options{Stamp: time.Now(), Years: *years, Name: *name}
+	err = writeOutput(*out, func(w io.Writer) error {
+		return ical.Write(w, cards, opts)
+	})
+	if err != nil {
+		return exitError, err
+	}
+	return exitOK, nil
+}
+
+func runStats(args []string) (int, error) {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	region := fs.String("region", "", "region for phone numbers without a country code, e.g. US")
+	strict := fs.Bool("strict", false, "stop at the first spec violation instead of skipping bad lines")
+	columns := fs.String("columns", "", "column map of a CSV file that isn't a Google or Outlook export")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage, err
+	}
+	if len(files) != 1 {
+		return exitUsage, errUsage
+	}
+
+	cards, _, err := readInput(files[0], *strict, *columns)
+	if err != nil {
+		return exitError, err
+	}
+
+	fields := []struct {
+		name string
+		has  func(c *contact.ContactCard) bool
+	}{
+		{"FN", func(c *contact.ContactCard) bool { return c.FullName != "" }},
+		{"N", func(c *contact.ContactCard) bool { return c.FirstName != "" || c.LastName != "" }},
+		{"UID", func(c *contact.ContactCard) bool { return c.UID != "" }},
+		{"TEL", func(c *contact.ContactCard) bool { return len(c.Telephones) > 0 }},
+		{"EMAIL", func(c *contact.ContactCard) bool { return len(c.Emails) > 0 }},
+		{"ADR", func(c *contact.ContactCard) bool { return len(c.Addresses) > 0 }},
+		{"ORG", func(c *contact.ContactCard) bool { return c.Organization != "" }},
+		{"TITLE", func(c *contact.ContactCard) bool { return c.Titles != "" }},
+		{"BDAY", func(c *contact.ContactCard) bool { return c.Birthday != nil }},
+		{"PHOTO", func(c *contact.ContactCard) bool { return c.Photo != nil }},
+		{"NOTE", func(c *contact.ContactCard) bool { return c.Notes != "" }},
+		{"URL", func(c *contact.ContactCard) bool { return c.URL != "" }},
+		{"CATEGORIES", func(c *contact.ContactCard) bool { return len(c.Categories) > 0 }},
+	}
+
+	fmt.Fprintf(os.Stdout, "cards: %d\n", len(cards))
+	fmt.Fprintln(os.Stdout, "field coverage:")
+	for _, f := range fields {
+		n := 0
+		for _, card := range cards {
+			if f.has(card) {
+				n++
+			}
+		}
+		fmt.Fprintf(os.Stdout, "  %-11s %6d  %5.1f%%\n", f.name, n, percent(n, len(cards)))
+	}
+
+	opts := dedupe.DefaultOptions
+	opts.Region = *region
+	clusters := dedupe.FindWithOptions(cards, opts)
+	dupes := 0
+	for _, c := range clusters {
+		dupes += len(c.Indexes)
+	}
+	fmt.Fprintf(os.Stdout, "duplicate clusters: %d\n", len(clusters))
+	fmt.Fprintf(os.Stdout, "cards in clusters: %d\n", dupes)
+	fmt.Fprintf(os.Stdout, "cards after dedupe: %d\n", len(cards)-dupes+len(clusters))
+	return exitOK, nil
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
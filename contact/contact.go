@@ -1,13 +1,16 @@
 package contact
 
 import (
+	"strings"
 	"time"
 )
 
 type ContactCard struct {
 	Revision         time.Time
 	CustomFields     map[string]string
-	Birthday         *time.Time
+	Birthday         *DateOrTime
+	Anniversary      *DateOrTime
+	DeathDate        *DateOrTime
 	Version          string
 	ProdID           string
 	FullName         string
@@ -16,14 +19,18 @@ type ContactCard struct {
 	MiddleName       string
 	Prefix           string
 	Suffix           string
+	PhoneticFirst    string // how the name is said, for Japanese and Chinese names
+	PhoneticMiddle   string
+	PhoneticLast     string
 	UID              string
 	Nickname         string
-	Organization     string
+	Organization     string // the name and units of ORG, see OrgUnits
 	URL              string
 	Notes            string
 	Titles           string
 	Photo            Image
 	Logos            Image
+	Sound            Image    // not a picture, but stored the same way
 	Categories       []string // tags
 	InstantMessaging []string
 	Addresses        []Address
@@ -34,63 +41,92 @@ type ContactCard struct {
 	ExtendedFields   []XField
 }
 
-type Image interface {
-	isEncodedImage() bool
-	data() string
+// OrgUnits splits an Organization into the name and its units, they
+// are joined by ";" and a ";" in one of them is escaped: "Acme\; Inc;Sales".
+func OrgUnits(org string) []string {
+	if org == "" {
+		return nil
+	}
+	var units []string
+	var sb strings.Builder
+	for i := 0; i < len(org); i++ {
+		switch {
+		case org[i] == '\\' && i+1 < len(org):
+			i++
+			sb.WriteByte(org[i])
+		case org[i] == ';':
+			units = append(units, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteByte(org[i])
+		}
+	}
+	return append(units, sb.String())
 }
 
-type EncodedImage string
-
-func (e EncodedImage) isEncodedImage() bool {
-	return true
-}
-
-func (e EncodedImage) data() string {
-	return string(e)
-}
-
-type ImageURL string
-
-func (i ImageURL) isEncodedImage() bool {
-	return false
-}
-
-func (i ImageURL) data() string {
-	return string(i)
+// JoinOrg makes an Organization of the name and units, the opposite of
+// OrgUnits. Empty units at the end are left off.
+func JoinOrg(units ...string) string {
+	for len(units) > 0 && units[len(units)-1] == "" {
+		units = units[:len(units)-1]
+	}
+	escape := strings.NewReplacer(`\`, `\\`, ";", `\;`)
+	escaped := make([]string, len(units))
+	for i, unit := range units {
+		escaped[i] = escape.Replace(unit)
+	}
+	return strings.Join(escaped, ";")
 }
 
+// A property that has no typed field on ContactCard.
+// Kept with its group and parameters so it can be written back out.
 type XField struct {
-	Type string
-	Data string
+	Group  string
+	Type   string // property name, e.g. X-SKYPE or GEO
+	Params map[string][]string
+	Data   string // raw value, still escaped
 }
 
+// A labeled property from an Apple itemN group that has no typed field,
+// a URL or related name. item2.URL:https://example.com with
+// item2.X-ABLabel:blog is {2, "URL", "https://example.com", nil, "blog"}.
 type Item struct {
 	ItemNumber int
-	ItemName   string
-	ItemValue  string
+	ItemName   string   // property name
+	ItemValue  string   // raw value, still escaped
+	Type       []string // TYPE params
+	Label      string
 }
 
 type Address struct {
-	Type    string // Type of address (home, work, etc.)
-	Street  string
-	City    string
-	State   string
-	Zip     string
-	Country string
-	Label   string // Custom label (e.g., "Vacation Home")
+	Type     []string // Type of address (home, work, etc.)
+	POBox    string
+	Extended string // apartment or suite number
+	Street   string
+	City     string
+	State    string
+	Zip      string
+	Country  string
+	Label    string // Custom label (e.g., "Vacation Home")
+	Group    string // property group, e.g. item1
 }
 
 type EmailAddr struct {
-	Type    string
+	Type    []string
 	Address string
+	Label   string // custom label, e.g. "School"
+	Group   string
 }
 
 type Telephone struct {
 	Type   []string
 	Number string
+	Label  string // custom label, e.g. "Boat"
+	Group  string
+	Region string // CC parameter, the country of a national number, e.g. "GB"
 }
 
 type SocialMediaProfile struct {
-	Type string
-	URL  string
+	Type string // service, e.g. twitter
+	URL  string // or the user name when there is no URL
 }
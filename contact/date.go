@@ -0,0 +1,146 @@
+package contact
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A date, time or both as vCard allows them, any part can be missing.
+// Year-less birthdays (--0415) are the common case.
+// https://tools.ietf.org/html/rfc6350#section-4.3
+type DateOrTime struct {
+	Year  int // 0 if missing
+	Month int // 1-12, 0 if missing
+	Day   int // 1-31, 0 if missing
+
+	Hour      int
+	Minute    int
+	Second    int
+	HasHour   bool
+	HasMinute bool
+	HasSecond bool
+	Zone      string // "Z", "-0500" or "" for local time
+
+	// The value as written when it isn't a date at all,
+	// BDAY;VALUE=text:circa 1800. Nothing else is set then.
+	Text string
+}
+
+// Creates a DateOrTime from the date part of t.
+func NewDate(t time.Time) DateOrTime {
+	return DateOrTime{Year: t.Year(), Month: int(t.Month()), Day: t.Day()}
+}
+
+func (d DateOrTime) IsText() bool {
+	return d.Text != ""
+}
+
+func (d DateOrTime) HasDate() bool {
+	return d.Year != 0 || d.Month != 0 || d.Day != 0
+}
+
+func (d DateOrTime) HasTime() bool {
+	return d.HasHour || d.HasMinute || d.HasSecond
+}
+
+// The most specific vCard value type for d: date, time or date-time.
+// Text dates are text.
+func (d DateOrTime) ValueType() string {
+	switch {
+	case d.IsText():
+		return "text"
+	case d.HasDate() && d.HasTime():
+		return "date-time"
+	case d.HasTime():
+		return "time"
+	}
+	return "date"
+}
+
+// Time returns the date as a time.Time, only if year, month and
+// day are all there. A missing time of day is midnight UTC.
+func (d DateOrTime) Time() (time.Time, bool) {
+	if d.Year == 0 || d.Month == 0 || d.Day == 0 {
+		return time.Time{}, false
+	}
+	loc := time.UTC
+	if d.Zone != "" && d.Zone != "Z" {
+		if t, err := time.Parse("-0700", d.Zone); err == nil {
+			loc = t.Location()
+		}
+	}
+	return time.Date(d.Year, time.Month(d.Month), d.Day, d.Hour, d.Minute, d.Second, 0, loc), true
+}
+
+// String returns the basic form every vCard version is written with:
+// 19850415, --0415, 1985-04, T1030, 19850415T103000Z, or the text.
+func (d DateOrTime) String() string {
+	return d.format(false)
+}
+
+// Extended returns the ISO 8601 extended form used by jCard:
+// 1985-04-15, --04-15, 1985-04-15T10:30:00Z. xCard has the basic one.
+func (d DateOrTime) Extended() string {
+	return d.format(true)
+}
+
+func (d DateOrTime) format(extended bool) string {
+	if d.IsText() {
+		return d.Text
+	}
+	sep := ""
+	if extended {
+		sep = "-"
+	}
+
+	var sb strings.Builder
+	switch {
+	case d.Year != 0 && d.Month != 0 && d.Day != 0:
+		fmt.Fprintf(&sb, "%04d%s%02d%s%02d", d.Year, sep, d.Month, sep, d.Day)
+	case d.Year != 0 && d.Month != 0:
+		// a reduced date always has the dash
+		fmt.Fprintf(&sb, "%04d-%02d", d.Year, d.Month)
+	case d.Year != 0:
+		fmt.Fprintf(&sb, "%04d", d.Year)
+	case d.Month != 0 && d.Day != 0:
+		fmt.Fprintf(&sb, "--%02d%s%02d", d.Month, sep, d.Day)
+	case d.Month != 0:
+		fmt.Fprintf(&sb, "--%02d", d.Month)
+	case d.Day != 0:
+		fmt.Fprintf(&sb, "---%02d", d.Day)
+	}
+	if !d.HasTime() {
+		return sb.String()
+	}
+
+	sep = ""
+	if extended {
+		sep = ":"
+	}
+	sb.WriteString("T")
+	switch {
+	case d.HasHour:
+		fmt.Fprintf(&sb, "%02d", d.Hour)
+		if d.HasMinute {
+			fmt.Fprintf(&sb, "%s%02d", sep, d.Minute)
+			if d.HasSecond {
+				fmt.Fprintf(&sb, "%s%02d", sep, d.Second)
+			}
+		}
+	case d.HasMinute:
+		// truncated, the hour is left off
+		fmt.Fprintf(&sb, "-%02d", d.Minute)
+		if d.HasSecond {
+			fmt.Fprintf(&sb, "%s%02d", sep, d.Second)
+		}
+	default:
+		fmt.Fprintf(&sb, "--%02d", d.Second)
+	}
+	zone := d.Zone
+	if extended && len(zone) == 5 {
+		zone = zone[:3] + ":" + zone[3:]
+	}
+	sb.WriteString(zone)
+	return sb.String()
+}
@@ -0,0 +1,125 @@
+package contact
+
+import (
+	"encoding/base64"
+	"errors"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var ErrNotInline = errors.New("image is a URL, the data isn't in the card")
+
+// The value of a PHOTO, LOGO or SOUND, either inline data or a URL.
+type Image interface {
+	isEncodedImage() bool
+	data() string
+	// MediaType returns e.g. image/jpeg, "" if it isn't known.
+	MediaType() string
+	// Bytes returns the decoded data, ErrNotInline for an ImageURL.
+	Bytes() ([]byte, error)
+}
+
+// Inline data, kept as a data: URI (data:image/jpeg;base64,...).
+// Plain base64 without the data: prefix works too.
+type EncodedImage string
+
+// Creates a new EncodedImage from raw bytes.
+// The media type is guessed from the data if it's empty.
+func NewEncodedImage(mediaType string, b []byte) EncodedImage {
+	data := base64.StdEncoding.EncodeToString(b)
+	if mediaType == "" {
+		mediaType = SniffMediaType(data)
+	}
+	return EncodedImage("data:" + mediaType + ";base64," + data)
+}
+
+func (e EncodedImage) isEncodedImage() bool {
+	return true
+}
+
+func (e EncodedImage) data() string {
+	return string(e)
+}
+
+func (e EncodedImage) MediaType() string {
+	if mediaType, _, ok := SplitDataURI(string(e)); ok && mediaType != "" {
+		return mediaType
+	}
+	return SniffMediaType(e.Base64())
+}
+
+// Base64 returns the data without the data: URI header.
+func (e EncodedImage) Base64() string {
+	if _, data, ok := SplitDataURI(string(e)); ok {
+		return data
+	}
+	return string(e)
+}
+
+func (e EncodedImage) Bytes() ([]byte, error) {
+	data := e.Base64()
+	// some exporters leave the padding off
+	if b, err := base64.StdEncoding.DecodeString(data); err == nil {
+		return b, nil
+	}
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+}
+
+type ImageURL string
+
+func (i ImageURL) isEncodedImage() bool {
+	return false
+}
+
+func (i ImageURL) data() string {
+	return string(i)
+}
+
+// Guessed from the file extension of the URL.
+func (i ImageURL) MediaType() string {
+	u, err := url.Parse(string(i))
+	if err != nil {
+		return ""
+	}
+	mediaType := mime.TypeByExtension(path.Ext(u.Path))
+	// drop parameters like ; charset=utf-8
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	return mediaType
+}
+
+func (i ImageURL) Bytes() ([]byte, error) {
+	return nil, ErrNotInline
+}
+
+// Splits data:image/jpeg;base64,xxxx into its media type and data.
+// Only base64 data URIs are handled.
+// https://tools.ietf.org/html/rfc2397
+func SplitDataURI(value string) (string, string, bool) {
+	if !strings.HasPrefix(strings.ToLower(value), "data:") {
+		return "", "", false
+	}
+	header, data, found := strings.Cut(value[len("data:"):], ",")
+	if !found || !strings.HasSuffix(strings.ToLower(header), ";base64") {
+		return "", "", false
+	}
+	return header[:len(header)-len(";base64")], data, true
+}
+
+// Guesses the media type of base64 data from its magic bytes.
+func SniffMediaType(data string) string {
+	switch {
+	case strings.HasPrefix(data, "/9j/"):
+		return "image/jpeg"
+	case strings.HasPrefix(data, "iVBORw0KGgo"):
+		return "image/png"
+	case strings.HasPrefix(data, "R0lGOD"):
+		return "image/gif"
+	case strings.HasPrefix(data, "UklGR"):
+		return "audio/wav"
+	case strings.HasPrefix(data, "SUQz"), strings.HasPrefix(data, "//u"), strings.HasPrefix(data, "//s"):
+		return "audio/mpeg"
+	}
+	return "application/octet-stream"
+}
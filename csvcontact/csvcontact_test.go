@@ -0,0 +1,190 @@
+package csvcontact
+
+import (
+	"ContactCleaner/contact"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const google = "\ufeffName,Given Name,Family Name,Birthday,Group Membership,E-mail 1 - Type,E-mail 1 - Value,E-mail 2 - Type,E-mail 2 - Value," +
+	"Phone 1 - Type,Phone 1 - Value,Address 1 - Type,Address 1 - Formatted,Address 1 - Street,Address 1 - City,Address 1 - Region,Address 1 - Postal Code," +
+	"Organization 1 - Name,Organization 1 - Department,Event 1 - Type,Event 1 - Value,Relation 1 - Type,Relation 1 - Value,IM 1 - Service,IM 1 - Value," +
+	"Custom Field 1 - Type,Custom Field 1 - Value,Shoe Size\n" +
+	"Taco Cat,Taco,Cat,--04-15,* myContacts ::: Friends,* Work,taco@example.com ::: cat@example.com,School,taco@school.edu," +
+	"Mobile,+1 111 555 1212,Home,\"123 Main Street\nAny Town, CA 91921\",123 Main Street,Any Town,CA,91921," +
+	"Tacos,Salsa,Anniversary,2010-06-01,Spouse,Burrito Cat,Jabber,taco@example.com," +
+	"Favorite food,tacos,9\n" +
+	",,,,,,,,,,,,,,,,,,,,,,,,,,,\n"
+
+func TestReadGoogle(t *testing.T) {
+	r := NewReader(strings.NewReader(google), nil)
+	cards, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if layout, _ := r.Layout(); layout != Google {
+		t.Errorf("Expected the Google layout, got %v", layout.Name)
+	}
+	expected := []*contact.ContactCard{{
+		FullName:     "Taco Cat",
+		FirstName:    "Taco",
+		LastName:     "Cat",
+		Birthday:     &contact.DateOrTime{Month: 4, Day: 15},
+		Anniversary:  &contact.DateOrTime{Year: 2010, Month: 6, Day: 1},
+		Categories:   []string{"* myContacts", "Friends"},
+		Organization: "Tacos;Salsa",
+		Emails: []contact.EmailAddr{
+			{Type: []string{"work", "pref"}, Address: "taco@example.com"},
+			{Type: []string{"work", "pref"}, Address: "cat@example.com"},
+			{Address: "taco@school.edu", Label: "School"},
+		},
+		Telephones:       []contact.Telephone{{Type: []string{"cell"}, Number: "+1 111 555 1212"}},
+		Addresses:        []contact.Address{{Type: []string{"home"}, Street: "123 Main Street", City: "Any Town", State: "CA", Zip: "91921"}},
+		InstantMessaging: []string{"xmpp:taco@example.com"},
+		Items:            []contact.Item{{ItemNumber: 1, ItemName: "X-ABRELATEDNAMES", ItemValue: "Burrito Cat", Label: "Spouse"}},
+		CustomFields:     map[string]string{"X-FAVORITE-FOOD": "tacos", "X-SHOE-SIZE": "9"},
+	}}
+	if !reflect.DeepEqual(cards, expected) {
+		t.Errorf("Unexpected cards\nexpected %+v\ngot      %+v", expected[0], cards[0])
+	}
+}
+
+func TestReadOutlook(t *testing.T) {
+	data := "First Name,Last Name,Company,Business Phone,Business Fax,Mobile Phone,Home Street,Home City,E-mail Address,E-mail 2 Address,Birthday,Anniversary,Categories,Spouse,Priority\n" +
+		"Taco,Cat,Tacos,+1 111 555 1000,+1 111 555 1001,+1 111 555 1212,123 Main Street,Any Town,taco@example.com,cat@example.com,4/15/1604,0/0/00,Friends;Food,Burrito Cat,Normal\n"
+	cards, err := NewReader(strings.NewReader(data), nil).ReadAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []*contact.ContactCard{{
+		FirstName:    "Taco",
+		LastName:     "Cat",
+		Organization: "Tacos",
+		Birthday:     &contact.DateOrTime{Month: 4, Day: 15},
+		Categories:   []string{"Friends", "Food"},
+		Telephones: []contact.Telephone{
+			{Type: []string{"work"}, Number: "+1 111 555 1000"},
+			{Type: []string{"work", "fax"}, Number: "+1 111 555 1001"},
+			{Type: []string{"cell"}, Number: "+1 111 555 1212"},
+		},
+		Addresses:    []contact.Address{{Type: []string{"home"}, Street: "123 Main Street", City: "Any Town"}},
+		Emails:       []contact.EmailAddr{{Address: "taco@example.com"}, {Address: "cat@example.com"}},
+		Items:        []contact.Item{{ItemNumber: 1, ItemName: "X-ABRELATEDNAMES", ItemValue: "Burrito Cat", Label: "Spouse"}},
+		CustomFields: map[string]string{"X-PRIORITY": "Normal"},
+	}}
+	if !reflect.DeepEqual(cards, expected) {
+		t.Errorf("Unexpected cards\nexpected %+v\ngot      %+v", expected[0], cards[0])
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	card := &contact.ContactCard{
+		FullName:     "Taco Cat",
+		FirstName:    "Taco",
+		LastName:     "Cat",
+		Nickname:     "Tac",
+		Organization: "Tacos;Salsa",
+		Titles:       "Chef",
+		Birthday:     &contact.DateOrTime{Year: 1985, Month: 4, Day: 15},
+		Categories:   []string{"Friends", "Food"},
+		Emails: []contact.EmailAddr{
+			{Type: []string{"home"}, Address: "taco@example.com"},
+			{Type: []string{"work"}, Address: "cat@example.com"},
+		},
+		Telephones: []contact.Telephone{
+			{Type: []string{"cell"}, Number: "+1 111 555 1212"},
+			{Type: []string{"work", "fax"}, Number: "+1 111 555 1001"},
+		},
+		Addresses: []contact.Address{{Type: []string{"work"}, Street: "123 Main Street", City: "Any Town", State: "CA", Zip: "91921"}},
+		URL:       "https://example.com",
+		Items:     []contact.Item{{ItemNumber: 1, ItemName: "X-ABRELATEDNAMES", ItemValue: "Burrito Cat", Label: "Spouse"}},
+		Notes:     "Likes tacos,\nand \"burritos\".",
+	}
+	for _, layout := range []*Layout{Google, Outlook} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, layout)
+		w.Write(card)
+		w.Write(&contact.ContactCard{FirstName: "Burrito", Emails: []contact.EmailAddr{{Address: "a@example.com"}, {Address: "b@example.com"}, {Address: "c@example.com"}}})
+		if err := w.Flush(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", layout.Name, err)
+		}
+		expected := card
+		if layout == Outlook {
+			// Outlook has no column for the full name or the type of an
+			// e-mail, the phones come back in the order of the columns
+			c := *card
+			c.FullName = ""
+			c.Emails = []contact.EmailAddr{{Address: "taco@example.com"}, {Address: "cat@example.com"}}
+			c.Telephones = []contact.Telephone{card.Telephones[1], card.Telephones[0]}
+			expected = &c
+		}
+		if w.Dropped() != 0 {
+			t.Errorf("%s: expected nothing dropped, got %d", layout.Name, w.Dropped())
+		}
+
+		cards, err := NewReader(&buf, layout).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", layout.Name, err)
+		}
+		if len(cards) != 2 || !reflect.DeepEqual(cards[0], expected) {
+			t.Errorf("%s: round trip mismatch\nexpected %+v\ngot      %+v", layout.Name, expected, cards[0])
+		}
+		if len(cards) == 2 && len(cards[1].Emails) != 3 {
+			t.Errorf("%s: expected 3 e-mails, got %+v", layout.Name, cards[1].Emails)
+		}
+	}
+}
+
+func TestDropped(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Outlook)
+	w.Write(&contact.ContactCard{
+		FirstName:    "Taco",
+		Emails:       []contact.EmailAddr{{Address: "a@example.com"}, {Address: "b@example.com"}, {Address: "c@example.com"}, {Address: "d@example.com"}},
+		CustomFields: map[string]string{"X-FOO": "bar"},
+	})
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if w.Dropped() != 2 {
+		t.Errorf("Expected 2 values dropped, got %d", w.Dropped())
+	}
+}
+
+func TestCustomLayout(t *testing.T) {
+	layout, err := ReadLayout(strings.NewReader("# header,field\nFull Name,full-name\nWork Email,email[work] 1\nMobile,phone[cell] 1\nTown,address[home] 1 city\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data := "Full Name,Mobile,Work Email,Town\nTaco Cat,+1 111 555 1212,taco@example.com,Any Town\n"
+	cards, err := NewReader(strings.NewReader(data), layout).ReadAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []*contact.ContactCard{{
+		FullName:   "Taco Cat",
+		Emails:     []contact.EmailAddr{{Type: []string{"work"}, Address: "taco@example.com"}},
+		Telephones: []contact.Telephone{{Type: []string{"cell"}, Number: "+1 111 555 1212"}},
+		Addresses:  []contact.Address{{Type: []string{"home"}, City: "Any Town"}},
+	}}
+	if !reflect.DeepEqual(cards, expected) {
+		t.Errorf("Unexpected cards\nexpected %+v\ngot      %+v", expected[0], cards[0])
+	}
+
+	for _, bad := range []string{"Name,given-name\n", "Email,email 0\n", "Email,email 1 colour\n", "Name,first-name 1\n", "Phone,phone[work 1\n"} {
+		if _, err := ReadLayout(strings.NewReader(bad)); !errors.Is(err, ErrInvalidField) {
+			t.Errorf("%q: expected ErrInvalidField, got %v", bad, err)
+		}
+	}
+}
+
+func TestUnknownLayout(t *testing.T) {
+	for _, data := range []string{"", "Foo,Bar\n1,2\n"} {
+		if _, err := NewReader(strings.NewReader(data), nil).Read(); !errors.Is(err, ErrUnknownLayout) {
+			t.Errorf("%q: expected ErrUnknownLayout, got %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+// Package csvcontact reads and writes contacts as the CSV files Google
+// Contacts and Outlook export, or any other CSV given a column map.
+//
+//	Name,Given Name,Family Name,E-mail 1 - Type,E-mail 1 - Value,...
+//	Taco Cat,Taco,Cat,* Work,taco@example.com,...
+//
+// A Layout says what each column holds. Columns the Layout doesn't know
+// are kept in CustomFields so nothing in an export gets lost.
+package csvcontact
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownLayout = errors.New("unknown CSV layout")
+	ErrInvalidField  = errors.New("invalid column field")
+)
+
+// What a column holds. Name is one of
+//
+//	full-name first-name middle-name last-name prefix suffix nickname
+//	phonetic-first phonetic-middle phonetic-last organization department
+//	title birthday anniversary notes categories photo
+//
+// for the single values of a card, or one of
+//
+//	email phone address website im event relation custom
+//
+// for the ones a card can have more of. Those are in numbered blocks,
+// N is the block and Part the column of it: "" for the value, "type"
+// for the Google type or label and for addresses street, street2,
+// pobox, city, region, postal-code, country or formatted, im has service.
+// Outlook has a column per kind of phone instead, Types are the TYPE
+// params of the values in it, the label for events and relations.
+type Field struct {
+	Name  string
+	N     int
+	Part  string
+	Types []string
+}
+
+type Column struct {
+	Header string
+	Field  Field
+}
+
+type Layout struct {
+	Name    string
+	Columns []Column // what gets written, in order
+	// Other headers that are read the same, from older exports.
+	Aliases []Column
+	// Joins several values in one cell, Google's " ::: ".
+	// Empty means a cell is one value.
+	Separator string
+	// Dates are written 4/15/1985 instead of 1985-04-15.
+	USDates bool
+}
+
+var (
+	scalarFields = []string{
+		"full-name", "first-name", "middle-name", "last-name", "prefix", "suffix", "nickname",
+		"phonetic-first", "phonetic-middle", "phonetic-last", "organization", "department",
+		"title", "birthday", "anniversary", "notes", "categories", "photo",
+	}
+	blockFields = []string{"email", "phone", "address", "website", "im", "event", "relation", "custom"}
+	blockParts  = []string{"", "type", "street", "street2", "pobox", "city", "region", "postal-code", "country", "formatted", "service"}
+)
+
+// ParseField reads the text form of a Field, the name with the types in
+// brackets, then the block and the part:
+//
+//	first-name
+//	email 2 type
+//	phone[work,fax] 1
+//	address[home] 1 city
+func ParseField(s string) (Field, error) {
+	var f Field
+	tokens := strings.Fields(s)
+	if len(tokens) == 0 {
+		return f, fmt.Errorf("%w: empty", ErrInvalidField)
+	}
+	name, types, hasTypes := strings.Cut(tokens[0], "[")
+	f.Name = strings.ToLower(name)
+	if hasTypes {
+		types, ok := strings.CutSuffix(types, "]")
+		if !ok {
+			return f, fmt.Errorf("%w: %q has no closing ]", ErrInvalidField, s)
+		}
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				f.Types = append(f.Types, t)
+			}
+		}
+	}
+	if contains(scalarFields, f.Name) {
+		if len(tokens) > 1 || hasTypes {
+			return f, fmt.Errorf("%w: %s is a single value", ErrInvalidField, f.Name)
+		}
+		return f, nil
+	}
+	if !contains(blockFields, f.Name) {
+		return f, fmt.Errorf("%w: unknown field %q", ErrInvalidField, name)
+	}
+
+	f.N = 1
+	rest := tokens[1:]
+	if len(rest) > 0 {
+		if n, err := strconv.Atoi(rest[0]); err == nil {
+			if n < 1 {
+				return f, fmt.Errorf("%w: %q, blocks start at 1", ErrInvalidField, s)
+			}
+			f.N = n
+			rest = rest[1:]
+		}
+	}
+	if len(rest) > 0 {
+		f.Part = strings.ToLower(rest[0])
+		rest = rest[1:]
+	}
+	if len(rest) > 0 || !contains(blockParts, f.Part) {
+		return f, fmt.Errorf("%w: %q", ErrInvalidField, s)
+	}
+	return f, nil
+}
+
+// String is the text form ParseField reads.
+func (f Field) String() string {
+	s := f.Name
+	if len(f.Types) > 0 {
+		s += "[" + strings.Join(f.Types, ",") + "]"
+	}
+	if f.N > 0 {
+		s += " " + strconv.Itoa(f.N)
+	}
+	if f.Part != "" {
+		s += " " + f.Part
+	}
+	return s
+}
+
+// ReadLayout reads a column map, a CSV file of the header of each
+// column and the field it holds:
+//
+//	Full Name,full-name
+//	Work Email,email[work] 1
+//	Mobile,phone[cell] 1
+func ReadLayout(r io.Reader) (*Layout, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	layout := &Layout{Name: "custom"}
+	for _, rec := range records {
+		f, err := ParseField(rec[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rec[0], err)
+		}
+		layout.Columns = append(layout.Columns, Column{Header: rec[0], Field: f})
+	}
+	return layout, nil
+}
+
+// Layouts are the built in layouts, by name.
+var Layouts = map[string]*Layout{
+	"google":  Google,
+	"outlook": Outlook,
+}
+
+// Detect returns the built in layout that knows the most of header,
+// nil if none knows any of it.
+func Detect(header []string) *Layout {
+	var best *Layout
+	most := 0
+	for _, name := range []string{"google", "outlook"} {
+		layout := Layouts[name]
+		n := 0
+		for _, h := range header {
+			if _, ok := layout.Field(h); ok {
+				n++
+			}
+		}
+		if n > most {
+			best, most = layout, n
+		}
+	}
+	return best
+}
+
+var number = regexp.MustCompile(`\d+`)
+
+// Field returns what the column with header holds. Numbered blocks past
+// the ones in the layout are found too, E-mail 5 - Value is read like
+// E-mail 1 - Value.
+func (l *Layout) Field(header string) (Field, bool) {
+	header = strings.TrimSpace(header)
+	for _, cols := range [][]Column{l.Columns, l.Aliases} {
+		for _, col := range cols {
+			if strings.EqualFold(col.Header, header) {
+				return col.Field, true
+			}
+		}
+	}
+	loc := number.FindStringIndex(header)
+	if loc == nil {
+		return Field{}, false
+	}
+	n, err := strconv.Atoi(header[loc[0]:loc[1]])
+	if err != nil {
+		return Field{}, false
+	}
+	first := header[:loc[0]] + "1" + header[loc[1]:]
+	for _, cols := range [][]Column{l.Columns, l.Aliases} {
+		for _, col := range cols {
+			if col.Field.N == 1 && strings.EqualFold(col.Header, first) {
+				f := col.Field
+				f.N = n
+				return f, true
+			}
+		}
+	}
+	return Field{}, false
+}
+
+// Adds columns for the blocks past the last one of the layout, made by
+// numbering the headers of the first block, until each block name has
+// the number of blocks in counts. Layouts without numbers in the
+// headers, like Outlook's, stay as they are.
+func (l *Layout) expand(counts map[string]int) []Column {
+	cols := append([]Column(nil), l.Columns...)
+	have := make(map[string]int)
+	for _, col := range l.Columns {
+		if col.Field.N > have[col.Field.Name] {
+			have[col.Field.Name] = col.Field.N
+		}
+	}
+	for _, name := range blockFields {
+		var first []Column
+		for _, col := range l.Columns {
+			if col.Field.Name == name && col.Field.N == 1 && len(col.Field.Types) == 0 && strings.Contains(col.Header, "1") {
+				first = append(first, col)
+			}
+		}
+		if len(first) == 0 {
+			continue
+		}
+		for n := have[name] + 1; n <= counts[name]; n++ {
+			for _, col := range first {
+				col.Header = strings.Replace(col.Header, "1", strconv.Itoa(n), 1)
+				col.Field.N = n
+				cols = append(cols, col)
+			}
+		}
+	}
+	return cols
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func field(s string) Field {
+	f, err := ParseField(s)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func columns(pairs ...string) []Column {
+	cols := make([]Column, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		cols = append(cols, Column{Header: pairs[i], Field: field(pairs[i+1])})
+	}
+	return cols
+}
+
+// Google is the Google Contacts export, the "Google CSV" one. More
+// e-mails, phones and so on are more numbered blocks, several values of
+// the same type can share a block.
+var Google = &Layout{
+	Name:      "google",
+	Separator: " ::: ",
+	Columns: columns(
+		"Name", "full-name",
+		"Given Name", "first-name",
+		"Additional Name", "middle-name",
+		"Family Name", "last-name",
+		"Given Name Yomi", "phonetic-first",
+		"Additional Name Yomi", "phonetic-middle",
+		"Family Name Yomi", "phonetic-last",
+		"Name Prefix", "prefix",
+		"Name Suffix", "suffix",
+		"Nickname", "nickname",
+		"Birthday", "birthday",
+		"Notes", "notes",
+		"Photo", "photo",
+		"Group Membership", "categories",
+		"E-mail 1 - Type", "email 1 type",
+		"E-mail 1 - Value", "email 1",
+		"Phone 1 - Type", "phone 1 type",
+		"Phone 1 - Value", "phone 1",
+		"Address 1 - Type", "address 1 type",
+		"Address 1 - Formatted", "address 1 formatted",
+		"Address 1 - Street", "address 1 street",
+		"Address 1 - City", "address 1 city",
+		"Address 1 - PO Box", "address 1 pobox",
+		"Address 1 - Region", "address 1 region",
+		"Address 1 - Postal Code", "address 1 postal-code",
+		"Address 1 - Country", "address 1 country",
+		"Address 1 - Extended Address", "address 1 street2",
+		"Organization 1 - Name", "organization",
+		"Organization 1 - Title", "title",
+		"Organization 1 - Department", "department",
+		"Website 1 - Type", "website 1 type",
+		"Website 1 - Value", "website 1",
+		"IM 1 - Type", "im 1 type",
+		"IM 1 - Service", "im 1 service",
+		"IM 1 - Value", "im 1",
+		"Event 1 - Type", "event 1 type",
+		"Event 1 - Value", "event 1",
+		"Relation 1 - Type", "relation 1 type",
+		"Relation 1 - Value", "relation 1",
+		"Custom Field 1 - Type", "custom 1 type",
+		"Custom Field 1 - Value", "custom 1",
+	),
+	// the headers of the newer export
+	Aliases: columns(
+		"First Name", "first-name",
+		"Middle Name", "middle-name",
+		"Last Name", "last-name",
+		"Phonetic First Name", "phonetic-first",
+		"Phonetic Middle Name", "phonetic-middle",
+		"Phonetic Last Name", "phonetic-last",
+		"Labels", "categories",
+		"Organization Name", "organization",
+		"Organization Title", "title",
+		"Organization Department", "department",
+		"E-mail 1 - Label", "email 1 type",
+		"Phone 1 - Label", "phone 1 type",
+		"Address 1 - Label", "address 1 type",
+		"Website 1 - Label", "website 1 type",
+		"IM 1 - Label", "im 1 type",
+		"Event 1 - Label", "event 1 type",
+		"Relation 1 - Label", "relation 1 type",
+		"Custom Field 1 - Label", "custom 1 type",
+	),
+}
+
+// Outlook is the Outlook "Comma Separated Values" export, a fixed set of
+// columns with one for each kind of phone and address.
+var Outlook = &Layout{
+	Name:    "outlook",
+	USDates: true,
+	Columns: columns(
+		"Title", "prefix",
+		"First Name", "first-name",
+		"Middle Name", "middle-name",
+		"Last Name", "last-name",
+		"Suffix", "suffix",
+		"Company", "organization",
+		"Department", "department",
+		"Job Title", "title",
+		"Business Street", "address[work] 1 street",
+		"Business Street 2", "address[work] 1 street2",
+		"Business City", "address[work] 1 city",
+		"Business State", "address[work] 1 region",
+		"Business Postal Code", "address[work] 1 postal-code",
+		"Business Country/Region", "address[work] 1 country",
+		"Home Street", "address[home] 1 street",
+		"Home Street 2", "address[home] 1 street2",
+		"Home City", "address[home] 1 city",
+		"Home State", "address[home] 1 region",
+		"Home Postal Code", "address[home] 1 postal-code",
+		"Home Country/Region", "address[home] 1 country",
+		"Other Street", "address 1 street",
+		"Other Street 2", "address 1 street2",
+		"Other City", "address 1 city",
+		"Other State", "address 1 region",
+		"Other Postal Code", "address 1 postal-code",
+		"Other Country/Region", "address 1 country",
+		"Business Fax", "phone[work,fax] 1",
+		"Business Phone", "phone[work] 1",
+		"Business Phone 2", "phone[work] 2",
+		"Home Fax", "phone[home,fax] 1",
+		"Home Phone", "phone[home] 1",
+		"Home Phone 2", "phone[home] 2",
+		"Mobile Phone", "phone[cell] 1",
+		"Other Phone", "phone 1",
+		"Pager", "phone[pager] 1",
+		"Primary Phone", "phone[pref] 1",
+		"Anniversary", "anniversary",
+		"Assistant's Name", "relation[Assistant] 1",
+		"Birthday", "birthday",
+		"Categories", "categories",
+		"E-mail Address", "email 1",
+		"E-mail 2 Address", "email 2",
+		"E-mail 3 Address", "email 3",
+		"Manager's Name", "relation[Manager] 1",
+		"Nickname", "nickname",
+		"Notes", "notes",
+		"Spouse", "relation[Spouse] 1",
+		"Web Page", "website 1",
+	),
+	Aliases: columns(
+		"Business Country", "address[work] 1 country",
+		"Home Country", "address[home] 1 country",
+		"Other Country", "address 1 country",
+		"E-mail", "email 1",
+		"E-mail 2", "email 2",
+		"E-mail 3", "email 3",
+	),
+}
@@ -0,0 +1,445 @@
+package csvcontact
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/parsing"
+	"ContactCleaner/vcard"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The Google types of emails, phones and addresses, the first one with
+// the types of a value is the one written. Any other type is a label.
+var typeLabels = []struct {
+	label string
+	types []string
+}{
+	{"Work Fax", []string{"work", "fax"}},
+	{"Home Fax", []string{"home", "fax"}},
+	{"Mobile", []string{"cell"}},
+	{"Pager", []string{"pager"}},
+	{"Main", []string{"main-number"}},
+	{"Work", []string{"work"}},
+	{"Home", []string{"home"}},
+	{"Other", nil},
+}
+
+// Google's IM services and the IMPP scheme of each, the first one of a
+// scheme is the one written
+var imServices = []struct {
+	service string
+	scheme  string
+}{
+	{"AIM", "aim"},
+	{"Jabber", "xmpp"},
+	{"Google Talk", "xmpp"},
+	{"ICQ", "icq"},
+	{"MSN", "msnim"},
+	{"Yahoo", "ymsgr"},
+	{"Skype", "skype"},
+	{"QQ", "qq"},
+}
+
+const (
+	prefMark    = "* " // Google's mark for the preferred value
+	homePage    = "Home Page"
+	anniversary = "Anniversary"
+	birthday    = "Birthday"
+)
+
+// Reader reads contacts from a CSV file, one per row after the header.
+type Reader struct {
+	r      *csv.Reader
+	layout *Layout
+	header []string
+	fields []Field
+	known  []bool
+}
+
+// NewReader returns a Reader for the columns in layout, nil to pick the
+// built in layout that fits the header.
+func NewReader(r io.Reader, layout *Layout) *Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	return &Reader{r: cr, layout: layout}
+}
+
+// Layout returns the layout the file is read with, reading the header
+// if that hasn't happened yet.
+func (r *Reader) Layout() (*Layout, error) {
+	if r.header != nil {
+		return r.layout, nil
+	}
+	header, err := r.r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: no header", ErrUnknownLayout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		// Excel and Outlook start the file with a byte order mark
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	if r.layout == nil {
+		r.layout = Detect(header)
+	}
+	if r.layout == nil {
+		return nil, fmt.Errorf("%w: no known columns in %q", ErrUnknownLayout, strings.Join(header, ","))
+	}
+	r.header = header
+	r.fields = make([]Field, len(header))
+	r.known = make([]bool, len(header))
+	for i, h := range header {
+		r.fields[i], r.known[i] = r.layout.Field(h)
+	}
+	return r.layout, nil
+}
+
+// Read returns the contact in the next row, io.EOF at the end.
+// Empty rows are skipped.
+func (r *Reader) Read() (*contact.ContactCard, error) {
+	if _, err := r.Layout(); err != nil {
+		return nil, err
+	}
+	for {
+		row, err := r.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		if card := r.toContact(row); card != nil {
+			return card, nil
+		}
+	}
+}
+
+// ReadAll reads every row.
+func (r *Reader) ReadAll() ([]*contact.ContactCard, error) {
+	var cards []*contact.ContactCard
+	for {
+		card, err := r.Read()
+		if err == io.EOF {
+			return cards, nil
+		}
+		if err != nil {
+			return cards, err
+		}
+		cards = append(cards, card)
+	}
+}
+
+// the cells of one numbered block, E-mail 2 - Type and E-mail 2 - Value
+type entry struct {
+	field Field
+	types []string
+	label string
+	parts map[string]string
+}
+
+func (r *Reader) toContact(row []string) *contact.ContactCard {
+	card := &contact.ContactCard{}
+	var org, dept string
+	var entries []*entry
+	empty := true
+	for i, cell := range row {
+		cell = strings.TrimSpace(cell)
+		if cell == "" || i >= len(r.header) {
+			continue
+		}
+		empty = false
+		if !r.known[i] {
+			setCustom(card, r.header[i], cell)
+			continue
+		}
+		f := r.fields[i]
+		switch f.Name {
+		case "organization":
+			org = cell
+		case "department":
+			dept = cell
+		default:
+			if f.N == 0 {
+				r.setScalar(card, f.Name, cell)
+				continue
+			}
+			e := findEntry(entries, f)
+			if e == nil {
+				e = &entry{field: f, parts: make(map[string]string)}
+				entries = append(entries, e)
+			}
+			e.parts[f.Part] = cell
+		}
+	}
+	if empty {
+		return nil
+	}
+	if org != "" || dept != "" {
+		// the components of ORG
+		card.Organization = contact.JoinOrg(append([]string{org}, strings.Split(dept, vcard.SEMICOLON)...)...)
+	}
+	for _, e := range entries {
+		r.addEntry(card, e)
+	}
+	return card
+}
+
+func findEntry(entries []*entry, f Field) *entry {
+	for _, e := range entries {
+		if e.field.Name == f.Name && e.field.N == f.N && strings.Join(e.field.Types, ",") == strings.Join(f.Types, ",") {
+			return e
+		}
+	}
+	return nil
+}
+
+func (r *Reader) setScalar(card *contact.ContactCard, name, cell string) {
+	switch name {
+	case "full-name":
+		card.FullName = cell
+	case "first-name":
+		card.FirstName = cell
+	case "middle-name":
+		card.MiddleName = cell
+	case "last-name":
+		card.LastName = cell
+	case "prefix":
+		card.Prefix = cell
+	case "suffix":
+		card.Suffix = cell
+	case "nickname":
+		card.Nickname = cell
+	case "phonetic-first":
+		card.PhoneticFirst = cell
+	case "phonetic-middle":
+		card.PhoneticMiddle = cell
+	case "phonetic-last":
+		card.PhoneticLast = cell
+	case "title":
+		card.Titles = cell
+	case "birthday":
+		card.Birthday = parseDate(cell)
+	case "anniversary":
+		card.Anniversary = parseDate(cell)
+	case "notes":
+		card.Notes = cell
+	case "categories":
+		card.Categories = append(card.Categories, r.categories(cell)...)
+	case "photo":
+		if _, _, ok := contact.SplitDataURI(cell); ok {
+			card.Photo = contact.EncodedImage(cell)
+		} else {
+			card.Photo = contact.ImageURL(cell)
+		}
+	}
+}
+
+// Categories are split at the separator, or at ; like Outlook does
+// when the layout has none.
+func (r *Reader) categories(cell string) []string {
+	sep := r.layout.Separator
+	if sep == "" {
+		sep = vcard.SEMICOLON
+	}
+	var cats []string
+	for _, c := range strings.Split(cell, strings.TrimSpace(sep)) {
+		if c = strings.TrimSpace(c); c != "" {
+			cats = append(cats, c)
+		}
+	}
+	return cats
+}
+
+// The values of a cell, Google puts several in one.
+func (r *Reader) split(cell string) []string {
+	if r.layout.Separator == "" {
+		return []string{cell}
+	}
+	var vals []string
+	for _, v := range strings.Split(cell, strings.TrimSpace(r.layout.Separator)) {
+		if v = strings.TrimSpace(v); v != "" {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+func (r *Reader) addEntry(card *contact.ContactCard, e *entry) {
+	typ := e.parts["type"]
+	switch e.field.Name {
+	case "email", "phone", "address":
+		e.types, e.label = parseType(typ)
+		e.types = append(append([]string(nil), e.field.Types...), e.types...)
+	default:
+		// the type is a label, Outlook's Spouse column is a relation labeled Spouse
+		e.label = typ
+		if e.label == "" && len(e.field.Types) > 0 {
+			e.label = e.field.Types[0]
+		}
+	}
+
+	value := e.parts[""]
+	switch e.field.Name {
+	case "email":
+		for _, v := range r.split(value) {
+			card.Emails = append(card.Emails, contact.EmailAddr{Type: e.types, Address: v, Label: e.label})
+		}
+	case "phone":
+		for _, v := range r.split(value) {
+			card.Telephones = append(card.Telephones, contact.Telephone{Type: e.types, Number: v, Label: e.label})
+		}
+	case "address":
+		adr := contact.Address{
+			Type:     e.types,
+			Label:    e.label,
+			POBox:    e.parts["pobox"],
+			Extended: e.parts["street2"],
+			Street:   e.parts["street"],
+			City:     e.parts["city"],
+			State:    e.parts["region"],
+			Zip:      e.parts["postal-code"],
+			Country:  e.parts["country"],
+		}
+		if adr.POBox+adr.Extended+adr.Street+adr.City+adr.State+adr.Zip+adr.Country == "" {
+			// only the one line form
+			adr.Street = e.parts["formatted"]
+		}
+		if adr.Street != "" || adr.POBox+adr.Extended+adr.City+adr.State+adr.Zip+adr.Country != "" {
+			card.Addresses = append(card.Addresses, adr)
+		}
+	case "website":
+		for _, v := range r.split(value) {
+			if card.URL == "" && (e.label == "" || strings.EqualFold(e.label, homePage)) {
+				card.URL = v
+				continue
+			}
+			addItem(card, vcard.URL, v, e.label)
+		}
+	case "im":
+		scheme := imScheme(e.parts["service"])
+		for _, v := range r.split(value) {
+			if !vcard.HasScheme(v) {
+				v = scheme + ":" + v
+			}
+			card.InstantMessaging = append(card.InstantMessaging, v)
+		}
+	case "event":
+		for _, v := range r.split(value) {
+			d := parseDate(v)
+			switch {
+			case d == nil:
+			case strings.EqualFold(e.label, anniversary) && card.Anniversary == nil:
+				card.Anniversary = d
+			case strings.EqualFold(e.label, birthday) && card.Birthday == nil:
+				card.Birthday = d
+			case d.IsText():
+				addItem(card, vcard.X_ABDATE, vcard.Escape(d.Text), e.label)
+			default:
+				addItem(card, vcard.X_ABDATE, d.Extended(), e.label)
+			}
+		}
+	case "relation":
+		for _, v := range r.split(value) {
+			addItem(card, vcard.X_ABRELATEDNAMES, vcard.Escape(v), e.label)
+		}
+	case "custom":
+		if value != "" {
+			setCustom(card, e.label, value)
+		}
+	}
+}
+
+// Reads a Google type, * Work is the preferred work one.
+// Types it doesn't know are labels.
+func parseType(s string) ([]string, string) {
+	var types []string
+	if t, ok := strings.CutPrefix(s, strings.TrimSpace(prefMark)); ok {
+		s = strings.TrimSpace(t)
+		types = append(types, string(vcard.PREF))
+	}
+	if s == "" {
+		return types, ""
+	}
+	for _, tl := range typeLabels {
+		if strings.EqualFold(tl.label, s) {
+			return append(append([]string(nil), tl.types...), types...), ""
+		}
+	}
+	return types, s
+}
+
+func imScheme(service string) string {
+	for _, im := range imServices {
+		if strings.EqualFold(im.service, service) {
+			return im.scheme
+		}
+	}
+	if service == "" {
+		return "x-im"
+	}
+	return strings.ToLower(strings.Join(strings.Fields(service), "-"))
+}
+
+// Labeled values without a field, the same as from an Apple vCard
+func addItem(card *contact.ContactCard, name vcard.PropName, value, label string) {
+	card.Items = append(card.Items, contact.Item{
+		ItemNumber: len(card.Items) + 1,
+		ItemName:   string(name),
+		ItemValue:  value,
+		Label:      label,
+	})
+}
+
+var notName = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// Keeps a column the layout doesn't know as X-HEADER.
+func setCustom(card *contact.ContactCard, header, value string) {
+	if card.CustomFields == nil {
+		card.CustomFields = make(map[string]string)
+	}
+	card.CustomFields[customKey(header)] = value
+}
+
+// Shoe size -> X-SHOE-SIZE
+func customKey(s string) string {
+	name := strings.Trim(notName.ReplaceAllString(strings.ToUpper(s), "-"), "-")
+	if name == "" {
+		name = "CUSTOM"
+	}
+	if !strings.HasPrefix(name, vcard.X) {
+		name = vcard.X + name
+	}
+	return name
+}
+
+var usDate = regexp.MustCompile(`^(\d{1,2})/(\d{1,2})/(\d{2}|\d{4})$`)
+
+// Outlook writes this year when there is none
+const noYear = 1604
+
+// Reads an ISO date, 1985-04-15 or --04-15, or Outlook's 4/15/1985.
+// Anything else is kept as text. Outlook's 0/0/00 is no date at all.
+func parseDate(s string) *contact.DateOrTime {
+	if m := usDate.FindStringSubmatch(s); m != nil {
+		month, _ := strconv.Atoi(m[1])
+		day, _ := strconv.Atoi(m[2])
+		year, _ := strconv.Atoi(m[3])
+		if month == 0 && day == 0 {
+			return nil
+		}
+		if year == noYear {
+			year = 0
+		}
+		if len(m[3]) == 4 && month >= 1 && month <= 12 && day >= 1 && day <= 31 {
+			return &contact.DateOrTime{Year: year, Month: month, Day: day}
+		}
+	}
+	if d, err := parsing.ParseDateOrTime(s); err == nil {
+		return &d
+	}
+	return &contact.DateOrTime{Text: s}
+}
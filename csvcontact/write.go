@@ -0,0 +1,394 @@
+package csvcontact
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/vcard"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Writer writes contacts as CSV rows under a header. Google's numbered
+// blocks grow to fit the card with the most e-mails, phones and so on,
+// so nothing is written until Flush.
+type Writer struct {
+	w       *csv.Writer
+	layout  *Layout
+	cards   []*contact.ContactCard
+	dropped int
+}
+
+func NewWriter(w io.Writer, layout *Layout) *Writer {
+	return &Writer{w: csv.NewWriter(w), layout: layout}
+}
+
+// Write adds a card, it's written on Flush.
+func (w *Writer) Write(card *contact.ContactCard) error {
+	w.cards = append(w.cards, card)
+	return nil
+}
+
+// Flush writes the header and a row for every card.
+func (w *Writer) Flush() error {
+	rows := make([]*row, len(w.cards))
+	counts := make(map[string]int)
+	for i, card := range w.cards {
+		rows[i] = w.toRow(card)
+		for name, entries := range rows[i].entries {
+			counts[name] = max(counts[name], len(entries))
+		}
+	}
+	cols := w.layout.expand(counts)
+
+	header := make([]string, len(cols))
+	for i, col := range cols {
+		header[i] = col.Header
+	}
+	if err := w.w.Write(header); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		w.dropped += r.place(cols)
+		record := make([]string, len(cols))
+		for i, col := range cols {
+			record[i] = r.cell(col.Field, w.layout)
+		}
+		if err := w.w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.cards = nil
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// Dropped is how many values the layout had no column for, Outlook has
+// three e-mails and nowhere for a custom field.
+func (w *Writer) Dropped() int {
+	return w.dropped
+}
+
+// The values of one card before they're put in columns.
+type row struct {
+	scalars map[string]string
+	entries map[string][]*entry
+	placed  map[string]*entry // by block
+	dropped int
+}
+
+func blockKey(f Field) string {
+	f.Part = ""
+	return f.String()
+}
+
+func (w *Writer) toRow(card *contact.ContactCard) *row {
+	r := &row{scalars: make(map[string]string), entries: make(map[string][]*entry)}
+	l := w.layout
+	add := func(name string, e *entry) {
+		r.entries[name] = append(r.entries[name], e)
+	}
+	value := func(label, v string) *entry {
+		return &entry{label: label, parts: map[string]string{"": v}}
+	}
+
+	r.scalars["full-name"] = card.FullName
+	r.scalars["first-name"] = card.FirstName
+	r.scalars["middle-name"] = card.MiddleName
+	r.scalars["last-name"] = card.LastName
+	r.scalars["prefix"] = card.Prefix
+	r.scalars["suffix"] = card.Suffix
+	r.scalars["nickname"] = card.Nickname
+	r.scalars["phonetic-first"] = card.PhoneticFirst
+	r.scalars["phonetic-middle"] = card.PhoneticMiddle
+	r.scalars["phonetic-last"] = card.PhoneticLast
+	r.scalars["title"] = card.Titles
+	r.scalars["notes"] = card.Notes
+	if l.has("department") {
+		if units := contact.OrgUnits(card.Organization); len(units) > 0 {
+			// more units stay in the department, a;b
+			r.scalars["organization"] = units[0]
+			r.scalars["department"] = strings.Join(units[1:], vcard.SEMICOLON)
+		}
+	} else {
+		r.scalars["organization"] = strings.Join(contact.OrgUnits(card.Organization), vcard.SEMICOLON)
+	}
+	sep := l.Separator
+	if sep == "" {
+		sep = vcard.SEMICOLON
+	}
+	r.scalars["categories"] = strings.Join(card.Categories, sep)
+	switch img := card.Photo.(type) {
+	case contact.ImageURL:
+		r.scalars["photo"] = string(img)
+	case contact.EncodedImage:
+		r.scalars["photo"] = string(img)
+	}
+	// Google has its anniversaries in the events
+	date := func(name, label string, d *contact.DateOrTime) {
+		switch {
+		case d == nil:
+		case l.has(name):
+			r.scalars[name] = formatDate(d, l.USDates)
+		default:
+			add("event", value(label, formatDate(d, l.USDates)))
+		}
+	}
+	date("birthday", birthday, card.Birthday)
+	date("anniversary", anniversary, card.Anniversary)
+
+	for _, email := range card.Emails {
+		e := value(email.Label, email.Address)
+		e.types = email.Type
+		add("email", e)
+	}
+	for _, tel := range card.Telephones {
+		e := value(tel.Label, tel.Number)
+		e.types = tel.Type
+		add("phone", e)
+	}
+	for _, adr := range card.Addresses {
+		add("address", &entry{types: adr.Type, label: adr.Label, parts: map[string]string{
+			"street":      adr.Street,
+			"street2":     adr.Extended,
+			"pobox":       adr.POBox,
+			"city":        adr.City,
+			"region":      adr.State,
+			"postal-code": adr.Zip,
+			"country":     adr.Country,
+			"formatted":   formatAddress(adr),
+		}})
+	}
+	if card.URL != "" {
+		add("website", value("", card.URL))
+	}
+	for _, profile := range card.SocialProfiles {
+		add("website", value(profile.Type, profile.URL))
+	}
+	for _, impp := range card.InstantMessaging {
+		scheme, handle, _ := strings.Cut(impp, ":")
+		e := value("", handle)
+		e.parts["service"] = imService(scheme)
+		e.parts["uri"] = impp
+		add("im", e)
+	}
+	for _, item := range card.Items {
+		switch vcard.PropName(strings.ToUpper(item.ItemName)) {
+		case vcard.URL:
+			add("website", value(item.Label, item.ItemValue))
+		case vcard.X_ABDATE:
+			add("event", value(item.Label, formatDate(parseDate(vcard.Unescape(item.ItemValue)), l.USDates)))
+		case vcard.X_ABRELATEDNAMES, vcard.RELATED:
+			add("relation", value(item.Label, vcard.Unescape(item.ItemValue)))
+		default:
+			r.dropped++
+		}
+	}
+	keys := make([]string, 0, len(card.CustomFields))
+	for key := range card.CustomFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		add("custom", value(strings.TrimPrefix(key, vcard.X), card.CustomFields[key]))
+	}
+
+	// nowhere for these in a CSV file
+	r.dropped += len(card.ExtendedFields)
+	if card.DeathDate != nil {
+		r.dropped++
+	}
+	if card.Logos != nil {
+		r.dropped++
+	}
+	if card.Sound != nil {
+		r.dropped++
+	}
+	for name, v := range r.scalars {
+		// FN is made from the name parts when it's missing
+		if v != "" && name != "full-name" && !l.has(name) {
+			r.dropped++
+		}
+	}
+	return r
+}
+
+// Puts every entry in the free block of its name that fits it best,
+// an Outlook work fax in Business Fax rather than Business Phone.
+// Returns how many have no block.
+func (r *row) place(cols []Column) int {
+	var blocks []Field
+	seen := make(map[string]bool)
+	for _, col := range cols {
+		if col.Field.N == 0 || seen[blockKey(col.Field)] {
+			continue
+		}
+		seen[blockKey(col.Field)] = true
+		blocks = append(blocks, col.Field)
+	}
+
+	r.placed = make(map[string]*entry)
+	dropped := r.dropped
+	for _, name := range blockFields {
+		for _, e := range r.entries[name] {
+			best, score := "", -1
+			for _, b := range blocks {
+				key := blockKey(b)
+				if b.Name != name || r.placed[key] != nil {
+					continue
+				}
+				if s := fits(b, e); s > score {
+					best, score = key, s
+				}
+			}
+			if best == "" {
+				dropped++
+				continue
+			}
+			r.placed[best] = e
+		}
+	}
+	return dropped
+}
+
+// How well e fits block b, the number of types of the block, -1 when
+// the block has a type e doesn't. The label counts as a type, Outlook's
+// Spouse column fits the relation labeled Spouse.
+func fits(b Field, e *entry) int {
+	have := make(map[string]bool)
+	for _, t := range e.types {
+		have[strings.ToLower(t)] = true
+	}
+	have[strings.ToLower(e.label)] = true
+	for _, t := range b.Types {
+		if !have[strings.ToLower(t)] {
+			return -1
+		}
+	}
+	return len(b.Types)
+}
+
+func (r *row) cell(f Field, l *Layout) string {
+	if f.N == 0 {
+		return r.scalars[f.Name]
+	}
+	e := r.placed[blockKey(f)]
+	if e == nil {
+		return ""
+	}
+	switch {
+	case f.Part == "type":
+		switch f.Name {
+		case "email", "phone", "address":
+			return formatType(e.types, e.label)
+		}
+		return e.label
+	case f.Part == "" && f.Name == "im" && !l.hasPart(f, "service"):
+		// keep the scheme when there's no column for the service
+		return e.parts["uri"]
+	}
+	return e.parts[f.Part]
+}
+
+func (l *Layout) has(name string) bool {
+	for _, col := range l.Columns {
+		if col.Field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Layout) hasPart(f Field, part string) bool {
+	for _, col := range l.Columns {
+		if col.Field.Name == f.Name && col.Field.N == 1 && col.Field.Part == part {
+			return true
+		}
+	}
+	return false
+}
+
+// The Google type for the TYPE params, the label when there is one.
+// * marks the preferred value.
+func formatType(types []string, label string) string {
+	have := make(map[string]bool)
+	pref := false
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == string(vcard.PREF) {
+			pref = true
+			continue
+		}
+		have[t] = true
+	}
+	s := label
+	if s == "" {
+		for _, tl := range typeLabels {
+			if containsAll(have, tl.types) {
+				s = tl.label
+				break
+			}
+		}
+	}
+	if pref {
+		s = prefMark + s
+	}
+	return s
+}
+
+func containsAll(have map[string]bool, types []string) bool {
+	for _, t := range types {
+		if !have[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func imService(scheme string) string {
+	for _, im := range imServices {
+		if im.scheme == strings.ToLower(scheme) {
+			return im.service
+		}
+	}
+	return scheme
+}
+
+func formatDate(d *contact.DateOrTime, us bool) string {
+	switch {
+	case d == nil:
+		return ""
+	case d.IsText():
+		return d.Text
+	case us && d.Month != 0 && d.Day != 0 && !d.HasTime():
+		year := d.Year
+		if year == 0 {
+			year = noYear
+		}
+		return fmt.Sprintf("%d/%d/%d", d.Month, d.Day, year)
+	}
+	return d.Extended()
+}
+
+// The address on a few lines, like Google's Formatted column.
+func formatAddress(adr contact.Address) string {
+	var lines []string
+	cityLine := strings.TrimSpace(strings.Join(nonEmpty(adr.City, strings.TrimSpace(adr.State+" "+adr.Zip)), ", "))
+	for _, line := range []string{adr.Street, adr.Extended, adr.POBox, cityLine, adr.Country} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func nonEmpty(vals ...string) []string {
+	var out []string
+	for _, v := range vals {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,429 @@
+package dedupe
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/phone"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type MatchKind string
+
+const (
+	SameUID     MatchKind = "same UID"
+	SamePhone   MatchKind = "same phone"
+	SameEmail   MatchKind = "same email"
+	SameName    MatchKind = "same name"
+	SimilarName MatchKind = "similar name"
+)
+
+// how much each kind of match counts towards the confidence. Names stay
+// below DefaultOptions.MinConfidence, two John Smiths are only the same
+// with a shared UID, email or phone too.
+var weights = map[MatchKind]float64{
+	SameUID:     1.0,
+	SameEmail:   0.9,
+	SamePhone:   0.8,
+	SameName:    0.45,
+	SimilarName: 0.4,
+}
+
+// names less similar than this are not a reason
+const minNameSimilarity = 0.85
+
+// name tokens shared by more cards than this are too common ("john")
+// to be worth comparing every pair
+const maxNameTokenCards = 200
+
+// only used to find candidates, never a reason
+const nameToken MatchKind = "name token"
+
+// Why two cards were matched, Value is the shared (normalized) value.
+type Reason struct {
+	Kind  MatchKind
+	Value string
+}
+
+// A group of cards that are likely the same contact.
+type Cluster struct {
+	Cards []*contact.ContactCard
+	// positions of Cards in the slice passed to Find
+	Indexes []int
+	// 0 to 1, the weakest link that holds the cluster together
+	Confidence float64
+	Reasons    []Reason
+}
+
+type Options struct {
+	// pairs scoring below this are not duplicates
+	MinConfidence float64
+	// region for phone numbers without a country code, e.g. "US".
+	// When empty it's guessed from the numbers on the cards.
+	Region string
+}
+
+var DefaultOptions = Options{
+	MinConfidence: 0.5,
+}
+
+// Find returns the clusters of likely duplicates in cards using the
+// DefaultOptions. Cards without duplicates are not returned.
+func Find(cards []*contact.ContactCard) []Cluster {
+	return FindWithOptions(cards, DefaultOptions)
+}
+
+// FindWithOptions is Find with custom options.
+func FindWithOptions(cards []*contact.ContactCard, opts Options) []Cluster {
+	region := opts.Region
+	if region == "" {
+		region = GuessRegion(cards)
+	}
+	pairs := candidatePairs(cards, region)
+
+	uf := newUnionFind(len(cards))
+	confidence := make(map[int]float64)
+	reasons := make(map[int][]Reason)
+
+	// go through the pairs in a stable order so the output is too
+	keys := make([]pair, 0, len(pairs))
+	for p := range pairs {
+		keys = append(keys, p)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].a != keys[j].a {
+			return keys[i].a < keys[j].a
+		}
+		return keys[i].b < keys[j].b
+	})
+
+	var edges []edge
+	for _, p := range keys {
+		rs := pairs[p]
+		if r, ok := compareNames(cards[p.a], cards[p.b]); ok {
+			rs = append(rs, r)
+		}
+		score := Score(rs)
+		if score < opts.MinConfidence {
+			continue
+		}
+		edges = append(edges, edge{pair: p, score: score, reasons: rs})
+		uf.union(p.a, p.b)
+	}
+
+	for _, e := range edges {
+		root := uf.find(e.a)
+		if c, ok := confidence[root]; !ok || e.score < c {
+			confidence[root] = e.score
+		}
+		reasons[root] = mergeReasons(reasons[root], e.reasons)
+	}
+
+	var clusters []Cluster
+	members := make(map[int][]int)
+	var roots []int
+	for i := range cards {
+		root := uf.find(i)
+		if _, ok := confidence[root]; !ok {
+			continue
+		}
+		if len(members[root]) == 0 {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], i)
+	}
+	for _, root := range roots {
+		cluster := Cluster{
+			Indexes:    members[root],
+			Confidence: confidence[root],
+			Reasons:    reasons[root],
+		}
+		for _, i := range members[root] {
+			cluster.Cards = append(cluster.Cards, cards[i])
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// Score combines the reasons into a confidence between 0 and 1.
+// Every reason is treated as independent evidence: 1 - Π(1 - weight).
+// Repeats of the same kind don't count twice.
+func Score(reasons []Reason) float64 {
+	seen := make(map[MatchKind]bool)
+	miss := 1.0
+	for _, r := range reasons {
+		if seen[r.Kind] {
+			continue
+		}
+		seen[r.Kind] = true
+		miss *= 1 - weights[r.Kind]
+	}
+	return 1 - miss
+}
+
+type pair struct {
+	a, b int
+}
+
+// a pair that scored high enough to be duplicates
+type edge struct {
+	pair
+	score   float64
+	reasons []Reason
+}
+
+// Finds every pair of cards that share a UID, phone, email or name,
+// comparing all pairs would be too slow for big address books.
+func candidatePairs(cards []*contact.ContactCard, region string) map[pair][]Reason {
+	type key struct {
+		kind  MatchKind
+		value string
+	}
+	index := make(map[key][]int)
+	add := func(kind MatchKind, value string, i int) {
+		if value == "" {
+			return
+		}
+		k := key{kind, value}
+		// a card can list the same number twice
+		if ids := index[k]; len(ids) > 0 && ids[len(ids)-1] == i {
+			return
+		}
+		index[k] = append(index[k], i)
+	}
+	for i, card := range cards {
+		add(SameUID, strings.TrimSpace(card.UID), i)
+		for _, tel := range card.Telephones {
+			add(SamePhone, NormalizeTelephone(tel, region), i)
+		}
+		for _, email := range card.Emails {
+			add(SameEmail, NormalizeEmail(email.Address), i)
+		}
+		// names only find candidates, compareNames decides
+		name := normalizeName(card)
+		add(nameToken, name, i)
+		for _, token := range strings.Fields(name) {
+			add(nameToken, token, i)
+		}
+	}
+
+	pairs := make(map[pair][]Reason)
+	for k, ids := range index {
+		if k.kind == nameToken && len(ids) > maxNameTokenCards && !strings.Contains(k.value, " ") {
+			continue
+		}
+		for x := 0; x < len(ids); x++ {
+			for y := x + 1; y < len(ids); y++ {
+				p := pair{ids[x], ids[y]}
+				if k.kind == nameToken {
+					if _, ok := pairs[p]; !ok {
+						pairs[p] = nil
+					}
+					continue
+				}
+				pairs[p] = append(pairs[p], Reason{Kind: k.kind, Value: k.value})
+			}
+		}
+	}
+	return pairs
+}
+
+func mergeReasons(dst, src []Reason) []Reason {
+	for _, r := range src {
+		found := false
+		for _, d := range dst {
+			if d == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, r)
+		}
+	}
+	return dst
+}
+
+// Returns the E.164 form of a phone number so "+1 111 555 1212" and
+// "(111) 555-1212" match, with the extension if there is one.
+// Numbers the phone package can't make sense of fall back to their
+// last 10 digits. Numbers shorter than 7 digits are ignored.
+func NormalizePhone(number, region string) string {
+	if n, err := phone.Parse(number, region); err == nil {
+		if n.Extension != "" {
+			return n.E164() + ";ext=" + n.Extension
+		}
+		return n.E164()
+	}
+
+	var sb strings.Builder
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		}
+	}
+	digits := sb.String()
+	if len(digits) < 7 {
+		return ""
+	}
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return digits
+}
+
+// NormalizeTelephone is NormalizePhone with the CC parameter of tel, if
+// it has one, in place of region.
+func NormalizeTelephone(tel contact.Telephone, region string) string {
+	if tel.Region != "" {
+		region = tel.Region
+	}
+	return NormalizePhone(tel.Number, region)
+}
+
+// GuessRegion returns the most common region of the international
+// numbers on cards, so the national numbers can be read the same way.
+// Returns "" if there are none.
+func GuessRegion(cards []*contact.ContactCard) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, card := range cards {
+		for _, tel := range card.Telephones {
+			n, err := phone.Parse(tel.Number, "")
+			if err != nil {
+				continue
+			}
+			counts[n.Region]++
+			if counts[n.Region] > counts[best] || (counts[n.Region] == counts[best] && n.Region < best) {
+				best = n.Region
+			}
+		}
+	}
+	return best
+}
+
+// Lower cases an email address and strips any mailto: prefix.
+func NormalizeEmail(address string) string {
+	address = strings.ToLower(strings.TrimSpace(address))
+	return strings.TrimPrefix(address, "mailto:")
+}
+
+// Lower cased name tokens, punctuation removed and sorted so
+// "Cat, Taco" and "Taco Cat" come out the same.
+func normalizeName(card *contact.ContactCard) string {
+	name := card.FullName
+	if name == "" {
+		name = card.FirstName + " " + card.MiddleName + " " + card.LastName
+	}
+	tokens := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(tokens)
+	return strings.Join(tokens, " ")
+}
+
+// Returns a SameName or SimilarName reason if the names are close enough.
+func compareNames(a, b *contact.ContactCard) (Reason, bool) {
+	na, nb := normalizeName(a), normalizeName(b)
+	switch {
+	case na == "" || nb == "":
+		return Reason{}, false
+	case na == nb:
+		return Reason{Kind: SameName, Value: na}, true
+	case JaroWinkler(na, nb) >= minNameSimilarity:
+		return Reason{Kind: SimilarName, Value: na + " ~ " + nb}, true
+	}
+	return Reason{}, false
+}
+
+// JaroWinkler returns the Jaro-Winkler similarity of a and b,
+// 1 for identical strings and 0 for nothing in common.
+func JaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	window = max(window, 0)
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo := max(0, i-window)
+		hi := min(len(rb), i+window+1)
+		for j := lo; j < hi; j++ {
+			if matchedB[j] || ra[i] != rb[j] {
+				continue
+			}
+			matchedA[i] = true
+			matchedB[j] = true
+			matches++
+			break
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	// bonus for a common prefix of up to 4 characters
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+type unionFind struct {
+	parent []int
+}
+
+func newUnionFind(n int) *unionFind {
+	uf := &unionFind{parent: make([]int, n)}
+	for i := range uf.parent {
+		uf.parent[i] = i
+	}
+	return uf
+}
+
+func (uf *unionFind) find(i int) int {
+	for uf.parent[i] != i {
+		uf.parent[i] = uf.parent[uf.parent[i]]
+		i = uf.parent[i]
+	}
+	return i
+}
+
+func (uf *unionFind) union(a, b int) {
+	ra, rb := uf.find(a), uf.find(b)
+	if ra == rb {
+		return
+	}
+	// keep the lowest index as the root so clusters come out in input order
+	if rb < ra {
+		ra, rb = rb, ra
+	}
+	uf.parent[rb] = ra
+}
@@ -0,0 +1,147 @@
+package dedupe
+
+import (
+	"ContactCleaner/contact"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{FullName: "Taco Cat", Telephones: []contact.Telephone{{Number: "(111) 555-1212"}}},
+		{FullName: "Burrito Dog", Emails: []contact.EmailAddr{{Address: "burrito@example.com"}}},
+		{FullName: "Cat, Taco", Telephones: []contact.Telephone{{Number: "+1 111 555 1212"}}},
+		{FullName: "B. Dog", Emails: []contact.EmailAddr{{Address: "mailto:Burrito@Example.com"}}},
+		{FullName: "Nacho Bird", UID: "urn:uuid:1"},
+		{FullName: "Someone Else", UID: "urn:uuid:1"},
+		{FullName: "Lonely Quesadilla"},
+		{FullName: "Jonathan Smith", Emails: []contact.EmailAddr{{Address: "js@example.com"}}},
+		{FullName: "Jonathon Smith", Emails: []contact.EmailAddr{{Address: "js@example.com"}}},
+	}
+
+	clusters := Find(cards)
+	if len(clusters) != 4 {
+		t.Fatalf("Expected 4 clusters, got %d: %+v", len(clusters), clusters)
+	}
+
+	expected := []struct {
+		indexes []int
+		kinds   []MatchKind
+	}{
+		{[]int{0, 2}, []MatchKind{SamePhone, SameName}},
+		{[]int{1, 3}, []MatchKind{SameEmail}},
+		{[]int{4, 5}, []MatchKind{SameUID}},
+		{[]int{7, 8}, []MatchKind{SameEmail, SimilarName}},
+	}
+	for i, e := range expected {
+		c := clusters[i]
+		if len(c.Indexes) != len(e.indexes) || c.Indexes[0] != e.indexes[0] || c.Indexes[1] != e.indexes[1] {
+			t.Errorf("Cluster %d: expected indexes %v, got %v", i, e.indexes, c.Indexes)
+		}
+		if len(c.Reasons) != len(e.kinds) {
+			t.Errorf("Cluster %d: expected reasons %v, got %+v", i, e.kinds, c.Reasons)
+			continue
+		}
+		for j, kind := range e.kinds {
+			if c.Reasons[j].Kind != kind {
+				t.Errorf("Cluster %d: expected reason %s, got %s", i, kind, c.Reasons[j].Kind)
+			}
+		}
+		if c.Confidence <= 0 || c.Confidence > 1 {
+			t.Errorf("Cluster %d: confidence out of range: %f", i, c.Confidence)
+		}
+	}
+	if clusters[0].Confidence <= clusters[1].Confidence-0.2 {
+		t.Errorf("Phone and name should beat email alone: %f vs %f", clusters[0].Confidence, clusters[1].Confidence)
+	}
+}
+
+func TestFindSameNameOnly(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{FullName: "John Smith", Emails: []contact.EmailAddr{{Address: "john@example.com"}}},
+		{FullName: "Smith, John", Telephones: []contact.Telephone{{Number: "+1 111 555 1212"}}},
+	}
+	if clusters := Find(cards); len(clusters) != 0 {
+		t.Errorf("The same name alone should not be a duplicate, got %+v", clusters)
+	}
+}
+
+// A national number with a CC parameter is read in that country, not
+// the region of the other numbers.
+func TestFindPhoneCC(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{FullName: "Taco Cat", Telephones: []contact.Telephone{{Number: "020 7946 0200", Region: "GB"}}},
+		{FullName: "Burrito Cat", Telephones: []contact.Telephone{{Number: "+44 20 7946 0200"}}},
+		{FullName: "Nacho Cat", Telephones: []contact.Telephone{{Number: "(111) 555-1212"}}},
+	}
+	clusters := FindWithOptions(cards, Options{MinConfidence: 0.5, Region: "US"})
+	if len(clusters) != 1 || clusters[0].Indexes[0] != 0 || clusters[0].Indexes[1] != 1 {
+		t.Fatalf("Expected the GB numbers to match, got %+v", clusters)
+	}
+	if r := clusters[0].Reasons[0]; r.Kind != SamePhone || r.Value != "+442079460200" {
+		t.Errorf("Unexpected reason %+v", r)
+	}
+}
+
+func TestFindSimilarNameOnly(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{FullName: "Jonathan Smith"},
+		{FullName: "Jonathon Smith"},
+	}
+	if clusters := Find(cards); len(clusters) != 0 {
+		t.Errorf("A similar name alone should not be a duplicate, got %+v", clusters)
+	}
+	if clusters := FindWithOptions(cards, Options{MinConfidence: 0.4}); len(clusters) != 1 {
+		t.Errorf("Expected a cluster with a lower threshold, got %+v", clusters)
+	}
+}
+
+func TestJaroWinkler(t *testing.T) {
+	tests := []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{"martha", "marhta", 0.96, 0.97},
+		{"taco", "taco", 1, 1},
+		{"abc", "xyz", 0, 0},
+		{"", "", 1, 1},
+	}
+	for _, test := range tests {
+		if sim := JaroWinkler(test.a, test.b); sim < test.min || sim > test.max {
+			t.Errorf("JaroWinkler(%q, %q) = %f, expected between %f and %f", test.a, test.b, sim, test.min, test.max)
+		}
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		number, region, expected string
+	}{
+		{"(111) 555-1212", "US", "+11115551212"},
+		{"+1 111 555 1212", "", "+11115551212"},
+		{"020 7946 0200", "GB", "+442079460200"},
+		{"+44 (0)20 7946 0200", "US", "+442079460200"},
+		{"+1 111 555 1212 x12", "", "+11115551212;ext=12"},
+		{"(111) 555-1212", "", "1115551212"},
+		{"555", "US", ""},
+	}
+	for _, test := range tests {
+		if got := NormalizePhone(test.number, test.region); got != test.expected {
+			t.Errorf("NormalizePhone(%q, %q): expected %q, got %q", test.number, test.region, test.expected, got)
+		}
+	}
+}
+
+func TestFindGuessesRegion(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{FullName: "Taco Cat", Telephones: []contact.Telephone{{Number: "020 7946 0200"}}},
+		{FullName: "T. Cat", Telephones: []contact.Telephone{{Number: "+44 20 7946 0200"}}},
+	}
+	clusters := Find(cards)
+	if len(clusters) != 1 {
+		t.Fatalf("Expected 1 cluster, got %d", len(clusters))
+	}
+	if clusters[0].Reasons[0].Value != "+442079460200" {
+		t.Errorf("Expected the E.164 number as the reason, got %q", clusters[0].Reasons[0].Value)
+	}
+}
@@ -0,0 +1,321 @@
+// Package ical makes an iCalendar feed of the birthdays and
+// anniversaries of contacts, one yearly all-day event each.
+//
+//	BEGIN:VEVENT
+//	UID:5b0c1e8a-...
+//	DTSTART;VALUE=DATE:19850415
+//	RRULE:FREQ=YEARLY
+//	SUMMARY:Taco Cat's birthday (1985)
+//	END:VEVENT
+//
+// When the year is known the next few years are also there as
+// overrides of the event with the age in the summary, "Taco Cat's 41st
+// birthday". UIDs come from the contact UID, a feed made again from the
+// same contacts has the same events and a subscription won't double them.
+//
+// https://tools.ietf.org/html/rfc5545
+package ical
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/vcard"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ProdID        = "-//ContactCleaner//Birthdays//EN"
+	maxLineLength = 75
+	crlf          = "\r\n"
+	dateFormat    = "20060102"
+	stampFormat   = "20060102T150405Z"
+
+	// the year of the events of dates without one, a leap year so
+	// there is a February 29
+	noYear = 2000
+)
+
+// Namespace of the UIDs, a name-based UUID of the contact UID and kind.
+var namespace = [16]byte{0x6f, 0x1d, 0x3c, 0x52, 0x8e, 0x47, 0x4b, 0x2a, 0x9c, 0x05, 0x3e, 0x61, 0xd8, 0x7b, 0x12, 0xa4}
+
+type Kind string
+
+const (
+	Birthday    Kind = "birthday"
+	Anniversary Kind = "anniversary"
+)
+
+// Event is one yearly event.
+type Event struct {
+	UID  string
+	Kind Kind
+	Name string
+	Date contact.DateOrTime // Year is 0 when it isn't known
+}
+
+type Options struct {
+	// DTSTAMP of the events of contacts without a REV.
+	Stamp time.Time
+	// The ages from the year of Stamp on for this many years,
+	// 0 for none.
+	Years int
+	// X-WR-CALNAME, the name calendars show for the feed.
+	Name string
+}
+
+var DefaultOptions = Options{Years: 2, Name: "Birthdays"}
+
+// Events returns the birthday and anniversary of card. Dates without a
+// month and day, or only as text, can't recur and are left out.
+func Events(card *contact.ContactCard) []Event {
+	var events []Event
+	name := displayName(card)
+	for _, d := range []struct {
+		kind Kind
+		date *contact.DateOrTime
+	}{{Birthday, card.Birthday}, {Anniversary, card.Anniversary}} {
+		if d.date == nil || d.date.IsText() || d.date.Month == 0 || d.date.Day == 0 {
+			continue
+		}
+		e := Event{
+			UID:  uid(card, d.kind),
+			Kind: d.kind,
+			Name: name,
+			Date: contact.DateOrTime{Year: d.date.Year, Month: d.date.Month, Day: d.date.Day},
+		}
+		if _, ok := e.on(noYear); !ok {
+			// April 31
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// Write writes a calendar with the events of every card. A UID is only
+// used once, duplicate cards (the same contact UID, or the same name and
+// date without one) only add the events of the first.
+func Write(w io.Writer, cards []*contact.ContactCard, opts Options) error {
+	var sb strings.Builder
+	line := func(s string) {
+		sb.WriteString(fold(s))
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:" + ProdID)
+	line("CALSCALE:GREGORIAN")
+	if opts.Name != "" {
+		line("X-WR-CALNAME:" + vcard.Escape(opts.Name))
+	}
+
+	var events []Event
+	stamps := make(map[string]time.Time)
+	for _, card := range cards {
+		for _, e := range Events(card) {
+			if _, ok := stamps[e.UID]; ok {
+				continue
+			}
+			events = append(events, e)
+			stamps[e.UID] = opts.Stamp
+			if !card.Revision.IsZero() {
+				stamps[e.UID] = card.Revision
+			}
+		}
+	}
+	// the same order every time, by date then UID
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i].Date, events[j].Date
+		if a.Month != b.Month {
+			return a.Month < b.Month
+		}
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		return events[i].UID < events[j].UID
+	})
+
+	for _, e := range events {
+		stamp := "DTSTAMP:" + stamps[e.UID].UTC().Format(stampFormat)
+		category := "CATEGORIES:" + strings.ToUpper(string(e.Kind[:1])) + string(e.Kind[1:])
+		start := e.start()
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line(stamp)
+		line("DTSTART;VALUE=DATE:" + start.Format(dateFormat))
+		line("DTEND;VALUE=DATE:" + start.AddDate(0, 0, 1).Format(dateFormat))
+		line("RRULE:" + e.rule())
+		line("SUMMARY:" + vcard.Escape(e.Summary()))
+		line(category)
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+
+		if e.Date.Year == 0 {
+			continue
+		}
+		// this year and the next ones with the age
+		for year := opts.Stamp.Year(); year < opts.Stamp.Year()+opts.Years; year++ {
+			day, ok := e.on(year)
+			if !ok || year <= e.Date.Year {
+				continue
+			}
+			line("BEGIN:VEVENT")
+			line("UID:" + e.UID)
+			line(stamp)
+			line("RECURRENCE-ID;VALUE=DATE:" + day.Format(dateFormat))
+			line("DTSTART;VALUE=DATE:" + day.Format(dateFormat))
+			line("DTEND;VALUE=DATE:" + day.AddDate(0, 0, 1).Format(dateFormat))
+			line("SUMMARY:" + vcard.Escape(e.SummaryIn(year)))
+			line(category)
+			line("TRANSP:TRANSPARENT")
+			line("END:VEVENT")
+		}
+	}
+	line("END:VCALENDAR")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Marshal returns the calendar Write writes.
+func Marshal(cards []*contact.ContactCard, opts Options) []byte {
+	var sb strings.Builder
+	Write(&sb, cards, opts)
+	return []byte(sb.String())
+}
+
+// Summary is the summary of every year, with the year when it's known.
+// Taco Cat's birthday (1985)
+func (e Event) Summary() string {
+	s := possessive(e.Name) + " " + string(e.Kind)
+	if e.Date.Year != 0 {
+		s += fmt.Sprintf(" (%d)", e.Date.Year)
+	}
+	return s
+}
+
+// SummaryIn is the summary of the event in year, with the age when
+// the year is known. Taco Cat's 41st birthday
+func (e Event) SummaryIn(year int) string {
+	if e.Date.Year == 0 || year <= e.Date.Year {
+		return e.Summary()
+	}
+	return possessive(e.Name) + " " + ordinal(year-e.Date.Year) + " " + string(e.Kind)
+}
+
+func (e Event) start() time.Time {
+	year := e.Date.Year
+	if year == 0 {
+		year = noYear
+	}
+	return time.Date(year, time.Month(e.Date.Month), e.Date.Day, 0, 0, 0, 0, time.UTC)
+}
+
+// February 29 is on February 28 in the other years, a yearly rule
+// alone would skip them.
+func (e Event) rule() string {
+	if e.leapDay() {
+		return "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1"
+	}
+	return "FREQ=YEARLY"
+}
+
+func (e Event) leapDay() bool {
+	return e.Date.Month == 2 && e.Date.Day == 29
+}
+
+// The day of the event in year, false if there's none.
+func (e Event) on(year int) (time.Time, bool) {
+	day := time.Date(year, time.Month(e.Date.Month), e.Date.Day, 0, 0, 0, 0, time.UTC)
+	if day.Month() != time.Month(e.Date.Month) {
+		if !e.leapDay() {
+			return day, false
+		}
+		day = time.Date(year, time.February, 28, 0, 0, 0, 0, time.UTC)
+	}
+	return day, true
+}
+
+// A name-based UUID (version 5) of the contact UID and kind. Contacts
+// without a UID get one from their name and date, which at least stays
+// the same while those do.
+func uid(card *contact.ContactCard, kind Kind) string {
+	key := card.UID
+	if key == "" {
+		d := card.Birthday
+		if kind == Anniversary {
+			d = card.Anniversary
+		}
+		key = displayName(card) + "\x00" + d.String()
+	}
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(key + "\x00" + string(kind)))
+	b := h.Sum(nil)[:16]
+	b[6] = b[6]&0x0f | 0x50
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func displayName(card *contact.ContactCard) string {
+	if card.FullName != "" {
+		return card.FullName
+	}
+	parts := []string{card.Prefix, card.FirstName, card.MiddleName, card.LastName, card.Suffix}
+	if name := strings.Join(strings.Fields(strings.Join(parts, " ")), " "); name != "" {
+		return name
+	}
+	if card.Nickname != "" {
+		return card.Nickname
+	}
+	if units := contact.OrgUnits(card.Organization); len(units) > 0 {
+		return units[0]
+	}
+	return ""
+}
+
+func possessive(name string) string {
+	if name == "" {
+		return "Someone's"
+	}
+	if strings.HasSuffix(name, "s") {
+		return name + "'"
+	}
+	return name + "'s"
+}
+
+// 1st, 2nd, 3rd, 4th, 11th, 12th, 13th, 21st
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// Folds a content line at 75 octets without splitting a UTF-8 sequence.
+func fold(line string) string {
+	var sb strings.Builder
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		sb.WriteString(line[:cut] + crlf + " ")
+		line = line[cut:]
+		// the leading space counts towards the limit
+		limit = maxLineLength - 1
+	}
+	sb.WriteString(line + crlf)
+	return sb.String()
+}
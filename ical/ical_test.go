@@ -0,0 +1,123 @@
+package ical
+
+import (
+	"ContactCleaner/contact"
+	"strings"
+	"testing"
+	"time"
+)
+
+var stamp = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestWrite(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{
+			UID:         "urn:uuid:1",
+			FullName:    "Taco Cat",
+			Birthday:    &contact.DateOrTime{Year: 1985, Month: 4, Day: 15},
+			Anniversary: &contact.DateOrTime{Month: 6, Day: 1},
+			Revision:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{FirstName: "Burrito", LastName: "Cats", Birthday: &contact.DateOrTime{Year: 2000, Month: 2, Day: 29}},
+		{FullName: "No Date", Birthday: &contact.DateOrTime{Text: "circa 1800"}, Anniversary: &contact.DateOrTime{Year: 2010}},
+	}
+	out := string(Marshal(cards, Options{Stamp: stamp, Years: 2, Name: "Birthdays, etc."}))
+
+	taco := Events(cards[0])
+	burrito := Events(cards[1])
+	if len(taco) != 2 || len(burrito) != 1 || len(Events(cards[2])) != 0 {
+		t.Fatalf("Unexpected events %+v %+v", taco, burrito)
+	}
+	for _, e := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:" + ProdID + "\r\n",
+		"X-WR-CALNAME:Birthdays\\, etc.\r\n",
+
+		// the year is known, the next two have the age
+		"UID:" + taco[0].UID + "\r\nDTSTAMP:20240102T030405Z\r\nDTSTART;VALUE=DATE:19850415\r\nDTEND;VALUE=DATE:19850416\r\nRRULE:FREQ=YEARLY\r\nSUMMARY:Taco Cat's birthday (1985)\r\nCATEGORIES:Birthday\r\n",
+		"RECURRENCE-ID;VALUE=DATE:20260415\r\nDTSTART;VALUE=DATE:20260415\r\nDTEND;VALUE=DATE:20260416\r\nSUMMARY:Taco Cat's 41st birthday\r\n",
+		"SUMMARY:Taco Cat's 42nd birthday\r\n",
+
+		// it isn't
+		"UID:" + taco[1].UID + "\r\nDTSTAMP:20240102T030405Z\r\nDTSTART;VALUE=DATE:20000601\r\nDTEND;VALUE=DATE:20000602\r\nRRULE:FREQ=YEARLY\r\nSUMMARY:Taco Cat's anniversary\r\nCATEGORIES:Anniversary\r\n",
+
+		// February 29 is on the 28th when there's none
+		"DTSTAMP:20260301T120000Z\r\nDTSTART;VALUE=DATE:20000229\r\nDTEND;VALUE=DATE:20000301\r\nRRULE:FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1\r\nSUMMARY:Burrito Cats' birthday (2000)\r\n",
+		"RECURRENCE-ID;VALUE=DATE:20260228\r\nDTSTART;VALUE=DATE:20260228\r\nDTEND;VALUE=DATE:20260301\r\nSUMMARY:Burrito Cats' 26th birthday\r\n",
+
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, e) {
+			t.Errorf("Expected %q in\n%s", e, out)
+		}
+	}
+	if strings.Count(out, "BEGIN:VEVENT") != 7 {
+		t.Errorf("Expected 7 events in\n%s", out)
+	}
+	// by date
+	if strings.Index(out, "Burrito") > strings.Index(out, "Taco") {
+		t.Errorf("Expected February before April in\n%s", out)
+	}
+}
+
+// Cards that weren't deduped yet mustn't give two events one UID.
+func TestDuplicateCards(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{UID: "urn:uuid:1", FullName: "Taco Cat", Birthday: &contact.DateOrTime{Year: 1985, Month: 4, Day: 15}},
+		{UID: "urn:uuid:1", FullName: "Taco Q. Cat", Birthday: &contact.DateOrTime{Month: 4, Day: 16}},
+		{FullName: "Burrito Cat", Birthday: &contact.DateOrTime{Month: 6, Day: 1}},
+		{FullName: "Burrito Cat", Birthday: &contact.DateOrTime{Month: 6, Day: 1}},
+	}
+	out := string(Marshal(cards, Options{Stamp: stamp, Years: 2}))
+	if n := strings.Count(out, "RRULE:"); n != 2 {
+		t.Errorf("Expected 2 yearly events, got %d in\n%s", n, out)
+	}
+	if n := strings.Count(out, "RECURRENCE-ID"); n != 2 {
+		t.Errorf("Expected 2 overrides, got %d in\n%s", n, out)
+	}
+	if strings.Contains(out, "Taco Q. Cat") {
+		t.Errorf("Expected the first card's event in\n%s", out)
+	}
+}
+
+// The UIDs stay the same when the feed is made again, and differ for
+// every contact and kind.
+func TestStableUIDs(t *testing.T) {
+	card := &contact.ContactCard{UID: "urn:uuid:1", FullName: "Taco Cat", Birthday: &contact.DateOrTime{Month: 4, Day: 15}, Anniversary: &contact.DateOrTime{Month: 6, Day: 1}}
+	renamed := &contact.ContactCard{UID: "urn:uuid:1", FullName: "Taco Q. Cat", Birthday: &contact.DateOrTime{Month: 4, Day: 16}}
+	other := &contact.ContactCard{UID: "urn:uuid:2", FullName: "Taco Cat", Birthday: &contact.DateOrTime{Month: 4, Day: 15}}
+
+	a, b, c := Events(card), Events(renamed), Events(other)
+	if a[0].UID != b[0].UID {
+		t.Errorf("Expected the same UID for the same contact, got %s and %s", a[0].UID, b[0].UID)
+	}
+	if a[0].UID == a[1].UID || a[0].UID == c[0].UID {
+		t.Errorf("Expected different UIDs, got %s %s %s", a[0].UID, a[1].UID, c[0].UID)
+	}
+	if len(a[0].UID) != 36 || a[0].UID[14] != '5' {
+		t.Errorf("Expected a version 5 UUID, got %s", a[0].UID)
+	}
+	noUID := &contact.ContactCard{FullName: "Taco Cat", Birthday: &contact.DateOrTime{Month: 4, Day: 15}}
+	if Events(noUID)[0].UID != Events(noUID)[0].UID {
+		t.Errorf("Expected the same UID without a contact UID")
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	for n, e := range map[int]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th", 21: "21st", 102: "102nd", 111: "111th"} {
+		if got := ordinal(n); got != e {
+			t.Errorf("ordinal(%d) = %q, expected %q", n, got, e)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("ā", 60)
+	for _, l := range strings.Split(strings.TrimSuffix(fold(line), "\r\n"), "\r\n ") {
+		if len(l) > maxLineLength-1 && !strings.HasPrefix(l, "SUMMARY:") || len(l) > maxLineLength {
+			t.Errorf("Line too long: %q", l)
+		}
+	}
+	if got := strings.ReplaceAll(strings.TrimSuffix(fold(line), "\r\n"), "\r\n ", ""); got != line {
+		t.Errorf("Unfolded %q, expected %q", got, line)
+	}
+}
@@ -0,0 +1,365 @@
+// Package jcard reads and writes vCards as jCard, the JSON format
+// of RFC 7095.
+//
+//	["vcard", [
+//	  ["version", {}, "text", "4.0"],
+//	  ["n", {}, "text", ["Cat", "Taco", "", ["Dr."], ""]],
+//	  ["tel", {"type": ["work", "voice"]}, "uri", "tel:+1-111-555-1212"]
+//	]]
+//
+// https://tools.ietf.org/html/rfc7095
+package jcard
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/parsing"
+	"ContactCleaner/vcard"
+	"ContactCleaner/writing"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidJCard = errors.New("invalid jCard")
+
+const (
+	vcardTag   = "vcard"
+	groupParam = "group"
+)
+
+// Marshal encodes v as a jCard. jCard is always vCard 4.0, the VERSION
+// is set to 4.0 and inline data from older versions becomes a data: URI.
+func Marshal(v *vcard.VCard) ([]byte, error) {
+	return json.Marshal(toJSON(v))
+}
+
+// MarshalAll encodes cards as a JSON array of jCards.
+func MarshalAll(cards []*vcard.VCard) ([]byte, error) {
+	list := make([]any, len(cards))
+	for i, v := range cards {
+		list[i] = toJSON(v)
+	}
+	return json.Marshal(list)
+}
+
+// Unmarshal decodes a single jCard.
+func Unmarshal(data []byte) (*vcard.VCard, error) {
+	var raw any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJCard, err)
+	}
+	return fromJSON(raw)
+}
+
+// MarshalContacts encodes cards as a JSON array of jCards.
+func MarshalContacts(cards []*contact.ContactCard) ([]byte, error) {
+	vs := make([]*vcard.VCard, len(cards))
+	for i, card := range cards {
+		vs[i] = writing.FromContact(card)
+	}
+	return MarshalAll(vs)
+}
+
+// UnmarshalContacts decodes a JSON array of jCards, or a single one.
+func UnmarshalContacts(data []byte) ([]*contact.ContactCard, error) {
+	var raw any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJCard, err)
+	}
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an array", ErrInvalidJCard)
+	}
+	// a single jCard starts with "vcard"
+	if len(list) > 0 {
+		if tag, ok := list[0].(string); ok && tag == vcardTag {
+			list = []any{raw}
+		}
+	}
+
+	var cards []*contact.ContactCard
+	for _, item := range list {
+		v, err := fromJSON(item)
+		if err != nil {
+			return cards, err
+		}
+		card, err := parsing.ToContact(v)
+		if err != nil {
+			return cards, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
+
+// MarshalProperty encodes a single property as a jCard property,
+// ["name", {params}, "type", value...].
+func MarshalProperty(prop vcard.Property) ([]byte, error) {
+	return json.Marshal(propToJSON(prop))
+}
+
+// UnmarshalProperty decodes a single jCard property.
+func UnmarshalProperty(data []byte) (vcard.Property, error) {
+	var raw any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return vcard.Property{}, fmt.Errorf("%w: %v", ErrInvalidJCard, err)
+	}
+	prop, err := propFromJSON(raw)
+	if err != nil {
+		return prop, fmt.Errorf("%w: %v", ErrInvalidJCard, err)
+	}
+	return prop, nil
+}
+
+func toJSON(v *vcard.VCard) []any {
+	props := []any{[]any{"version", map[string]any{}, "text", vcard.VERSION40}}
+	for _, prop := range v.Properties {
+		if prop.Name == vcard.VERSION || prop.Name == vcard.BEGIN || prop.Name == vcard.END {
+			continue
+		}
+		props = append(props, propToJSON(prop))
+	}
+	return []any{vcardTag, props}
+}
+
+// ["name", {params}, "type", value...]
+func propToJSON(prop vcard.Property) []any {
+	prop = writing.DataURI(prop)
+	params := make(map[string]any)
+	if prop.Group != "" {
+		params[groupParam] = prop.Group
+	}
+	valueType := ""
+	for _, p := range prop.Params {
+		name := strings.ToLower(string(p.GetName()))
+		vals := p.GetVal()
+		switch {
+		case name == strings.ToLower(string(vcard.VALUE_PARAM)):
+			if len(vals) > 0 {
+				valueType = strings.ToLower(vals[0])
+			}
+		case len(vals) == 1:
+			params[name] = vals[0]
+		default:
+			params[name] = append([]string(nil), vals...)
+		}
+	}
+	if valueType == "" {
+		valueType = prop.DefaultType()
+	}
+
+	out := []any{strings.ToLower(string(prop.Name)), params}
+	value := string(prop.Value)
+	switch {
+	case vcard.STRUCTURED[prop.Name] && valueType == "text":
+		var comps []any
+		for _, comp := range vcard.SplitUnescaped(value, ';') {
+			comps = append(comps, componentToJSON(prop.Name, comp))
+		}
+		return append(out, valueType, comps)
+
+	case vcard.MULTI_VALUED[prop.Name] && valueType == "text":
+		out = append(out, valueType)
+		for _, v := range prop.Values() {
+			out = append(out, v)
+		}
+		return out
+
+	case vcard.IsDateType(valueType):
+		// jCard uses the type the value actually is and the extended format
+		if d, err := parsing.ParseDateOrTime(value); err == nil {
+			return append(out, dateValueType(d, valueType), jsonDate(d))
+		}
+		return append(out, "text", vcard.Unescape(value))
+
+	case valueType == "text":
+		return append(out, valueType, vcard.Unescape(value))
+	}
+	return append(out, valueType, value)
+}
+
+// N and ADR components can hold several values, they become an array.
+func componentToJSON(name vcard.PropName, comp string) any {
+	if name != vcard.N && name != vcard.ADR {
+		return vcard.Unescape(comp)
+	}
+	vals := vcard.SplitUnescaped(comp, ',')
+	if len(vals) == 1 {
+		return vcard.Unescape(comp)
+	}
+	list := make([]any, len(vals))
+	for i, v := range vals {
+		list[i] = vcard.Unescape(v)
+	}
+	return list
+}
+
+// The extended form, a time without a date has no T: 10:22:00.
+// https://tools.ietf.org/html/rfc7095#section-3.5.2
+func jsonDate(d contact.DateOrTime) string {
+	if !d.HasDate() {
+		return strings.TrimPrefix(d.Extended(), "T")
+	}
+	return d.Extended()
+}
+
+// date-and-or-time is written as the type of the value.
+func dateValueType(d contact.DateOrTime, vt string) string {
+	if vt != "date-and-or-time" {
+		return vt
+	}
+	return d.ValueType()
+}
+
+func fromJSON(raw any) (*vcard.VCard, error) {
+	card, ok := raw.([]any)
+	if !ok || len(card) != 2 {
+		return nil, fmt.Errorf("%w: not a [\"vcard\", [...]] array", ErrInvalidJCard)
+	}
+	if tag, ok := card[0].(string); !ok || tag != vcardTag {
+		return nil, fmt.Errorf("%w: not a [\"vcard\", [...]] array", ErrInvalidJCard)
+	}
+	props, ok := card[1].([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: properties are not an array", ErrInvalidJCard)
+	}
+
+	v := vcard.NewVCard()
+	for i, p := range props {
+		prop, err := propFromJSON(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: property %d: %v", ErrInvalidJCard, i+1, err)
+		}
+		v.AddProperty(prop)
+	}
+	return v, nil
+}
+
+func propFromJSON(raw any) (vcard.Property, error) {
+	var prop vcard.Property
+	list, ok := raw.([]any)
+	if !ok || len(list) < 4 {
+		return prop, errors.New("not a [name, params, type, value] array")
+	}
+	name, ok1 := list[0].(string)
+	params, ok2 := list[1].(map[string]any)
+	valueType, ok3 := list[2].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return prop, errors.New("not a [name, params, type, value] array")
+	}
+	prop.Name = vcard.PropName(strings.ToUpper(name))
+	valueType = strings.ToLower(valueType)
+
+	for _, key := range sortedKeys(params) {
+		vals, err := paramValues(params[key])
+		if err != nil {
+			return prop, fmt.Errorf("%s: %v", key, err)
+		}
+		if key == groupParam {
+			prop.Group = strings.Join(vals, "")
+			continue
+		}
+		prop.Params = append(prop.Params, &vcard.BaseParam{Name: vcard.ParamName(strings.ToUpper(key)), Val: vals})
+	}
+
+	var parts []string
+	for _, val := range list[3:] {
+		s, err := valueFromJSON(prop.Name, valueType, val)
+		if err != nil {
+			return prop, err
+		}
+		parts = append(parts, s)
+	}
+	prop.Value = vcard.PropValue(strings.Join(parts, vcard.COMMA))
+
+	if !prop.ImpliesType(valueType) {
+		prop.Params = append(prop.Params, &vcard.BaseParam{Name: vcard.VALUE_PARAM, Val: []string{valueType}})
+	}
+	return prop, nil
+}
+
+// Turns one jCard value back into the escaped vCard form.
+func valueFromJSON(name vcard.PropName, valueType string, raw any) (string, error) {
+	switch val := raw.(type) {
+	case string:
+		switch {
+		case vcard.IsDateType(valueType):
+			if valueType == "time" && !strings.HasPrefix(val, "T") {
+				val = "T" + val
+			}
+			if d, err := parsing.ParseDateOrTime(val); err == nil {
+				return d.String(), nil
+			}
+			return val, nil
+		case valueType == "text":
+			return vcard.Escape(val), nil
+		}
+		return val, nil
+	case json.Number:
+		return val.String(), nil
+	case bool:
+		return fmt.Sprint(val), nil
+	case []any:
+		// structured, each component can be a list itself
+		comps := make([]string, len(val))
+		for i, c := range val {
+			switch c := c.(type) {
+			case []any:
+				var vals []string
+				for _, v := range c {
+					s, err := valueFromJSON(name, valueType, v)
+					if err != nil {
+						return "", err
+					}
+					vals = append(vals, s)
+				}
+				comps[i] = strings.Join(vals, vcard.COMMA)
+			default:
+				s, err := valueFromJSON(name, valueType, c)
+				if err != nil {
+					return "", err
+				}
+				comps[i] = s
+			}
+		}
+		return strings.Join(comps, vcard.SEMICOLON), nil
+	}
+	return "", fmt.Errorf("unexpected value %v", raw)
+}
+
+// A param value is a string or an array of strings.
+func paramValues(raw any) ([]string, error) {
+	switch val := raw.(type) {
+	case string:
+		return []string{val}, nil
+	case []any:
+		vals := make([]string, len(val))
+		for i, v := range val {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("parameter values must be strings")
+			}
+			vals[i] = s
+		}
+		return vals, nil
+	}
+	return nil, errors.New("parameter values must be strings")
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,200 @@
+package jcard
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/parsing"
+	"ContactCleaner/vcard"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const input = "BEGIN:VCARD\r\n" +
+	"VERSION:3.0\r\n" +
+	"FN:Dr. Taco Cat\r\n" +
+	"N:Cat;Taco;Al,Pastor;Dr.;\r\n" +
+	"ORG:Tacos\\, Inc.;Salsa\r\n" +
+	"CATEGORIES:friends,food\\, mostly\r\n" +
+	"item1.EMAIL;TYPE=work:taco@example.com\r\n" +
+	"item1.X-ABLabel:Tacos\r\n" +
+	"TEL;TYPE=work,voice:tel:+1-111-555-1212\r\n" +
+	"BDAY:--0415\r\n" +
+	"ANNIVERSARY;VALUE=text:circa 2010\r\n" +
+	"PHOTO;ENCODING=b;TYPE=PNG:iVBORw0KGgo=\r\n" +
+	"NOTE:Likes tacos.\\nAnd burritos.\r\n" +
+	"X-CUSTOM;X-PARAM=a,b:custom\r\n" +
+	"END:VCARD\r\n"
+
+func TestMarshal(t *testing.T) {
+	v, err := parsing.NewParser(strings.NewReader(input)).NextVCard()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`["version",{},"text","4.0"]`,
+		`["fn",{},"text","Dr. Taco Cat"]`,
+		`["n",{},"text",["Cat","Taco",["Al","Pastor"],"Dr.",""]]`,
+		`["org",{},"text",["Tacos, Inc.","Salsa"]]`,
+		`["categories",{},"text","friends","food, mostly"]`,
+		`["email",{"group":"item1","type":"work"},"text","taco@example.com"]`,
+		`["x-ablabel",{"group":"item1"},"unknown","Tacos"]`,
+		`["tel",{"type":["work","voice"]},"uri","tel:+1-111-555-1212"]`,
+		`["bday",{},"date","--04-15"]`,
+		`["anniversary",{},"text","circa 2010"]`,
+		`["photo",{},"uri","data:image/png;base64,iVBORw0KGgo="]`,
+		`["note",{},"text","Likes tacos.\nAnd burritos."]`,
+		`["x-custom",{"x-param":["a","b"]},"unknown","custom"]`,
+	}
+	out := string(b)
+	if !strings.HasPrefix(out, `["vcard",[`) {
+		t.Errorf("Expected a jCard, got %s", out)
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("Expected %s in\n%s", e, out)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	data := `["vcard", [
+		["version", {}, "text", "4.0"],
+		["fn", {}, "text", "Dr. Taco Cat"],
+		["n", {}, "text", ["Cat", "Taco", ["Al", "Pastor"], "Dr.", ""]],
+		["categories", {}, "text", "friends", "food, mostly"],
+		["email", {"group": "item1", "type": "work"}, "text", "taco@example.com"],
+		["x-ablabel", {"group": "item1"}, "unknown", "Tacos"],
+		["tel", {"type": ["work", "voice"], "pref": "1"}, "uri", "tel:+1-111-555-1212"],
+		["bday", {}, "date-time", "1985-04-15T10:30:00Z"],
+		["anniversary", {}, "text", "circa 2010"],
+		["note", {}, "text", "Likes tacos.\nAnd burritos; with salsa."],
+		["x-count", {}, "integer", 42]
+	]]`
+	v, err := Unmarshal([]byte(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		"VERSION:4.0",
+		"FN:Dr. Taco Cat",
+		"N:Cat;Taco;Al,Pastor;Dr.;",
+		`CATEGORIES:friends,food\, mostly`,
+		"item1.EMAIL;TYPE=work:taco@example.com",
+		"item1.X-ABLABEL:Tacos",
+		"TEL;PREF=1;TYPE=work,voice:tel:+1-111-555-1212",
+		"BDAY:19850415T103000Z",
+		"ANNIVERSARY;VALUE=text:circa 2010",
+		`NOTE:Likes tacos.\nAnd burritos\; with salsa.`,
+		"X-COUNT;VALUE=integer:42",
+	}
+	if len(v.Properties) != len(expected) {
+		t.Fatalf("Expected %d properties, got %d", len(expected), len(v.Properties))
+	}
+	for i, prop := range v.Properties {
+		if got := line(prop); got != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], got)
+		}
+	}
+}
+
+// a simple line for comparing, without escaping the params
+func line(prop vcard.Property) string {
+	var sb strings.Builder
+	if prop.Group != "" {
+		sb.WriteString(prop.Group + vcard.DOT)
+	}
+	sb.WriteString(string(prop.Name))
+	for _, p := range prop.Params {
+		sb.WriteString(vcard.SEMICOLON + string(p.GetName()) + vcard.EQUAL + strings.Join(p.GetVal(), vcard.COMMA))
+	}
+	return sb.String() + vcard.COLON + string(prop.Value)
+}
+
+// A time is hh:mm:ss in jCard, without the T a vCard has.
+func TestTime(t *testing.T) {
+	input := "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Taco Cat\r\nBDAY:T102200\r\nANNIVERSARY:T1022-0500\r\nEND:VCARD\r\n"
+	v, err := parsing.NewParser(strings.NewReader(input)).NextVCard()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, e := range []string{`["bday",{},"time","10:22:00"]`, `["anniversary",{},"time","10:22-05:00"]`} {
+		if !strings.Contains(string(b), e) {
+			t.Errorf("Expected %s in\n%s", e, b)
+		}
+	}
+
+	v, err = Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, e := range []string{"BDAY:T102200", "ANNIVERSARY:T1022-0500"} {
+		if got := line(v.Properties[i+2]); got != e {
+			t.Errorf("Expected %q, got %q", e, got)
+		}
+	}
+}
+
+func TestContactsRoundTrip(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{
+			Version:    vcard.VERSION40,
+			FullName:   "Taco Cat",
+			FirstName:  "Taco",
+			LastName:   "Cat",
+			Birthday:   &contact.DateOrTime{Month: 4, Day: 15},
+			Revision:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Categories: []string{"friends", "food, mostly"},
+			Telephones: []contact.Telephone{{Type: []string{"cell"}, Number: "+1 111 555 1212", Label: "Boat", Group: "item1"}},
+			Emails:     []contact.EmailAddr{{Type: []string{"work"}, Address: "taco@example.com"}},
+			Addresses:  []contact.Address{{Type: []string{"home"}, Street: "123 Main Street", City: "Any Town", Country: "U.S.A."}},
+			Notes:      "Likes tacos.\nAnd burritos; with salsa.",
+		},
+		{Version: vcard.VERSION40, FullName: "Burrito Cat"},
+	}
+	b, err := MarshalContacts(cards)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !json.Valid(b) {
+		t.Fatalf("Invalid JSON %s", b)
+	}
+	out, err := UnmarshalContacts(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cards, out) {
+		t.Errorf("Round trip mismatch\nexpected %+v\ngot      %+v\n%s", cards, out, b)
+	}
+
+	// a single jCard works too
+	single, err := UnmarshalContacts(b[1 : strings.Index(string(b), `],["vcard"`)+1])
+	if err != nil || len(single) != 1 || single[0].FullName != "Taco Cat" {
+		t.Errorf("Expected a single card, got %v %v", single, err)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"vcard": []}`,
+		`["vcard"]`,
+		`["vcard", [["fn", {}, "text"]]]`,
+		`["vcard", [["fn", {"type": 1}, "text", "Taco"]]]`,
+		`not json`,
+	} {
+		if _, err := Unmarshal([]byte(data)); !errors.Is(err, ErrInvalidJCard) {
+			t.Errorf("%s: expected ErrInvalidJCard, got %v", data, err)
+		}
+	}
+}
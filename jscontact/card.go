@@ -0,0 +1,335 @@
+// Package jscontact converts contacts to and from JSContact, the JSON
+// contact format of RFC 9553, following the vCard mapping of RFC 9555.
+//
+//	{
+//	  "@type": "Card",
+//	  "version": "1.0",
+//	  "uid": "urn:uuid:...",
+//	  "name": {"components": [{"kind": "given", "value": "Taco"}, ...]},
+//	  "emails": {"e1": {"address": "taco@example.com", "contexts": {"work": true}}}
+//	}
+//
+// Nothing is lost either way. vCard properties JSContact has no place
+// for go into vCardProps as jCard, JSContact properties vCard has no
+// place for become JSPROP properties.
+//
+// https://www.rfc-editor.org/rfc/rfc9553
+// https://www.rfc-editor.org/rfc/rfc9555
+package jscontact
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidJSContact = errors.New("invalid JSContact")
+
+const (
+	cardType = "Card"
+	version  = "1.0"
+)
+
+// Card is a JSContact Card. Only the properties that have a vCard
+// mapping are fields, the rest are kept in Unmapped. That includes the
+// optional @type of the objects in a Card, vCard has nowhere for it.
+type Card struct {
+	Type           string                   `json:"@type"`
+	Version        string                   `json:"version"`
+	UID            string                   `json:"uid"`
+	Kind           string                   `json:"kind,omitempty"`
+	ProdID         string                   `json:"prodId,omitempty"`
+	Created        string                   `json:"created,omitempty"`
+	Updated        string                   `json:"updated,omitempty"`
+	Language       string                   `json:"language,omitempty"`
+	Name           *Name                    `json:"name,omitempty"`
+	Nicknames      map[string]Nickname      `json:"nicknames,omitempty"`
+	Organizations  map[string]Organization  `json:"organizations,omitempty"`
+	Titles         map[string]Title         `json:"titles,omitempty"`
+	Emails         map[string]EmailAddress  `json:"emails,omitempty"`
+	Phones         map[string]Phone         `json:"phones,omitempty"`
+	Addresses      map[string]Address       `json:"addresses,omitempty"`
+	OnlineServices map[string]OnlineService `json:"onlineServices,omitempty"`
+	Links          map[string]Link          `json:"links,omitempty"`
+	Media          map[string]Media         `json:"media,omitempty"`
+	Anniversaries  map[string]Anniversary   `json:"anniversaries,omitempty"`
+	RelatedTo      map[string]Relation      `json:"relatedTo,omitempty"`
+	Keywords       map[string]bool          `json:"keywords,omitempty"`
+	Notes          map[string]Note          `json:"notes,omitempty"`
+
+	// vCard properties without a JSContact property, each one a jCard
+	// property array.
+	VCardProps []json.RawMessage `json:"vCardProps,omitempty"`
+
+	// Everything else, keyed by the JSON pointer to it from the Card,
+	// e.g. example.com:foo or addresses/a1/coordinates.
+	Unmapped map[string]json.RawMessage `json:"-"`
+}
+
+// The vCard parameters an object has no property for, jCard style:
+// a string or an array of strings. A vCard group is the "group" param.
+type Params map[string]any
+
+type Name struct {
+	Components []NameComponent `json:"components,omitempty"`
+	Full       string          `json:"full,omitempty"`
+	Params     Params          `json:"vCardParams,omitempty"`
+}
+
+// Kind is one of title, given, given2, surname, surname2, credential
+// or generation.
+type NameComponent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Nickname struct {
+	Name   string `json:"name"`
+	Params Params `json:"vCardParams,omitempty"`
+}
+
+type Organization struct {
+	Name   string    `json:"name,omitempty"`
+	Units  []OrgUnit `json:"units,omitempty"`
+	Params Params    `json:"vCardParams,omitempty"`
+}
+
+type OrgUnit struct {
+	Name string `json:"name"`
+}
+
+// Kind is title or role.
+type Title struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind,omitempty"`
+	Params Params `json:"vCardParams,omitempty"`
+}
+
+type EmailAddress struct {
+	Address  string          `json:"address"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     int             `json:"pref,omitempty"`
+	Label    string          `json:"label,omitempty"`
+	Params   Params          `json:"vCardParams,omitempty"`
+}
+
+type Phone struct {
+	Number   string          `json:"number"`
+	Features map[string]bool `json:"features,omitempty"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     int             `json:"pref,omitempty"`
+	Label    string          `json:"label,omitempty"`
+	Params   Params          `json:"vCardParams,omitempty"`
+}
+
+type Address struct {
+	Components  []AddressComponent `json:"components,omitempty"`
+	Full        string             `json:"full,omitempty"`
+	CountryCode string             `json:"countryCode,omitempty"`
+	Contexts    map[string]bool    `json:"contexts,omitempty"`
+	Pref        int                `json:"pref,omitempty"`
+	Params      Params             `json:"vCardParams,omitempty"`
+}
+
+// Kind is one of postOfficeBox, apartment, name (the street),
+// locality, region, postcode or country here.
+type AddressComponent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// An IMPP (VCardName "impp") or SOCIALPROFILE property.
+type OnlineService struct {
+	Service   string          `json:"service,omitempty"`
+	URI       string          `json:"uri,omitempty"`
+	User      string          `json:"user,omitempty"`
+	VCardName string          `json:"vCardName,omitempty"`
+	Contexts  map[string]bool `json:"contexts,omitempty"`
+	Pref      int             `json:"pref,omitempty"`
+	Label     string          `json:"label,omitempty"`
+	Params    Params          `json:"vCardParams,omitempty"`
+}
+
+type Link struct {
+	URI       string          `json:"uri"`
+	MediaType string          `json:"mediaType,omitempty"`
+	Contexts  map[string]bool `json:"contexts,omitempty"`
+	Pref      int             `json:"pref,omitempty"`
+	Label     string          `json:"label,omitempty"`
+	Params    Params          `json:"vCardParams,omitempty"`
+}
+
+// Kind is photo, logo or sound.
+type Media struct {
+	Kind      string          `json:"kind"`
+	URI       string          `json:"uri"`
+	MediaType string          `json:"mediaType,omitempty"`
+	Contexts  map[string]bool `json:"contexts,omitempty"`
+	Pref      int             `json:"pref,omitempty"`
+	Label     string          `json:"label,omitempty"`
+	Params    Params          `json:"vCardParams,omitempty"`
+}
+
+// Kind is birth, death or wedding.
+type Anniversary struct {
+	Kind   string `json:"kind"`
+	Date   Date   `json:"date"`
+	Params Params `json:"vCardParams,omitempty"`
+}
+
+// A PartialDate, or a Timestamp when UTC is set.
+type Date struct {
+	Type  string `json:"@type,omitempty"`
+	Year  int    `json:"year,omitempty"`
+	Month int    `json:"month,omitempty"`
+	Day   int    `json:"day,omitempty"`
+	UTC   string `json:"utc,omitempty"`
+}
+
+type Relation struct {
+	Relation map[string]bool `json:"relation,omitempty"`
+	Params   Params          `json:"vCardParams,omitempty"`
+}
+
+type Note struct {
+	Note   string `json:"note"`
+	Params Params `json:"vCardParams,omitempty"`
+}
+
+// NewCard returns an empty Card.
+func NewCard(uid string) *Card {
+	return &Card{Type: cardType, Version: version, UID: uid}
+}
+
+// MarshalJSON writes the Unmapped properties back where they came from.
+func (c Card) MarshalJSON() ([]byte, error) {
+	type plain Card
+	b, err := json.Marshal(plain(c))
+	if err != nil || len(c.Unmapped) == 0 {
+		return b, err
+	}
+	var tree any
+	if err := json.Unmarshal(b, &tree); err != nil {
+		return nil, err
+	}
+	for _, ptr := range sortedKeys(c.Unmapped) {
+		var val any
+		if err := json.Unmarshal(c.Unmapped[ptr], &val); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidJSContact, ptr, err)
+		}
+		if tree, err = setPointer(tree, splitPointer(ptr), val); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidJSContact, ptr, err)
+		}
+	}
+	return json.Marshal(tree)
+}
+
+// UnmarshalJSON keeps whatever doesn't fit the fields in Unmapped.
+func (c *Card) UnmarshalJSON(data []byte) error {
+	type plain Card
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJSContact, err)
+	}
+	if p.Type != cardType {
+		return fmt.Errorf("%w: @type is %q, not Card", ErrInvalidJSContact, p.Type)
+	}
+	*c = Card(p)
+
+	var raw, known any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJSContact, err)
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &known); err != nil {
+		return err
+	}
+	c.Unmapped = nil
+	unmapped(raw, known, nil, func(ptr string, val any) {
+		b, _ := json.Marshal(val)
+		if c.Unmapped == nil {
+			c.Unmapped = make(map[string]json.RawMessage)
+		}
+		c.Unmapped[ptr] = b
+	})
+	return nil
+}
+
+// Calls found for each part of raw the fields of the Card don't hold,
+// as known is the Card encoded again.
+func unmapped(raw, known any, path []string, found func(string, any)) {
+	switch r := raw.(type) {
+	case map[string]any:
+		k, ok := known.(map[string]any)
+		if !ok {
+			break
+		}
+		for key, val := range r {
+			unmapped(val, k[key], append(path, key), found)
+		}
+		return
+	case []any:
+		k, ok := known.([]any)
+		if !ok || len(k) != len(r) {
+			break
+		}
+		for i, val := range r {
+			unmapped(val, k[i], append(path, strconv.Itoa(i)), found)
+		}
+		return
+	}
+	if !reflect.DeepEqual(raw, known) {
+		found(joinPointer(path), raw)
+	}
+}
+
+// JSPTR values are JSON pointers without the leading slash,
+// https://www.rfc-editor.org/rfc/rfc6901
+func joinPointer(path []string) string {
+	escaped := make([]string, len(path))
+	for i, p := range path {
+		escaped[i] = strings.NewReplacer("~", "~0", "/", "~1").Replace(p)
+	}
+	return strings.Join(escaped, "/")
+}
+
+func splitPointer(ptr string) []string {
+	path := strings.Split(strings.TrimPrefix(ptr, "/"), "/")
+	for i, p := range path {
+		path[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(p)
+	}
+	return path
+}
+
+// Sets val at path in tree, making the objects on the way.
+func setPointer(tree any, path []string, val any) (any, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+	switch t := tree.(type) {
+	case nil:
+		child, err := setPointer(nil, path[1:], val)
+		return map[string]any{path[0]: child}, err
+	case map[string]any:
+		child, err := setPointer(t[path[0]], path[1:], val)
+		t[path[0]] = child
+		return t, err
+	case []any:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i > len(t) {
+			return t, fmt.Errorf("no array element %s", path[0])
+		}
+		if i == len(t) {
+			t = append(t, nil)
+		}
+		t[i], err = setPointer(t[i], path[1:], val)
+		return t, err
+	}
+	return tree, fmt.Errorf("%s is not an object", path[0])
+}
@@ -0,0 +1,952 @@
+package jscontact
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/jcard"
+	"ContactCleaner/parsing"
+	"ContactCleaner/vcard"
+	"ContactCleaner/writing"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const groupParam = "group"
+
+// The N components in order, RFC 9554 adds surname2 and generation.
+var nameKinds = []string{"surname", "given", "given2", "title", "credential", "surname2", "generation"}
+
+// The ADR components in order, the extended address is an apartment.
+var addressKinds = []string{"postOfficeBox", "apartment", "name", "locality", "region", "postcode", "country"}
+
+// TEL types and the phone features they are.
+var phoneFeatures = []struct{ vcard, feature string }{
+	{"voice", "voice"},
+	{"cell", "mobile"},
+	{"text", "text"},
+	{"video", "video"},
+	{"fax", "fax"},
+	{"pager", "pager"},
+	{"textphone", "textphone"},
+	{"main-number", "main-number"},
+}
+
+var anniversaryKinds = map[vcard.PropName]string{
+	vcard.BDAY:        "birth",
+	vcard.ANNIVERSARY: "wedding",
+	vcard.DEATHDATE:   "death",
+}
+
+// FromContact converts card to a JSContact Card.
+func FromContact(card *contact.ContactCard) *Card {
+	return FromVCard(writing.FromContact(card))
+}
+
+// ToContact converts c to a contact, the way a vCard of it would parse.
+func ToContact(c *Card) (*contact.ContactCard, error) {
+	v, err := ToVCard(c)
+	if err != nil {
+		return nil, err
+	}
+	return parsing.ToContact(v)
+}
+
+// Marshal encodes c as JSON.
+func Marshal(c *Card) ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// MarshalAll encodes cards as a JSON array of Cards.
+func MarshalAll(cards []*vcard.VCard) ([]byte, error) {
+	list := make([]*Card, len(cards))
+	for i, v := range cards {
+		list[i] = FromVCard(v)
+	}
+	return json.Marshal(list)
+}
+
+// Unmarshal decodes a JSContact Card.
+func Unmarshal(data []byte) (*Card, error) {
+	c := &Card{}
+	if err := json.Unmarshal(data, c); err != nil {
+		if !errors.Is(err, ErrInvalidJSContact) {
+			err = fmt.Errorf("%w: %v", ErrInvalidJSContact, err)
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// Keeps track of a vCard being turned into a Card.
+type fromVCard struct {
+	c      *Card
+	labels map[string]string // X-ABLabel of each lower cased group
+	used   map[string]bool   // groups whose label went into a label property
+}
+
+// FromVCard converts v to a Card following RFC 9555. Properties with
+// no JSContact property go into VCardProps, JSPROP ones into Unmapped.
+// A card without a UID gets one made from its name, emails and phone
+// numbers, the same every time the card is converted.
+func FromVCard(v *vcard.VCard) *Card {
+	b := &fromVCard{c: NewCard(""), labels: make(map[string]string), used: make(map[string]bool)}
+	for _, prop := range v.Properties {
+		if prop.Name == vcard.X_ABLABEL && prop.Group != "" {
+			b.labels[strings.ToLower(prop.Group)] = vcard.DecodeAppleLabel(prop.Text())
+		}
+	}
+
+	var rest []vcard.Property
+	for _, prop := range v.Properties {
+		if !b.add(prop) {
+			rest = append(rest, prop)
+		}
+	}
+	if b.c.UID == "" {
+		// a Card has to have one
+		b.c.UID = nameUID(v)
+	}
+	for _, prop := range rest {
+		if prop.Name == vcard.X_ABLABEL && b.used[strings.ToLower(prop.Group)] {
+			continue
+		}
+		if raw, err := jcard.MarshalProperty(prop); err == nil {
+			b.c.VCardProps = append(b.c.VCardProps, raw)
+		}
+	}
+	return b.c
+}
+
+// Returns false if prop has no JSContact property.
+func (b *fromVCard) add(prop vcard.Property) bool {
+	c := b.c
+	switch prop.Name {
+	case vcard.VERSION, vcard.BEGIN, vcard.END:
+		// a Card has its own version
+		return true
+
+	case vcard.UID:
+		return single(&c.UID, prop, string(prop.Value))
+	case vcard.KIND:
+		return single(&c.Kind, prop, strings.ToLower(prop.Text()))
+	case vcard.PRODID:
+		return single(&c.ProdID, prop, prop.Text())
+	case vcard.LANGUAGE:
+		return single(&c.Language, prop, prop.Text())
+	case vcard.CREATED, vcard.REV:
+		field := &c.Updated
+		if prop.Name == vcard.CREATED {
+			field = &c.Created
+		}
+		d, err := parsing.ParseDateOrTime(string(prop.Value))
+		t, ok := d.Time()
+		if err != nil || !ok || !d.HasSecond || d.Zone != "Z" {
+			return false
+		}
+		return single(field, prop, t.UTC().Format(time.RFC3339))
+
+	case vcard.FN:
+		full := ""
+		if c.Name != nil {
+			full = c.Name.Full
+		}
+		if !single(&full, prop, prop.Text()) {
+			return false
+		}
+		b.name().Full = full
+		return true
+
+	case vcard.N:
+		comps := vcard.SplitUnescaped(string(prop.Value), ';')
+		if c.Name != nil && len(c.Name.Components) > 0 || len(comps) > len(nameKinds) || prop.HasParam(vcard.ALTID_PARAM) {
+			return false
+		}
+		name := b.name()
+		for i, comp := range comps {
+			for _, val := range vcard.SplitUnescaped(comp, ',') {
+				if val != "" {
+					name.Components = append(name.Components, NameComponent{Kind: nameKinds[i], Value: vcard.Unescape(val)})
+				}
+			}
+		}
+		name.Params = params(prop)
+		return true
+
+	case vcard.NICKNAME:
+		for _, name := range prop.Values() {
+			setID(&c.Nicknames, b.id(prop, "k", len(c.Nicknames)), Nickname{Name: name, Params: params(prop)})
+		}
+		return true
+
+	case vcard.ORG:
+		comps := prop.Components()
+		org := Organization{Name: comps[0], Params: params(prop)}
+		for _, unit := range comps[1:] {
+			org.Units = append(org.Units, OrgUnit{Name: unit})
+		}
+		setID(&c.Organizations, b.id(prop, "o", len(c.Organizations)), org)
+		return true
+
+	case vcard.TITLE, vcard.ROLE:
+		title := Title{Name: prop.Text(), Kind: strings.ToLower(string(prop.Name)), Params: params(prop)}
+		setID(&c.Titles, b.id(prop, "t", len(c.Titles)), title)
+		return true
+
+	case vcard.EMAIL:
+		contexts, _, types := splitTypes(prop, false)
+		email := EmailAddress{Address: prop.Text(), Contexts: contexts, Label: b.label(prop)}
+		email.Pref, email.Params = pref(prop, types)
+		setID(&c.Emails, b.id(prop, "e", len(c.Emails)), email)
+		return true
+
+	case vcard.TEL:
+		contexts, features, types := splitTypes(prop, true)
+		tel := Phone{Number: string(prop.Value), Contexts: contexts, Features: features, Label: b.label(prop)}
+		tel.Pref, tel.Params = pref(prop, types)
+		setID(&c.Phones, b.id(prop, "p", len(c.Phones)), tel)
+		return true
+
+	case vcard.ADR:
+		contexts, _, types := splitTypes(prop, false)
+		comps := vcard.SplitUnescaped(string(prop.Value), ';')
+		if len(comps) > len(addressKinds) {
+			return false
+		}
+		adr := Address{Contexts: contexts}
+		for i, comp := range comps {
+			for _, val := range vcard.SplitUnescaped(comp, ',') {
+				if val != "" {
+					adr.Components = append(adr.Components, AddressComponent{Kind: addressKinds[i], Value: vcard.Unescape(val)})
+				}
+			}
+		}
+		adr.Full = strings.Join(prop.GetParam(vcard.LABEL_PARAM), ",")
+		adr.CountryCode = strings.Join(prop.GetParam(vcard.CC_PARAM), ",")
+		adr.Pref, adr.Params = pref(prop, types, vcard.LABEL_PARAM, vcard.CC_PARAM)
+		setID(&c.Addresses, b.id(prop, "a", len(c.Addresses)), adr)
+		return true
+
+	case vcard.IMPP, vcard.SOCIALPROFILE:
+		contexts, _, types := splitTypes(prop, false)
+		service := OnlineService{Contexts: contexts, Label: b.label(prop)}
+		if prop.Name == vcard.IMPP {
+			service.VCardName = "impp"
+		}
+		service.Service = strings.Join(prop.GetParam(vcard.SERVICE_TYPE_PARAM), ",")
+		if prop.ValueType() == "uri" {
+			service.URI = string(prop.Value)
+		} else {
+			service.User = prop.Text()
+		}
+		service.Pref, service.Params = pref(prop, types, vcard.SERVICE_TYPE_PARAM)
+		setID(&c.OnlineServices, b.id(prop, "s", len(c.OnlineServices)), service)
+		return true
+
+	case vcard.URL:
+		contexts, _, types := splitTypes(prop, false)
+		link := Link{URI: string(prop.Value), Contexts: contexts, Label: b.label(prop)}
+		link.MediaType = strings.Join(prop.GetParam(vcard.MEDIATYPE_PARAM), ",")
+		link.Pref, link.Params = pref(prop, types, vcard.MEDIATYPE_PARAM)
+		setID(&c.Links, b.id(prop, "l", len(c.Links)), link)
+		return true
+
+	case vcard.PHOTO, vcard.LOGO, vcard.SOUND:
+		if prop.ValueType() != "uri" {
+			return false
+		}
+		contexts, _, types := splitTypes(prop, false)
+		media := Media{Kind: strings.ToLower(string(prop.Name)), URI: string(prop.Value), Contexts: contexts}
+		media.MediaType = strings.Join(prop.GetParam(vcard.MEDIATYPE_PARAM), ",")
+		media.Pref, media.Params = pref(prop, types, vcard.MEDIATYPE_PARAM)
+		setID(&c.Media, b.id(prop, "m", len(c.Media)), media)
+		return true
+
+	case vcard.BDAY, vcard.ANNIVERSARY, vcard.DEATHDATE:
+		date, ok := toDate(prop)
+		if !ok {
+			return false
+		}
+		anniversary := Anniversary{Kind: anniversaryKinds[prop.Name], Date: date, Params: params(prop)}
+		setID(&c.Anniversaries, b.id(prop, "d", len(c.Anniversaries)), anniversary)
+		return true
+
+	case vcard.RELATED:
+		key := string(prop.Value)
+		if prop.ValueType() == "text" {
+			key = prop.Text()
+		}
+		if _, ok := c.RelatedTo[key]; ok {
+			return false
+		}
+		relation := Relation{Params: params(prop, vcard.TYPE_PARAM)}
+		for _, t := range prop.Types() {
+			if relation.Relation == nil {
+				relation.Relation = make(map[string]bool)
+			}
+			relation.Relation[t] = true
+		}
+		setID(&c.RelatedTo, key, relation)
+		return true
+
+	case vcard.CATEGORIES:
+		if len(prop.Params) > 0 || prop.Group != "" {
+			return false
+		}
+		for _, keyword := range prop.Values() {
+			setID(&c.Keywords, keyword, true)
+		}
+		return true
+
+	case vcard.NOTE:
+		setID(&c.Notes, b.id(prop, "n", len(c.Notes)), Note{Note: prop.Text(), Params: params(prop)})
+		return true
+
+	case vcard.JSPROP:
+		ptr := prop.GetParam(vcard.JSPTR_PARAM)
+		value := prop.Text()
+		if len(ptr) != 1 || !json.Valid([]byte(value)) {
+			return false
+		}
+		if c.Unmapped == nil {
+			c.Unmapped = make(map[string]json.RawMessage)
+		}
+		c.Unmapped[ptr[0]] = json.RawMessage(value)
+		return true
+	}
+	return false
+}
+
+func (b *fromVCard) name() *Name {
+	if b.c.Name == nil {
+		b.c.Name = &Name{}
+	}
+	return b.c.Name
+}
+
+// Sets a single valued Card property, a second one or one with
+// parameters is kept as a vCard property.
+func single(field *string, prop vcard.Property, value string) bool {
+	if *field != "" || len(prop.Params) > 0 || prop.Group != "" {
+		return false
+	}
+	*field = value
+	return true
+}
+
+// The Apple label of the property's group.
+func (b *fromVCard) label(prop vcard.Property) string {
+	group := strings.ToLower(prop.Group)
+	label := b.labels[group]
+	if label != "" {
+		b.used[group] = true
+	}
+	return label
+}
+
+// The PROP-ID of prop, or else prefix and its number, e1, e2, ...
+func (b *fromVCard) id(prop vcard.Property, prefix string, n int) string {
+	if id := prop.GetParam(vcard.PROP_ID_PARAM); len(id) == 1 && id[0] != "" {
+		return id[0]
+	}
+	return prefix + strconv.Itoa(n+1)
+}
+
+// Adds v to m, an id that is taken already gets a -1 on the end.
+func setID[V any](m *map[string]V, id string, v V) {
+	if *m == nil {
+		*m = make(map[string]V)
+	}
+	for {
+		if _, taken := (*m)[id]; !taken {
+			break
+		}
+		id += "-1"
+	}
+	(*m)[id] = v
+}
+
+// Splits the TYPE values into contexts (work, and private for home),
+// phone features and the rest.
+func splitTypes(prop vcard.Property, features bool) (map[string]bool, map[string]bool, []string) {
+	var contexts, feats map[string]bool
+	var rest []string
+	for _, t := range prop.Types() {
+		switch {
+		case t == "work" || t == "home":
+			if contexts == nil {
+				contexts = make(map[string]bool)
+			}
+			if t == "home" {
+				t = "private"
+			}
+			contexts[t] = true
+			continue
+		case features:
+			if f := feature(t); f != "" {
+				if feats == nil {
+					feats = make(map[string]bool)
+				}
+				feats[f] = true
+				continue
+			}
+		}
+		rest = append(rest, t)
+	}
+	return contexts, feats, rest
+}
+
+func feature(t string) string {
+	for _, f := range phoneFeatures {
+		if f.vcard == t {
+			return f.feature
+		}
+	}
+	return ""
+}
+
+// The PREF of prop and its other params, types are the TYPE values
+// that weren't mapped.
+func pref(prop vcard.Property, types []string, mapped ...vcard.ParamName) (int, Params) {
+	p := params(prop, append(mapped, vcard.TYPE_PARAM, vcard.PREF_PARAM)...)
+	if len(types) > 0 {
+		if p == nil {
+			p = make(Params)
+		}
+		p[strings.ToLower(string(vcard.TYPE_PARAM))] = paramValue(types)
+	}
+	vals := prop.GetParam(vcard.PREF_PARAM)
+	if len(vals) == 0 {
+		return 0, p
+	}
+	n, err := strconv.Atoi(vals[0])
+	if err != nil || len(vals) > 1 || n < 1 || n > 100 {
+		if p == nil {
+			p = make(Params)
+		}
+		p[strings.ToLower(string(vcard.PREF_PARAM))] = paramValue(vals)
+		return 0, p
+	}
+	return n, p
+}
+
+// The params of prop that have no JSContact property, jCard style.
+// VALUE and PROP-ID are always mapped.
+func params(prop vcard.Property, mapped ...vcard.ParamName) Params {
+	var p Params
+	if prop.Group != "" {
+		p = Params{groupParam: prop.Group}
+	}
+	for _, param := range prop.Params {
+		name := vcard.ParamName(strings.ToUpper(string(param.GetName())))
+		if name == vcard.VALUE_PARAM || name == vcard.PROP_ID_PARAM || slices.Contains(mapped, name) {
+			continue
+		}
+		if p == nil {
+			p = make(Params)
+		}
+		key := strings.ToLower(string(name))
+		vals := param.GetVal()
+		if prev, ok := p[key]; ok {
+			vals = append(paramStrings(prev), vals...)
+		}
+		p[key] = paramValue(vals)
+	}
+	return p
+}
+
+func paramValue(vals []string) any {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	return append([]string(nil), vals...)
+}
+
+// A param value is a string or a list of them, []any when it came
+// from JSON.
+func paramStrings(val any) []string {
+	switch val := val.(type) {
+	case string:
+		return []string{val}
+	case []string:
+		return val
+	case []any:
+		var vals []string
+		for _, v := range val {
+			if s, ok := v.(string); ok {
+				vals = append(vals, s)
+			}
+		}
+		return vals
+	}
+	return nil
+}
+
+// A date is a PartialDate, a date and time in UTC a Timestamp.
+// Anything else, like times of day or text, has no JSContact form.
+func toDate(prop vcard.Property) (Date, bool) {
+	if prop.ValueType() == "text" {
+		return Date{}, false
+	}
+	d, err := parsing.ParseDateOrTime(string(prop.Value))
+	if err != nil {
+		return Date{}, false
+	}
+	if !d.HasTime() && d.Zone == "" {
+		return Date{Type: "PartialDate", Year: d.Year, Month: d.Month, Day: d.Day}, true
+	}
+	t, ok := d.Time()
+	if !ok || !d.HasHour || !d.HasMinute || !d.HasSecond || d.Zone != "Z" {
+		return Date{}, false
+	}
+	return Date{Type: "Timestamp", UTC: t.UTC().Format(time.RFC3339)}, true
+}
+
+// Keeps track of a Card being turned into a vCard.
+type toVCard struct {
+	v      *vcard.VCard
+	groups map[string]bool
+	next   int
+}
+
+// ToVCard converts c to a vCard 4.0 following RFC 9555. The Unmapped
+// properties become JSPROP properties, so FromVCard gets them back.
+func ToVCard(c *Card) (*vcard.VCard, error) {
+	b := &toVCard{v: vcard.NewVCard(), groups: make(map[string]bool)}
+
+	// the vCardProps first, to know the groups that are taken
+	var extra []vcard.Property
+	for _, raw := range c.VCardProps {
+		prop, err := jcard.UnmarshalProperty(raw)
+		if err != nil {
+			return nil, err
+		}
+		b.groups[strings.ToLower(prop.Group)] = true
+		extra = append(extra, prop)
+	}
+	c.eachParams(func(p Params) {
+		for _, g := range paramStrings(p[groupParam]) {
+			b.groups[strings.ToLower(g)] = true
+		}
+	})
+
+	b.add(vcard.Property{Name: vcard.VERSION, Value: vcard.VERSION40}, nil)
+	b.text(vcard.UID, c.UID, false)
+	b.text(vcard.KIND, c.Kind, true)
+	b.text(vcard.PRODID, c.ProdID, true)
+	b.text(vcard.LANGUAGE, c.Language, true)
+	b.name(c)
+
+	for i, id := range sortedKeys(c.Nicknames) {
+		b.add(vcard.Property{Name: vcard.NICKNAME, Value: vcard.PropValue(vcard.Escape(c.Nicknames[id].Name))}, c.Nicknames[id].Params, propID(id, "k", i))
+	}
+	for i, id := range sortedKeys(c.Organizations) {
+		org := c.Organizations[id]
+		comps := []string{org.Name}
+		for _, unit := range org.Units {
+			comps = append(comps, unit.Name)
+		}
+		b.add(vcard.Property{Name: vcard.ORG, Value: vcard.PropValue(vcard.JoinComponents(comps...))}, org.Params, propID(id, "o", i))
+	}
+	for i, id := range sortedKeys(c.Titles) {
+		title := c.Titles[id]
+		var name vcard.PropName = vcard.TITLE
+		if title.Kind == "role" {
+			name = vcard.ROLE
+		}
+		b.add(vcard.Property{Name: name, Value: vcard.PropValue(vcard.Escape(title.Name))}, title.Params, propID(id, "t", i))
+	}
+	for i, id := range sortedKeys(c.Emails) {
+		email := c.Emails[id]
+		prop := vcard.Property{Name: vcard.EMAIL, Value: vcard.PropValue(vcard.Escape(email.Address))}
+		b.labeled(prop, email.Label, email.Params, typeParams(email.Contexts, nil, email.Params), prefParam(email.Pref), propID(id, "e", i))
+	}
+	for i, id := range sortedKeys(c.Phones) {
+		tel := c.Phones[id]
+		prop := vcard.Property{Name: vcard.TEL, Value: vcard.PropValue(tel.Number)}
+		b.labeled(prop, tel.Label, tel.Params, typeParams(tel.Contexts, tel.Features, tel.Params), prefParam(tel.Pref), propID(id, "p", i))
+	}
+	for i, id := range sortedKeys(c.Addresses) {
+		b.address(id, c.Addresses[id], i)
+	}
+	for i, id := range sortedKeys(c.OnlineServices) {
+		service := c.OnlineServices[id]
+		prop := vcard.Property{Name: vcard.SOCIALPROFILE, Value: vcard.PropValue(service.URI)}
+		if service.VCardName == "impp" {
+			prop.Name = vcard.IMPP
+		}
+		if service.URI == "" {
+			prop.Value = vcard.PropValue(vcard.Escape(service.User))
+			prop.Params = textValue(prop)
+		}
+		if service.Service != "" {
+			prop.Params = append(prop.Params, &vcard.BaseParam{Name: vcard.SERVICE_TYPE_PARAM, Val: []string{service.Service}})
+		}
+		b.labeled(prop, service.Label, service.Params, typeParams(service.Contexts, nil, service.Params), prefParam(service.Pref), propID(id, "s", i))
+	}
+	for i, id := range sortedKeys(c.Links) {
+		link := c.Links[id]
+		prop := vcard.Property{Name: vcard.URL, Value: vcard.PropValue(link.URI)}
+		b.labeled(prop, link.Label, link.Params, typeParams(link.Contexts, nil, link.Params), mediaTypeParam(link.MediaType), prefParam(link.Pref), propID(id, "l", i))
+	}
+	for i, id := range sortedKeys(c.Media) {
+		media := c.Media[id]
+		prop := vcard.Property{Name: vcard.PropName(strings.ToUpper(media.Kind)), Value: vcard.PropValue(media.URI)}
+		b.labeled(prop, media.Label, media.Params, typeParams(media.Contexts, nil, media.Params), mediaTypeParam(media.MediaType), prefParam(media.Pref), propID(id, "m", i))
+	}
+	for i, id := range sortedKeys(c.Anniversaries) {
+		b.anniversary(id, c.Anniversaries[id], i)
+	}
+	for _, key := range sortedKeys(c.RelatedTo) {
+		relation := c.RelatedTo[key]
+		prop := vcard.Property{Name: vcard.RELATED, Value: vcard.PropValue(key)}
+		if !vcard.HasScheme(key) {
+			prop.Value = vcard.PropValue(vcard.Escape(key))
+			prop.Params = textValue(prop)
+		}
+		if types := sortedKeys(relation.Relation); len(types) > 0 {
+			prop.Params = append(prop.Params, &vcard.BaseParam{Name: vcard.TYPE_PARAM, Val: types})
+		}
+		b.add(prop, relation.Params)
+	}
+	if len(c.Keywords) > 0 {
+		keywords := sortedKeys(c.Keywords)
+		slices.Sort(keywords)
+		b.add(vcard.Property{Name: vcard.CATEGORIES, Value: vcard.PropValue(vcard.JoinValues(keywords...))}, nil)
+	}
+	for i, id := range sortedKeys(c.Notes) {
+		b.add(vcard.Property{Name: vcard.NOTE, Value: vcard.PropValue(vcard.Escape(c.Notes[id].Note))}, c.Notes[id].Params, propID(id, "n", i))
+	}
+	b.timestamp(vcard.CREATED, "created", c.Created)
+	b.timestamp(vcard.REV, "updated", c.Updated)
+
+	for _, prop := range extra {
+		b.v.AddProperty(prop)
+	}
+	for _, ptr := range sortedKeys(c.Unmapped) {
+		b.jsprop(ptr, c.Unmapped[ptr])
+	}
+	return b.v, nil
+}
+
+// Adds prop with the params of p and any extra ones, nil ones are left out.
+func (b *toVCard) add(prop vcard.Property, p Params, extra ...vcard.Param) vcard.Property {
+	for _, param := range extra {
+		if param != nil {
+			prop.Params = append(prop.Params, param)
+		}
+	}
+	for _, key := range sortedKeys(p) {
+		vals := paramStrings(p[key])
+		switch key {
+		case groupParam:
+			prop.Group = strings.Join(vals, "")
+		case strings.ToLower(string(vcard.TYPE_PARAM)):
+			// typeParams puts them with the contexts
+			if prop.HasParam(vcard.TYPE_PARAM) {
+				continue
+			}
+			prop.Params = append(prop.Params, &vcard.BaseParam{Name: vcard.TYPE_PARAM, Val: vals})
+		default:
+			prop.Params = append(prop.Params, &vcard.BaseParam{Name: vcard.ParamName(strings.ToUpper(key)), Val: vals})
+		}
+	}
+	b.v.AddProperty(prop)
+	return prop
+}
+
+// Adds prop and its label as an Apple X-ABLabel in the same group,
+// making up an itemN group if it has none.
+func (b *toVCard) labeled(prop vcard.Property, label string, p Params, extra ...vcard.Param) {
+	prop = b.add(prop, p, extra...)
+	if label == "" {
+		return
+	}
+	group := prop.Group
+	if group == "" {
+		for {
+			b.next++
+			group = vcard.ITEM_GROUP + strconv.Itoa(b.next)
+			if !b.groups[group] {
+				break
+			}
+		}
+		b.groups[group] = true
+		last := len(b.v.Properties) - 1
+		b.v.Properties[last].Group = group
+	}
+	b.v.AddProperty(vcard.Property{Group: group, Name: vcard.X_ABLABEL, Value: vcard.PropValue(vcard.Escape(vcard.EncodeAppleLabel(label)))})
+}
+
+func (b *toVCard) text(name vcard.PropName, value string, escape bool) {
+	if value == "" {
+		return
+	}
+	if escape {
+		value = vcard.Escape(value)
+	}
+	b.add(vcard.Property{Name: name, Value: vcard.PropValue(value)}, nil)
+}
+
+// ptr is the Card property, for a value that isn't a UTCDateTime.
+func (b *toVCard) timestamp(name vcard.PropName, ptr, value string) {
+	if value == "" {
+		return
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		b.jsprop(ptr, jsonString(value))
+		return
+	}
+	b.add(vcard.Property{Name: name, Value: vcard.PropValue(t.UTC().Format("20060102T150405Z"))}, nil)
+}
+
+// FN and N. The components are kept whole if N has no place for some.
+func (b *toVCard) name(c *Card) {
+	if c.Name == nil {
+		return
+	}
+	b.text(vcard.FN, c.Name.Full, true)
+	if len(c.Name.Components) == 0 {
+		return
+	}
+	comps := make([][]string, len(nameKinds))
+	last := 4
+	unknown := false
+	for _, comp := range c.Name.Components {
+		i := slices.Index(nameKinds, comp.Kind)
+		if i < 0 {
+			unknown = true
+			continue
+		}
+		comps[i] = append(comps[i], comp.Value)
+		last = max(last, i)
+	}
+	if unknown {
+		// N gets what it can hold, the components are kept as they are
+		raw, _ := json.Marshal(c.Name.Components)
+		b.jsprop("name/components", raw)
+	}
+	values := make([]string, last+1)
+	for i := range values {
+		values[i] = vcard.JoinValues(comps[i]...)
+	}
+	b.add(vcard.Property{Name: vcard.N, Value: vcard.PropValue(strings.Join(values, vcard.SEMICOLON))}, c.Name.Params)
+}
+
+// ADR, the components are kept whole if ADR has no place for some,
+// like a building or district.
+func (b *toVCard) address(id string, adr Address, i int) {
+	comps := make([][]string, len(addressKinds))
+	unknown := false
+	for _, comp := range adr.Components {
+		i := slices.Index(addressKinds, comp.Kind)
+		if i < 0 {
+			unknown = true
+			continue
+		}
+		comps[i] = append(comps[i], comp.Value)
+	}
+	if unknown {
+		raw, _ := json.Marshal(adr.Components)
+		b.jsprop(joinPointer([]string{"addresses", id, "components"}), raw)
+	}
+	values := make([]string, len(comps))
+	for i := range values {
+		values[i] = vcard.JoinValues(comps[i]...)
+	}
+	prop := vcard.Property{Name: vcard.ADR, Value: vcard.PropValue(strings.Join(values, vcard.SEMICOLON))}
+	var extra []vcard.Param
+	if adr.Full != "" {
+		extra = append(extra, &vcard.BaseParam{Name: vcard.LABEL_PARAM, Val: []string{adr.Full}})
+	}
+	if adr.CountryCode != "" {
+		extra = append(extra, &vcard.BaseParam{Name: vcard.CC_PARAM, Val: []string{adr.CountryCode}})
+	}
+	extra = append(extra, typeParams(adr.Contexts, nil, adr.Params), prefParam(adr.Pref), propID(id, "a", i))
+	b.add(prop, adr.Params, extra...)
+}
+
+// BDAY, ANNIVERSARY or DEATHDATE, other kinds are kept whole.
+func (b *toVCard) anniversary(id string, a Anniversary, i int) {
+	var name vcard.PropName
+	for n, kind := range anniversaryKinds {
+		if kind == a.Kind {
+			name = n
+		}
+	}
+	var d contact.DateOrTime
+	if a.Date.UTC != "" {
+		t, err := time.Parse(time.RFC3339, a.Date.UTC)
+		if err != nil {
+			name = ""
+		}
+		t = t.UTC()
+		d = contact.DateOrTime{
+			Year: t.Year(), Month: int(t.Month()), Day: t.Day(),
+			Hour: t.Hour(), Minute: t.Minute(), Second: t.Second(),
+			HasHour: true, HasMinute: true, HasSecond: true, Zone: "Z",
+		}
+	} else {
+		d = contact.DateOrTime{Year: a.Date.Year, Month: a.Date.Month, Day: a.Date.Day}
+	}
+	if name == "" || !d.HasDate() {
+		raw, _ := json.Marshal(a)
+		b.jsprop(joinPointer([]string{"anniversaries", id}), raw)
+		return
+	}
+	b.add(vcard.Property{Name: name, Value: vcard.PropValue(d.String())}, a.Params, propID(id, "d", i))
+}
+
+// JSPROP;JSPTR="example.com:foo":"bar"
+func (b *toVCard) jsprop(ptr string, value json.RawMessage) {
+	b.v.AddProperty(vcard.Property{
+		Name:   vcard.JSPROP,
+		Params: []vcard.Param{&vcard.BaseParam{Name: vcard.JSPTR_PARAM, Val: []string{ptr}}},
+		Value:  vcard.PropValue(vcard.Escape(string(value))),
+	})
+}
+
+// The TYPE param of the contexts and features, with the types that
+// weren't either kept in the vCardParams.
+func typeParams(contexts, features map[string]bool, p Params) vcard.Param {
+	var types []string
+	for _, context := range sortedKeys(contexts) {
+		if !contexts[context] {
+			continue
+		}
+		if context == "private" {
+			context = "home"
+		}
+		types = append(types, context)
+	}
+	for _, f := range phoneFeatures {
+		if features[f.feature] {
+			types = append(types, f.vcard)
+		}
+	}
+	types = append(types, paramStrings(p[strings.ToLower(string(vcard.TYPE_PARAM))])...)
+	if len(types) == 0 {
+		return nil
+	}
+	return &vcard.BaseParam{Name: vcard.TYPE_PARAM, Val: types}
+}
+
+// Adds VALUE=text if a reader would take the value for something else.
+func textValue(prop vcard.Property) []vcard.Param {
+	if prop.ImpliesType("text") {
+		return prop.Params
+	}
+	return append(prop.Params, &vcard.BaseParam{Name: vcard.VALUE_PARAM, Val: []string{"text"}})
+}
+
+func prefParam(pref int) vcard.Param {
+	if pref == 0 {
+		return nil
+	}
+	return &vcard.BaseParam{Name: vcard.PREF_PARAM, Val: []string{strconv.Itoa(pref)}}
+}
+
+func mediaTypeParam(mediaType string) vcard.Param {
+	if mediaType == "" {
+		return nil
+	}
+	return &vcard.BaseParam{Name: vcard.MEDIATYPE_PARAM, Val: []string{mediaType}}
+}
+
+// The id as a PROP-ID, unless it's the one FromVCard makes up for
+// the i-th property anyway.
+func propID(id, prefix string, i int) vcard.Param {
+	if id == prefix+strconv.Itoa(i+1) {
+		return nil
+	}
+	return &vcard.BaseParam{Name: vcard.PROP_ID_PARAM, Val: []string{id}}
+}
+
+// Namespace of the UIDs nameUID makes.
+var uidNamespace = [16]byte{0x2c, 0x8e, 0x4f, 0x13, 0x7a, 0x90, 0x45, 0xd1, 0xb6, 0x3e, 0x08, 0x5f, 0xc2, 0x71, 0x9a, 0xe4}
+
+// A name-based (version 5) UUID as a URN, of the properties that tell
+// contacts apart. Cards that only differ in other properties get the
+// same one, they are likely duplicates anyway.
+func nameUID(v *vcard.VCard) string {
+	h := sha1.New()
+	h.Write(uidNamespace[:])
+	for _, prop := range v.Properties {
+		switch prop.Name {
+		case vcard.FN, vcard.N, vcard.ORG, vcard.EMAIL, vcard.TEL:
+			fmt.Fprintf(h, "%s:%s\x00", prop.Name, prop.Value)
+		}
+	}
+	u := h.Sum(nil)[:16]
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+func jsonString(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// Sorted so e2 comes before e10.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+		return strings.Compare(a, b)
+	})
+	return keys
+}
+
+// Calls f with the vCardParams of every object of c.
+func (c *Card) eachParams(f func(Params)) {
+	if c.Name != nil {
+		f(c.Name.Params)
+	}
+	for _, v := range c.Nicknames {
+		f(v.Params)
+	}
+	for _, v := range c.Organizations {
+		f(v.Params)
+	}
+	for _, v := range c.Titles {
+		f(v.Params)
+	}
+	for _, v := range c.Emails {
+		f(v.Params)
+	}
+	for _, v := range c.Phones {
+		f(v.Params)
+	}
+	for _, v := range c.Addresses {
+		f(v.Params)
+	}
+	for _, v := range c.OnlineServices {
+		f(v.Params)
+	}
+	for _, v := range c.Links {
+		f(v.Params)
+	}
+	for _, v := range c.Media {
+		f(v.Params)
+	}
+	for _, v := range c.Anniversaries {
+		f(v.Params)
+	}
+	for _, v := range c.RelatedTo {
+		f(v.Params)
+	}
+	for _, v := range c.Notes {
+		f(v.Params)
+	}
+}
@@ -0,0 +1,252 @@
+package jscontact
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/parsing"
+	"ContactCleaner/vcard"
+	"ContactCleaner/writing"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const input = "BEGIN:VCARD\r\n" +
+	"VERSION:4.0\r\n" +
+	"UID:urn:uuid:03a0e51f-d1aa-4385-8a53-e29025acd8af\r\n" +
+	"FN:Dr. Taco Cat\r\n" +
+	"N:Cat;Taco;Al,Pastor;Dr.;\r\n" +
+	"ORG:Tacos\\, Inc.;Salsa\r\n" +
+	"item1.EMAIL;TYPE=work:taco@example.com\r\n" +
+	"item1.X-ABLabel:Tacos\r\n" +
+	"TEL;TYPE=home,cell;PREF=1:tel:+1-111-555-1212\r\n" +
+	"ADR;TYPE=work;CC=US:;;123 Main Street;Any Town;CA;91921;U.S.A.\r\n" +
+	"IMPP:xmpp:taco@example.com\r\n" +
+	"BDAY:--0415\r\n" +
+	"ANNIVERSARY;VALUE=text:circa 2010\r\n" +
+	"CATEGORIES:friends,food\r\n" +
+	"NOTE;PROP-ID=note:Likes tacos.\r\n" +
+	"GEO:geo:37.386013,-122.082932\r\n" +
+	"JSPROP;JSPTR=\"example.com:foo\":\"bar\"\r\n" +
+	"REV:20240102T030405Z\r\n" +
+	"END:VCARD\r\n"
+
+func TestFromVCard(t *testing.T) {
+	v, err := parsing.NewParser(strings.NewReader(input)).NextVCard()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c := FromVCard(v)
+
+	expected := &Card{
+		Type:    "Card",
+		Version: "1.0",
+		UID:     "urn:uuid:03a0e51f-d1aa-4385-8a53-e29025acd8af",
+		Updated: "2024-01-02T03:04:05Z",
+		Name: &Name{
+			Full: "Dr. Taco Cat",
+			Components: []NameComponent{
+				{Kind: "surname", Value: "Cat"},
+				{Kind: "given", Value: "Taco"},
+				{Kind: "given2", Value: "Al"},
+				{Kind: "given2", Value: "Pastor"},
+				{Kind: "title", Value: "Dr."},
+			},
+		},
+		Organizations: map[string]Organization{"o1": {Name: "Tacos, Inc.", Units: []OrgUnit{{Name: "Salsa"}}}},
+		Emails: map[string]EmailAddress{"e1": {
+			Address:  "taco@example.com",
+			Contexts: map[string]bool{"work": true},
+			Label:    "Tacos",
+			Params:   Params{"group": "item1"},
+		}},
+		Phones: map[string]Phone{"p1": {
+			Number:   "tel:+1-111-555-1212",
+			Contexts: map[string]bool{"private": true},
+			Features: map[string]bool{"mobile": true},
+			Pref:     1,
+		}},
+		Addresses: map[string]Address{"a1": {
+			Components: []AddressComponent{
+				{Kind: "name", Value: "123 Main Street"},
+				{Kind: "locality", Value: "Any Town"},
+				{Kind: "region", Value: "CA"},
+				{Kind: "postcode", Value: "91921"},
+				{Kind: "country", Value: "U.S.A."},
+			},
+			CountryCode: "US",
+			Contexts:    map[string]bool{"work": true},
+		}},
+		OnlineServices: map[string]OnlineService{"s1": {URI: "xmpp:taco@example.com", VCardName: "impp"}},
+		Anniversaries:  map[string]Anniversary{"d1": {Kind: "birth", Date: Date{Type: "PartialDate", Month: 4, Day: 15}}},
+		Keywords:       map[string]bool{"friends": true, "food": true},
+		Notes:          map[string]Note{"note": {Note: "Likes tacos."}},
+		VCardProps: []json.RawMessage{
+			json.RawMessage(`["anniversary",{},"text","circa 2010"]`),
+			json.RawMessage(`["geo",{},"uri","geo:37.386013,-122.082932"]`),
+		},
+		Unmapped: map[string]json.RawMessage{"example.com:foo": json.RawMessage(`"bar"`)},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		got, _ := json.MarshalIndent(c, "", "  ")
+		t.Errorf("Unexpected card\n%s", got)
+	}
+}
+
+// JSContact properties without a vCard property survive a trip through
+// a vCard file as JSPROP.
+func TestUnmappedRoundTrip(t *testing.T) {
+	data := `{
+		"@type": "Card",
+		"version": "1.0",
+		"uid": "urn:uuid:1",
+		"name": {
+			"@type": "Name",
+			"components": [
+				{"kind": "given", "value": "Taco"},
+				{"kind": "surname", "value": "Cat"},
+				{"kind": "separator", "value": " "}
+			],
+			"isOrdered": true
+		},
+		"emails": {"home": {"address": "taco@example.com", "contexts": {"private": true}, "pref": 2}},
+		"addresses": {"a1": {
+			"components": [{"kind": "locality", "value": "Any Town"}],
+			"coordinates": "geo:37.386013,-122.082932"
+		}},
+		"anniversaries": {"d1": {"kind": "first-taco", "date": {"year": 2001}}},
+		"example.com:favorite": {"food": ["tacos", "burritos"]},
+		"updated": "yesterday"
+	}`
+	c, err := Unmarshal([]byte(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	v, err := ToVCard(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writing.NewWriter(&buf, vcard.VERSION40).WriteVCard(v); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, e := range []string{
+		"N:Cat;Taco;;;\r\n",
+		"EMAIL;TYPE=home;PROP-ID=home;PREF=2:taco@example.com\r\n",
+		`JSPROP;JSPTR=name/components:[{"kind":"given"\,"value":"Taco"}`,
+		`JSPROP;JSPTR=name/isOrdered:true`,
+		`JSPROP;JSPTR=addresses/a1/coordinates:"geo:37.386013\,-122.082932"`,
+		`JSPROP;JSPTR=updated:"yesterday"`,
+	} {
+		if !strings.Contains(buf.String(), e) {
+			t.Errorf("Expected %q in\n%s", e, buf.String())
+		}
+	}
+
+	back, err := parsing.NewParser(&buf).NextVCard()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err := Marshal(FromVCard(back))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var want, got any
+	json.Unmarshal([]byte(data), &want)
+	json.Unmarshal(out, &got)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Round trip mismatch\nexpected %s\ngot      %s", data, out)
+	}
+}
+
+func TestContactsRoundTrip(t *testing.T) {
+	card := &contact.ContactCard{
+		Version:       vcard.VERSION40,
+		UID:           "urn:uuid:1",
+		FullName:      "Taco Cat",
+		FirstName:     "Taco",
+		LastName:      "Cat",
+		PhoneticFirst: "タコ",
+		Nickname:      "Tac",
+		Organization:  "Tacos",
+		Birthday:      &contact.DateOrTime{Month: 4, Day: 15},
+		Anniversary:   &contact.DateOrTime{Text: "circa 2010"},
+		Revision:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Categories:    []string{"food, mostly", "friends"},
+		Telephones:    []contact.Telephone{{Type: []string{"cell"}, Number: "+1 111 555 1212", Label: "Boat", Group: "item1"}},
+		Emails:        []contact.EmailAddr{{Type: []string{"work", "internet"}, Address: "taco@example.com"}},
+		Addresses:     []contact.Address{{Type: []string{"home"}, Street: "123 Main Street", City: "Any Town", Country: "U.S.A."}},
+		SocialProfiles: []contact.SocialMediaProfile{
+			{Type: "twitter", URL: "https://twitter.com/taco"},
+		},
+		InstantMessaging: []string{"xmpp:taco@example.com"},
+		Photo:            contact.EncodedImage("data:image/png;base64,iVBORw0KGgo="),
+		Notes:            "Likes tacos.\nAnd burritos; with salsa.",
+		CustomFields:     map[string]string{"X-FOO": "bar"},
+		ExtendedFields:   []contact.XField{{Type: "GEO", Data: "geo:37.386013,-122.082932"}},
+	}
+	c := FromContact(card)
+	b, err := Marshal(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c, err = Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err := ToContact(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(card, out) {
+		t.Errorf("Round trip mismatch\nexpected %+v\ngot      %+v\n%s", card, out, b)
+	}
+}
+
+// Cards without a UID get the same one on every run.
+func TestStableUID(t *testing.T) {
+	convert := func(input string) []byte {
+		v, err := parsing.NewParser(strings.NewReader(input)).NextVCard()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b, err := Marshal(FromVCard(v))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return b
+	}
+	taco := "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Taco Cat\r\nEMAIL:taco@example.com\r\nEND:VCARD\r\n"
+	burrito := "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Taco Cat\r\nEMAIL:burrito@example.com\r\nEND:VCARD\r\n"
+	a, b := convert(taco), convert(taco)
+	if !bytes.Equal(a, b) {
+		t.Errorf("Expected the same output twice\n%s\n%s", a, b)
+	}
+	c, err := Unmarshal(a)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(c.UID, "urn:uuid:") || c.UID[len("urn:uuid:")+14] != '5' {
+		t.Errorf("Expected a version 5 UUID, got %s", c.UID)
+	}
+	if bytes.Equal(a, convert(burrito)) {
+		t.Errorf("Expected another UID for another contact")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`[]`,
+		`{"@type": "Group", "uid": "1"}`,
+		`{"@type": "Card", "emails": {"e1": {"address": 1}}}`,
+	} {
+		if _, err := Unmarshal([]byte(data)); !errors.Is(err, ErrInvalidJSContact) {
+			t.Errorf("%s: expected ErrInvalidJSContact, got %v", data, err)
+		}
+	}
+}
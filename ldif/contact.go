@@ -0,0 +1,425 @@
+package ldif
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/photo"
+	"ContactCleaner/vcard"
+	"bytes"
+	"image/jpeg"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The entry's dn is kept in this custom field, so a directory export
+// can be written back with the same names.
+const DNField = "X-LDAP-DN"
+
+var objectClasses = []string{"top", "person", "organizationalPerson", "inetOrgPerson", "mozillaAbPersonAlpha"}
+
+// The phone attributes and the TYPE params of the phones in each.
+// telephoneNumber is the office phone, it takes the phones of no
+// other kind too.
+var phoneAttrs = []struct {
+	name  string
+	types []string
+}{
+	{"facsimileTelephoneNumber", []string{"fax"}},
+	{"mobile", []string{"cell"}},
+	{"pager", []string{"pager"}},
+	{"homePhone", []string{"home"}},
+	{"telephoneNumber", []string{"work"}},
+}
+
+// The components of the home and work addresses.
+type addressAttrs struct {
+	types                                              []string
+	postal, street, street2, city, state, zip, country string
+}
+
+var addressKinds = []addressAttrs{
+	{[]string{"home"}, "homePostalAddress", "mozillaHomeStreet", "mozillaHomeStreet2", "mozillaHomeLocalityName", "mozillaHomeState", "mozillaHomePostalCode", "mozillaHomeCountryName"},
+	{[]string{"work"}, "postalAddress", "street", "mozillaWorkStreet2", "l", "st", "postalCode", "c"},
+}
+
+// Attributes of the two object classes without a contact field, kept in
+// CustomFields as X-NAME and written back from there.
+var passThrough = []string{
+	"uid", "initials", "displayName", "employeeNumber", "employeeType", "departmentNumber",
+	"roomNumber", "manager", "secretary", "businessCategory", "carLicense", "preferredLanguage",
+	"mozillaCustom1", "mozillaCustom2", "mozillaCustom3", "mozillaCustom4", "mozillaUseHtmlMail",
+}
+
+// Attributes that say nothing about the contact.
+var ignored = []string{"objectClass", "modifyTimestamp", "createTimestamp"}
+
+// ToContact maps an inetOrgPerson or mozillaAbPersonAlpha entry to a
+// contact. Attributes without a field go in CustomFields as X-NAME,
+// the dn as X-LDAP-DN.
+func ToContact(e *Entry) *contact.ContactCard {
+	card := &contact.ContactCard{
+		FullName:  e.Value("cn"),
+		LastName:  e.Value("sn"),
+		FirstName: e.Value("givenName"),
+		Nickname:  e.Value("mozillaNickname"),
+		Titles:    e.Value("title"),
+		Notes:     e.Value("description"),
+	}
+	if card.FullName == "" {
+		card.FullName = e.Value("displayName")
+	}
+	if card.LastName == card.FullName && card.FirstName == "" {
+		// sn is required, directories copy cn into it
+		card.LastName = ""
+	}
+	if o, ou := e.Value("o"), e.Value("ou"); o != "" || ou != "" {
+		card.Organization = contact.JoinOrg(append([]string{o}, strings.Split(ou, vcard.SEMICOLON)...)...)
+	}
+
+	// Thunderbird's second e-mail comes after the first mail
+	mails := e.Values("mail")
+	if second := e.Values("mozillaSecondEmail"); len(mails) > 0 {
+		mails = append(mails[:1], append(second, mails[1:]...)...)
+	} else {
+		mails = second
+	}
+	for _, mail := range mails {
+		card.Emails = append(card.Emails, contact.EmailAddr{Address: mail})
+	}
+	for _, attr := range phoneAttrs {
+		for _, number := range e.Values(attr.name) {
+			card.Telephones = append(card.Telephones, contact.Telephone{Type: attr.types, Number: number})
+		}
+	}
+	for _, kind := range addressKinds {
+		card.Addresses = append(card.Addresses, addresses(e, kind)...)
+	}
+
+	urls := append(e.Values("mozillaHomeUrl"), e.Values("mozillaWorkUrl")...)
+	for _, uri := range e.Values("labeledURI") {
+		// the URI, then a label
+		uri, _, _ = strings.Cut(uri, " ")
+		urls = append(urls, uri)
+	}
+	for _, url := range urls {
+		if card.URL == "" {
+			card.URL = url
+			continue
+		}
+		card.Items = append(card.Items, contact.Item{ItemNumber: len(card.Items) + 1, ItemName: string(vcard.URL), ItemValue: url})
+	}
+
+	if month, _ := strconv.Atoi(e.Value("birthmonth")); month != 0 {
+		year, _ := strconv.Atoi(e.Value("birthyear"))
+		day, _ := strconv.Atoi(e.Value("birthday"))
+		card.Birthday = &contact.DateOrTime{Year: year, Month: month, Day: day}
+	}
+	if jpeg := e.Value("jpegPhoto"); jpeg != "" {
+		card.Photo = contact.NewEncodedImage("image/jpeg", []byte(jpeg))
+	}
+	if t, err := time.Parse("20060102150405Z", e.Value("modifyTimestamp")); err == nil {
+		card.Revision = t
+	}
+
+	for _, a := range e.Attrs {
+		name := baseName(a.Name)
+		if !known(name) {
+			setCustom(card, name, a.Value)
+		}
+	}
+	if e.DN != "" {
+		setCustom(card, DNField, e.DN)
+	}
+	return card
+}
+
+// The address from the component attributes, then one from the lines
+// of each postal address the components don't account for.
+func addresses(e *Entry, kind addressAttrs) []contact.Address {
+	var adrs []contact.Address
+	adr := contact.Address{
+		Type:     kind.types,
+		Street:   e.Value(kind.street),
+		Extended: e.Value(kind.street2),
+		City:     e.Value(kind.city),
+		State:    e.Value(kind.state),
+		Zip:      e.Value(kind.zip),
+		Country:  e.Value(kind.country),
+	}
+	if kind.postal == "postalAddress" {
+		adr.POBox = e.Value("postOfficeBox")
+	}
+	postal := e.Values(kind.postal)
+	if adr.Street+adr.Extended+adr.City+adr.State+adr.Zip+adr.Country+adr.POBox != "" {
+		adrs = append(adrs, adr)
+		if len(postal) > 0 {
+			// the lines of the same address
+			postal = postal[1:]
+		}
+	}
+	for _, p := range postal {
+		adrs = append(adrs, contact.Address{Type: kind.types, Street: strings.Join(splitPostal(p), "\n")})
+	}
+	return adrs
+}
+
+func known(name string) bool {
+	for _, n := range ignored {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	switch strings.ToLower(name) {
+	case "cn", "sn", "givenname", "mozillanickname", "title", "description", "o", "ou",
+		"mail", "mozillasecondemail", "mozillahomeurl", "mozillaworkurl", "labeleduri",
+		"birthyear", "birthmonth", "birthday", "jpegphoto", "postofficebox":
+		return true
+	}
+	for _, attr := range phoneAttrs {
+		if strings.EqualFold(attr.name, name) {
+			return true
+		}
+	}
+	for _, kind := range addressKinds {
+		for _, n := range []string{kind.postal, kind.street, kind.street2, kind.city, kind.state, kind.zip, kind.country} {
+			if strings.EqualFold(n, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func setCustom(card *contact.ContactCard, name, value string) {
+	if card.CustomFields == nil {
+		card.CustomFields = make(map[string]string)
+	}
+	key := strings.ToUpper(name)
+	if !strings.HasPrefix(key, vcard.X) {
+		key = vcard.X + key
+	}
+	if old, ok := card.CustomFields[key]; ok {
+		// more values of the same attribute
+		value = old + "\n" + value
+	}
+	card.CustomFields[key] = value
+}
+
+// FromContact maps card to an entry. The dn is the X-LDAP-DN the card
+// was read with, or cn=<name> under baseDN. Without a baseDN it's the
+// cn=<name>,mail=<mail> Thunderbird uses.
+func FromContact(card *contact.ContactCard, baseDN string) *Entry {
+	e := &Entry{}
+	name := fullName(card)
+	e.DN = card.CustomFields[DNField]
+	if e.DN == "" {
+		e.DN = "cn=" + escapeDN(name)
+		switch {
+		case baseDN != "":
+			e.DN += "," + baseDN
+		case len(card.Emails) > 0:
+			e.DN += ",mail=" + escapeDN(card.Emails[0].Address)
+		}
+	}
+
+	e.Add("objectClass", objectClasses...)
+	e.Add("cn", name)
+	// sn is required
+	sn := card.LastName
+	if sn == "" {
+		sn = name
+	}
+	e.Add("sn", sn)
+	e.Add("givenName", card.FirstName)
+	e.Add("mozillaNickname", card.Nickname)
+	if units := contact.OrgUnits(card.Organization); len(units) > 0 {
+		e.Add("o", units[0])
+		e.Add("ou", strings.Join(units[1:], vcard.SEMICOLON))
+	}
+	e.Add("title", card.Titles)
+
+	for i, email := range card.Emails {
+		if i == 1 {
+			e.Add("mozillaSecondEmail", email.Address)
+			continue
+		}
+		e.Add("mail", email.Address)
+	}
+	for _, tel := range card.Telephones {
+		e.Add(phoneAttr(tel.Type), tel.Number)
+	}
+
+	written := make(map[string]bool)
+	for _, adr := range card.Addresses {
+		kind := addressKinds[1]
+		if hasType(adr.Type, "home") {
+			kind = addressKinds[0]
+		}
+		lines := []string{adr.Street, adr.Extended, adr.POBox, strings.TrimSpace(strings.Join(nonEmpty(adr.City, strings.TrimSpace(adr.State+" "+adr.Zip)), ", ")), adr.Country}
+		e.Add(kind.postal, joinPostal(nonEmpty(lines...)))
+		if written[kind.postal] {
+			continue
+		}
+		// only one of each kind has the components
+		written[kind.postal] = true
+		e.Add(kind.street, adr.Street)
+		e.Add(kind.street2, adr.Extended)
+		e.Add(kind.city, adr.City)
+		e.Add(kind.state, adr.State)
+		e.Add(kind.zip, adr.Zip)
+		e.Add(kind.country, adr.Country)
+		if kind.postal == "postalAddress" {
+			e.Add("postOfficeBox", adr.POBox)
+		}
+	}
+
+	e.Add("mozillaHomeUrl", card.URL)
+	for _, item := range card.Items {
+		if strings.EqualFold(item.ItemName, string(vcard.URL)) {
+			e.Add("labeledURI", strings.TrimSpace(item.ItemValue+" "+item.Label))
+		}
+	}
+	if d := card.Birthday; d != nil && !d.IsText() {
+		if d.Year != 0 {
+			e.Add("birthyear", strconv.Itoa(d.Year))
+		}
+		if d.Month != 0 {
+			e.Add("birthmonth", strconv.Itoa(d.Month))
+		}
+		if d.Day != 0 {
+			e.Add("birthday", strconv.Itoa(d.Day))
+		}
+	}
+	e.Add("description", card.Notes)
+	if b, ok := jpegBytes(card.Photo); ok {
+		e.Add("jpegPhoto", string(b))
+	}
+
+	keys := make([]string, 0, len(card.CustomFields))
+	for key := range card.CustomFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, attr := range passThrough {
+			if strings.EqualFold(vcard.X+attr, key) {
+				e.Add(attr, strings.Split(card.CustomFields[key], "\n")...)
+			}
+		}
+	}
+	return e
+}
+
+func phoneAttr(types []string) string {
+	for _, attr := range phoneAttrs {
+		if hasType(types, attr.types[0]) {
+			return attr.name
+		}
+	}
+	return "telephoneNumber"
+}
+
+func hasType(types []string, t string) bool {
+	for _, v := range types {
+		if strings.EqualFold(v, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// The photo as a JPEG, other inline pictures are re-encoded.
+func jpegBytes(img contact.Image) ([]byte, bool) {
+	if img == nil {
+		return nil, false
+	}
+	b, err := img.Bytes()
+	if err != nil || len(b) == 0 {
+		return nil, false
+	}
+	if img.MediaType() == "image/jpeg" {
+		return b, true
+	}
+	m, err := photo.Decode(img)
+	if err != nil {
+		return nil, false
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, m, nil); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// FN is required, fall back to the name parts
+func fullName(card *contact.ContactCard) string {
+	if card.FullName != "" {
+		return card.FullName
+	}
+	parts := []string{card.Prefix, card.FirstName, card.MiddleName, card.LastName, card.Suffix}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+func nonEmpty(vals ...string) []string {
+	var out []string
+	for _, v := range vals {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// postalAddress lines are joined with $, which is escaped as \24
+// and \ as \5C. https://tools.ietf.org/html/rfc4517#section-3.3.28
+func joinPostal(lines []string) string {
+	r := strings.NewReplacer(`\`, `\5C`, "$", `\24`)
+	for i, l := range lines {
+		lines[i] = r.Replace(l)
+	}
+	return strings.Join(lines, "$")
+}
+
+func splitPostal(s string) []string {
+	r := strings.NewReplacer(`\24`, "$", `\5C`, `\`, `\5c`, `\`)
+	var lines []string
+	for _, l := range strings.Split(s, "$") {
+		if l = strings.TrimSpace(r.Replace(l)); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// Escapes a value in a dn, https://tools.ietf.org/html/rfc4514#section-2.4
+func escapeDN(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(s)-1 && c == ' ':
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// ReadContacts reads every entry of an LDIF file as a contact.
+func ReadContacts(r io.Reader) ([]*contact.ContactCard, error) {
+	entries, err := NewReader(r).ReadAll()
+	cards := make([]*contact.ContactCard, len(entries))
+	for i, e := range entries {
+		cards[i] = ToContact(e)
+	}
+	return cards, err
+}
+
+// Write writes card as an entry under the writer's BaseDN.
+func (wr *Writer) Write(card *contact.ContactCard) error {
+	return wr.WriteEntry(FromContact(card, wr.BaseDN))
+}
@@ -0,0 +1,255 @@
+// Package ldif reads and writes contacts as LDIF, the text format LDAP
+// directories import and export entries in, with the inetOrgPerson
+// attributes and the mozillaAbPersonAlpha ones Thunderbird adds.
+//
+//	version: 1
+//
+//	dn: cn=Taco Cat,ou=people,dc=example,dc=com
+//	objectClass: inetOrgPerson
+//	cn: Taco Cat
+//	sn: Cat
+//	mail: taco@example.com
+//	jpegPhoto:: /9j/4AAQSkZJRgABAQAAAQABAAD...
+//
+// https://tools.ietf.org/html/rfc2849
+package ldif
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrInvalidLDIF = errors.New("invalid LDIF")
+
+const lineLength = 76
+
+// Entry is one LDIF record. The attributes keep their order, an
+// attribute with several values is there once for each.
+type Entry struct {
+	DN    string
+	Attrs []Attr
+}
+
+type Attr struct {
+	Name  string
+	Value string // decoded, binary for jpegPhoto
+}
+
+// Values returns every value of the attribute name, ignoring case and
+// options, cn;lang-en is a cn.
+func (e *Entry) Values(name string) []string {
+	var vals []string
+	for _, a := range e.Attrs {
+		if strings.EqualFold(baseName(a.Name), name) {
+			vals = append(vals, a.Value)
+		}
+	}
+	return vals
+}
+
+// Value returns the first value of the attribute name.
+func (e *Entry) Value(name string) string {
+	if vals := e.Values(name); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func (e *Entry) Add(name string, values ...string) {
+	for _, v := range values {
+		if v != "" {
+			e.Attrs = append(e.Attrs, Attr{Name: name, Value: v})
+		}
+	}
+}
+
+func baseName(name string) string {
+	name, _, _ = strings.Cut(name, ";")
+	return name
+}
+
+// Reader reads the entries of an LDIF file.
+type Reader struct {
+	s    *bufio.Scanner
+	line int
+	next string // a line read ahead to look for its continuation
+	has  bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &Reader{s: s}
+}
+
+// Reads a line with its continuations, lines starting with one space.
+func (r *Reader) readLine() (string, bool, error) {
+	if !r.has {
+		if !r.s.Scan() {
+			return "", false, r.s.Err()
+		}
+		r.line++
+		r.next = strings.TrimSuffix(r.s.Text(), "\r")
+	}
+	line := r.next
+	r.has = false
+	for r.s.Scan() {
+		r.line++
+		next := strings.TrimSuffix(r.s.Text(), "\r")
+		if !strings.HasPrefix(next, " ") {
+			r.next, r.has = next, true
+			break
+		}
+		line += next[1:]
+	}
+	return line, true, r.s.Err()
+}
+
+// Next returns the next entry, io.EOF at the end. Change records other
+// than adds are skipped, they don't describe a whole entry.
+func (r *Reader) Next() (*Entry, error) {
+	for {
+		var e *Entry
+		change := ""
+		for {
+			line, ok, err := r.readLine()
+			if err != nil {
+				return nil, err
+			}
+			if !ok || line == "" {
+				if e != nil {
+					break
+				}
+				if !ok {
+					return nil, io.EOF
+				}
+				continue
+			}
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			name, value, err := parseLine(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", r.line, err)
+			}
+			switch {
+			case e == nil && strings.EqualFold(name, "version"):
+			case e == nil && strings.EqualFold(name, "dn"):
+				e = &Entry{DN: value}
+			case e == nil:
+				return nil, fmt.Errorf("line %d: %w: %s before dn", r.line, ErrInvalidLDIF, name)
+			case strings.EqualFold(name, "changetype"):
+				change = strings.ToLower(value)
+			case name == "-" || change != "" && change != "add":
+				// a modify record
+			default:
+				e.Attrs = append(e.Attrs, Attr{Name: name, Value: value})
+			}
+		}
+		if change == "" || change == "add" {
+			return e, nil
+		}
+	}
+}
+
+// attr: value, attr:: base64 or attr:< url
+func parseLine(line string) (string, string, error) {
+	if line == "-" {
+		return line, "", nil
+	}
+	name, value, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("%w: no attribute in %q", ErrInvalidLDIF, line)
+	}
+	switch {
+	case strings.HasPrefix(value, ":"):
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %s: %v", ErrInvalidLDIF, name, err)
+		}
+		return name, string(b), nil
+	case strings.HasPrefix(value, "<"):
+		return "", "", fmt.Errorf("%w: %s: values from URLs aren't supported", ErrInvalidLDIF, name)
+	}
+	return name, strings.TrimLeft(value, " "), nil
+}
+
+// ReadAll reads every entry.
+func (r *Reader) ReadAll() ([]*Entry, error) {
+	var entries []*Entry
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+// Writer writes LDIF entries, the version line first.
+type Writer struct {
+	// Where Write puts contacts that weren't read from LDIF,
+	// e.g. ou=people,dc=example,dc=com
+	BaseDN string
+
+	w       io.Writer
+	started bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (wr *Writer) WriteEntry(e *Entry) error {
+	var sb strings.Builder
+	if !wr.started {
+		sb.WriteString("version: 1\n")
+		wr.started = true
+	}
+	sb.WriteString("\n")
+	sb.WriteString(line("dn", e.DN))
+	for _, a := range e.Attrs {
+		sb.WriteString(line(a.Name, a.Value))
+	}
+	_, err := io.WriteString(wr.w, sb.String())
+	return err
+}
+
+// One attribute, base64 when it isn't a safe string, folded at 76.
+func line(name, value string) string {
+	s := name + ": " + value
+	if !safe(value) {
+		s = name + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	var sb strings.Builder
+	for len(s) > lineLength {
+		sb.WriteString(s[:lineLength] + "\n ")
+		s = s[lineLength:]
+	}
+	sb.WriteString(s + "\n")
+	return sb.String()
+}
+
+// SAFE-STRING of RFC 2849, ASCII without NUL, CR or LF that doesn't
+// start with a space, colon or < and doesn't end with a space.
+func safe(s string) bool {
+	if s == "" {
+		return true
+	}
+	if s[0] == ' ' || s[0] == ':' || s[0] == '<' || s[len(s)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == 0 || c == '\r' || c == '\n' || c > 127 {
+			return false
+		}
+	}
+	return true
+}
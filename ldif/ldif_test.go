@@ -0,0 +1,166 @@
+package ldif
+
+import (
+	"ContactCleaner/contact"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const input = `version: 1
+
+# Taco, from Thunderbird
+dn: cn=Taco Cat,mail=taco@example.com
+objectclass: top
+objectclass: person
+objectclass: inetOrgPerson
+objectclass: mozillaAbPersonAlpha
+cn: Taco Cat
+sn: Cat
+givenName: Taco
+mail: taco@example.com
+mozillaSecondEmail: cat@example.com
+telephoneNumber: +1 111 555 1000
+mobile: +1 111 555 1212
+o: Tacos
+ou: Salsa
+street: 123 Main Street
+l: Any Town
+st: CA
+postalCode: 91921
+homePostalAddress: 1 Side Street$Any Town\24ville
+birthyear: 1985
+birthmonth: 4
+birthday: 15
+description:: TGlrZXMgdGFjb3MuCkFuZCBidXJyaXRvcy4=
+mozillaCustom1: Tuesday
+jpegPhoto:: /9j/4AAQ
+modifytimestamp: 20240102030405Z
+x-shoe-size: 9
+
+dn: cn=Burrito Cat,ou=people,dc=exa
+ mple,dc=com
+changetype: add
+cn: Burrito Cat
+sn: Burrito Cat
+
+dn: cn=Gone,ou=people,dc=example,dc=com
+changetype: delete
+`
+
+func TestReadContacts(t *testing.T) {
+	cards, err := ReadContacts(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []*contact.ContactCard{
+		{
+			FullName:     "Taco Cat",
+			FirstName:    "Taco",
+			LastName:     "Cat",
+			Organization: "Tacos;Salsa",
+			Notes:        "Likes tacos.\nAnd burritos.",
+			Birthday:     &contact.DateOrTime{Year: 1985, Month: 4, Day: 15},
+			Revision:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Emails:       []contact.EmailAddr{{Address: "taco@example.com"}, {Address: "cat@example.com"}},
+			Telephones: []contact.Telephone{
+				{Type: []string{"cell"}, Number: "+1 111 555 1212"},
+				{Type: []string{"work"}, Number: "+1 111 555 1000"},
+			},
+			Addresses: []contact.Address{
+				{Type: []string{"home"}, Street: "1 Side Street\nAny Town$ville"},
+				{Type: []string{"work"}, Street: "123 Main Street", City: "Any Town", State: "CA", Zip: "91921"},
+			},
+			Photo: contact.NewEncodedImage("image/jpeg", []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10}),
+			CustomFields: map[string]string{
+				"X-LDAP-DN":        "cn=Taco Cat,mail=taco@example.com",
+				"X-MOZILLACUSTOM1": "Tuesday",
+				"X-SHOE-SIZE":      "9",
+			},
+		},
+		{
+			FullName:     "Burrito Cat",
+			CustomFields: map[string]string{"X-LDAP-DN": "cn=Burrito Cat,ou=people,dc=example,dc=com"},
+		},
+	}
+	if !reflect.DeepEqual(cards, expected) {
+		for i := range cards {
+			t.Errorf("Unexpected card %d\nexpected %+v\ngot      %+v", i, expected[min(i, len(expected)-1)], cards[i])
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	card := &contact.ContactCard{
+		FullName:     "Tāco Cat",
+		FirstName:    "Tāco",
+		LastName:     "Cat",
+		Nickname:     "Tac",
+		Organization: "Tacos, Inc.;Salsa",
+		Titles:       "Chef",
+		URL:          "https://example.com",
+		Notes:        " Likes tacos.\nAnd a very long line that has to be folded since LDIF lines are at most 76 characters.",
+		Birthday:     &contact.DateOrTime{Month: 4, Day: 15},
+		Emails:       []contact.EmailAddr{{Address: "a@example.com"}, {Address: "b@example.com"}, {Address: "c@example.com"}},
+		Telephones: []contact.Telephone{
+			{Type: []string{"fax"}, Number: "+1 111 555 1001"},
+			{Type: []string{"cell"}, Number: "+1 111 555 1212"},
+			{Type: []string{"home"}, Number: "+1 111 555 1002"},
+		},
+		Addresses: []contact.Address{
+			{Type: []string{"home"}, Street: "1 Side Street", City: "Any Town", Country: "U.S.A."},
+			{Type: []string{"work"}, Street: "123 Main Street", Extended: "Suite 5", POBox: "42", City: "Any Town", State: "CA", Zip: "91921"},
+		},
+		Photo:        contact.NewEncodedImage("image/jpeg", []byte{0xff, 0xd8, 0xff, 0xe0}),
+		CustomFields: map[string]string{"X-EMPLOYEENUMBER": "7", "X-LDAP-DN": "cn=Taco Cat,ou=people,dc=example,dc=com"},
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Write(card); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if len(line) > lineLength+1 {
+			t.Errorf("Line longer than %d: %q", lineLength, line)
+		}
+	}
+	for _, e := range []string{"version: 1\n", "dn: cn=Taco Cat,ou=people,dc=example,dc=com\n", "cn:: VMSBY28gQ2F0\n", "employeeNumber: 7\n", "description:: "} {
+		if !strings.Contains(buf.String(), e) {
+			t.Errorf("Expected %q in\n%s", e, buf.String())
+		}
+	}
+
+	cards, err := ReadContacts(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cards) != 1 || !reflect.DeepEqual(cards[0], card) {
+		t.Errorf("Round trip mismatch\nexpected %+v\ngot      %+v", card, cards)
+	}
+}
+
+func TestDN(t *testing.T) {
+	card := &contact.ContactCard{FirstName: "Taco", LastName: "Cat, Jr.", Emails: []contact.EmailAddr{{Address: "taco@example.com"}}}
+	if dn := FromContact(card, "").DN; dn != `cn=Taco Cat\, Jr.,mail=taco@example.com` {
+		t.Errorf("Unexpected dn %q", dn)
+	}
+	if dn := FromContact(card, "ou=people,dc=example,dc=com").DN; dn != `cn=Taco Cat\, Jr.,ou=people,dc=example,dc=com` {
+		t.Errorf("Unexpected dn %q", dn)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, data := range []string{
+		"cn: Taco\n",
+		"dn: cn=Taco\nno colon\n",
+		"dn: cn=Taco\njpegPhoto:: !!!\n",
+		"dn: cn=Taco\njpegPhoto:< file:///taco.jpg\n",
+	} {
+		if _, err := ReadContacts(strings.NewReader(data)); !errors.Is(err, ErrInvalidLDIF) {
+			t.Errorf("%q: expected ErrInvalidLDIF, got %v", data, err)
+		}
+	}
+}
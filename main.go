@@ -1 +1,246 @@
 package main
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/csvcontact"
+	"ContactCleaner/ldif"
+	"ContactCleaner/parsing"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exit codes, usable in scripts
+const (
+	exitOK       = 0
+	exitError    = 1 // reading, parsing or writing failed
+	exitUsage    = 2 // bad command line
+	exitFindings = 3 // validate found problems, dedupe --dry-run found duplicates
+)
+
+var errUsage = errors.New("usage")
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) (int, error)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"dedupe", "dedupe [-o out.vcf] [--dry-run] [--min-confidence 0.5] [--vcard-version 4.0] [--region US] [--max-photo-bytes 0] [--strict] [--columns map.csv] in.vcf|in.csv|in.ldif", runDedupe},
+		{"validate", "validate in.vcf", runValidate},
+		{"convert", "convert --to 3.0|jcard|jscontact|xcard|google-csv|outlook-csv|ldif [-o out.vcf] [--strict] [--columns map.csv] [--base-dn ou=people,dc=example,dc=com] in.vcf|in.csv|in.ldif", runConvert},
+		{"birthdays", "birthdays [-o out.ics] [--years 2] [--name Birthdays] [--strict] [--columns map.csv] in.vcf|in.csv|in.ldif", runBirthdays},
+		{"stats", "stats [--region US] [--strict] [--columns map.csv] in.vcf|in.csv|in.ldif", runStats},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printUsage()
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		code, err := cmd.run(args[1:])
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "usage: contactcleaner "+cmd.usage)
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitUsage
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "contactcleaner "+cmd.name+": "+err.Error())
+		}
+		return code
+	}
+
+	fmt.Fprintf(os.Stderr, "contactcleaner: unknown command %q\n", args[0])
+	printUsage()
+	return exitUsage
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: contactcleaner <command> [options] <file>")
+	fmt.Fprintln(os.Stderr)
+	for _, cmd := range commands {
+		fmt.Fprintln(os.Stderr, "  "+cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Use - to read from stdin. Without -o output goes to stdout.")
+	fmt.Fprintln(os.Stderr, "Exit codes: 0 ok, 1 error, 2 usage, 3 problems or duplicates found.")
+}
+
+// Parses flags that can come before or after the positional arguments,
+// e.g. `dedupe in.vcf -o out.vcf`. The std flag package stops at the
+// first positional argument.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Opens path for reading, stdin if it's -.
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// Reads every card in path, - for stdin.
+// Unless strict is set bad lines are skipped or repaired, a summary
+// goes to stderr.
+func readCards(path string, strict bool) ([]*contact.ContactCard, error) {
+	r, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	p := parsing.NewParser(r, parsing.WithMode(parseMode(strict)))
+	cards, err := p.Parse()
+	if n := len(p.Diagnostics()); n > 0 && err == nil {
+		fmt.Fprintf(os.Stderr, "%d problems in the input were skipped or repaired, run validate to see them\n", n)
+	}
+	return cards, err
+}
+
+// Reads every card in path like readCards, or from a CSV or LDIF file
+// when inputFormat says it is one. For those it also returns how to
+// write the cards back the same way, nil for vCards.
+func readInput(path string, strict bool, columns string) ([]*contact.ContactCard, func(io.Writer) cardWriter, error) {
+	format := inputFormat(path, columns)
+	if format == "vcard" {
+		cards, err := readCards(path, strict)
+		return cards, nil, err
+	}
+	var layout *csvcontact.Layout
+	if columns != "" {
+		f, err := os.Open(columns)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		if layout, err = csvcontact.ReadLayout(f); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", columns, err)
+		}
+	}
+	r, err := openInput(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	if format == "ldif" {
+		cards, err := ldif.ReadContacts(r)
+		return cards, ldifOutput(""), err
+	}
+	cr := csvcontact.NewReader(r, layout)
+	cards, err := cr.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	layout, err = cr.Layout()
+	return cards, csvOutput(layout), err
+}
+
+// vcard, csv or ldif. CSV and LDIF files are told apart by the
+// extension, CSV ones also by a column map for them.
+func inputFormat(path, columns string) string {
+	switch ext := strings.ToLower(filepath.Ext(path)); {
+	case columns != "" || ext == ".csv":
+		return "csv"
+	case ext == ".ldif" || ext == ".ldf":
+		return "ldif"
+	}
+	return "vcard"
+}
+
+func parseMode(strict bool) parsing.Mode {
+	if strict {
+		return parsing.Strict
+	}
+	return parsing.Lenient
+}
+
+// Opens path for writing, stdout if it's empty or -.
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// Runs write on path opened with createOutput and closes it once,
+// a failed Close is an error too since the file may be cut short.
+func writeOutput(path string, write func(w io.Writer) error) error {
+	w, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	if err := write(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// A short description of a card for reports.
+func describe(card *contact.ContactCard) string {
+	name := card.FullName
+	if name == "" {
+		name = strings.TrimSpace(card.FirstName + " " + card.LastName)
+	}
+	if name == "" {
+		name = "(no name)"
+	}
+	var extra []string
+	if len(card.Emails) > 0 {
+		extra = append(extra, card.Emails[0].Address)
+	}
+	if len(card.Telephones) > 0 {
+		extra = append(extra, card.Telephones[0].Number)
+	}
+	if len(extra) > 0 {
+		name += " <" + strings.Join(extra, ", ") + ">"
+	}
+	return name
+}
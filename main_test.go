@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const cards = "BEGIN:VCARD\r\nVERSION:4.0\r\n" +
+	"FN:Taco Cat\r\nN:Cat;Taco;;;\r\n" +
+	"EMAIL:taco@example.com\r\nTEL:+1 111 555 1212\r\n" +
+	"BDAY:19850415\r\n" +
+	"END:VCARD\r\n" +
+	"BEGIN:VCARD\r\nVERSION:4.0\r\n" +
+	"FN:Taco Cat\r\nN:Cat;Taco;;;\r\n" +
+	"EMAIL:taco@example.com\r\n" +
+	"END:VCARD\r\n"
+
+const invalid = "BEGIN:VCARD\r\nVERSION:4.0\r\n" +
+	"FN:Taco Cat\r\nKIND:robot\r\n" +
+	"END:VCARD\r\n"
+
+// what's in out.vcf before the command runs
+const existing = "keep me"
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string // in.vcf, bad.vcf and out.vcf are in the temp directory
+		code   int
+		stdout string // in the output, "" for anything
+		out    string // in out.vcf, "" for anything
+	}{
+		{"no command", nil, exitUsage, "", existing},
+		{"unknown command", []string{"frobnicate"}, exitUsage, "", existing},
+		{"help", []string{"dedupe", "-h"}, exitOK, "", existing},
+		{"missing file", []string{"stats", "missing.vcf"}, exitError, "", existing},
+
+		{"dedupe", []string{"dedupe", "-o", "out.vcf", "in.vcf"}, exitOK, "", "TEL:+1 111 555 1212"},
+		{"dedupe 3.0", []string{"dedupe", "in.vcf", "-o", "out.vcf", "--vcard-version", "3.0"}, exitOK, "", "VERSION:3.0"},
+		{"dedupe dry run", []string{"dedupe", "--dry-run", "in.vcf"}, exitFindings, "1 cards would be merged away", existing},
+		{"dedupe bad version", []string{"dedupe", "--vcard-version", "5.0", "-o", "out.vcf", "in.vcf"}, exitUsage, "", existing},
+		{"dedupe no file", []string{"dedupe", "-o", "out.vcf"}, exitUsage, "", existing},
+
+		{"validate", []string{"validate", "in.vcf"}, exitOK, "2 cards, 0 problems", existing},
+		{"validate findings", []string{"validate", "bad.vcf"}, exitFindings, `KIND: value not allowed "robot"`, existing},
+
+		{"convert", []string{"convert", "--to", "3.0", "-o", "out.vcf", "in.vcf"}, exitOK, "", "VERSION:3.0"},
+		{"convert jcard", []string{"convert", "--to", "jcard", "-o", "out.vcf", "in.vcf"}, exitOK, "", `["vcard",`},
+		{"convert csv", []string{"convert", "--to", "google-csv", "-o", "out.vcf", "in.vcf"}, exitOK, "", "taco@example.com"},
+		{"convert stdout", []string{"convert", "--to", "xcard", "in.vcf"}, exitOK, "<text>Taco Cat</text>", existing},
+		{"convert bad format", []string{"convert", "--to", "5.0", "-o", "out.vcf", "in.vcf"}, exitUsage, "", existing},
+
+		{"stats", []string{"stats", "in.vcf"}, exitOK, "cards after dedupe: 1", existing},
+
+		{"birthdays", []string{"birthdays", "-o", "out.vcf", "in.vcf"}, exitOK, "", "SUMMARY:Taco Cat's birthday (1985)"},
+		{"birthdays bad years", []string{"birthdays", "--years", "-1", "-o", "out.vcf", "in.vcf"}, exitUsage, "", existing},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range map[string]string{"in.vcf": cards, "bad.vcf": invalid, "out.vcf": existing} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			args := make([]string, len(test.args))
+			for i, a := range test.args {
+				if strings.HasSuffix(a, ".vcf") {
+					a = filepath.Join(dir, a)
+				}
+				args[i] = a
+			}
+
+			code, stdout := runCaptured(t, args)
+			if code != test.code {
+				t.Errorf("Expected exit code %d, got %d", test.code, code)
+			}
+			if !strings.Contains(stdout, test.stdout) {
+				t.Errorf("Expected %q in the output\n%s", test.stdout, stdout)
+			}
+			out, err := os.ReadFile(filepath.Join(dir, "out.vcf"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(out), test.out) {
+				t.Errorf("Expected %q in out.vcf\n%s", test.out, out)
+			}
+			if test.out == existing && string(out) != existing {
+				t.Errorf("Expected out.vcf to be left alone, got\n%s", out)
+			}
+		})
+	}
+}
+
+// Runs the command with stdout going to a file, stderr is dropped.
+func runCaptured(t *testing.T, args []string) (int, string) {
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout, os.Stderr = f, devNull
+
+	code := run(args)
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(b)
+}
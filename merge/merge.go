@@ -0,0 +1,558 @@
+package merge
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/dedupe"
+	"ContactCleaner/parsing"
+	"ContactCleaner/photo"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Field string
+
+// single valued fields of contact.ContactCard
+const (
+	Version      Field = "Version"
+	ProdID       Field = "ProdID"
+	UID          Field = "UID"
+	FullName     Field = "FullName"
+	FirstName    Field = "FirstName"
+	LastName     Field = "LastName"
+	MiddleName   Field = "MiddleName"
+	Prefix       Field = "Prefix"
+	Suffix       Field = "Suffix"
+	Phonetic     Field = "Phonetic"
+	Nickname     Field = "Nickname"
+	Organization Field = "Organization"
+	Titles       Field = "Titles"
+	URL          Field = "URL"
+	Notes        Field = "Notes"
+	Birthday     Field = "Birthday"
+	Anniversary  Field = "Anniversary"
+	DeathDate    Field = "DeathDate"
+	Photo        Field = "Photo"
+	Logos        Field = "Logos"
+	Sound        Field = "Sound"
+)
+
+// multi valued fields, these are always unioned
+const (
+	Telephones       Field = "Telephones"
+	Emails           Field = "Emails"
+	Addresses        Field = "Addresses"
+	InstantMessaging Field = "InstantMessaging"
+	Categories       Field = "Categories"
+	SocialProfiles   Field = "SocialProfiles"
+	Items            Field = "Items"
+	ExtendedFields   Field = "ExtendedFields"
+	CustomFields     Field = "CustomFields"
+)
+
+// One of the values a single valued field could take.
+type Candidate struct {
+	Value    string
+	Revision time.Time
+	// position of the card in the slice passed to Merge
+	Index int
+}
+
+// A Strategy picks which candidate to keep and returns its position in
+// candidates. It's only called with two or more non-empty candidates.
+type Strategy func(candidates []Candidate) int
+
+// Keeps the value from the most recently revised card.
+// Cards without a REV count as the oldest, ties go to the first card.
+func PreferNewest(candidates []Candidate) int {
+	best := 0
+	for i, c := range candidates {
+		if c.Revision.After(candidates[best].Revision) {
+			best = i
+		}
+	}
+	return best
+}
+
+// Keeps the first value in card order.
+func PreferNonEmpty(candidates []Candidate) int {
+	return 0
+}
+
+// Keeps the longest value, ties go to the first card.
+func PreferLongest(candidates []Candidate) int {
+	best := 0
+	for i, c := range candidates {
+		if len(c.Value) > len(candidates[best].Value) {
+			best = i
+		}
+	}
+	return best
+}
+
+// Keeps the image with the highest resolution, URLs count as the
+// smallest. Ties go to the first card.
+func PreferLargestImage(candidates []Candidate) int {
+	imgs := make([]contact.Image, len(candidates))
+	for i, c := range candidates {
+		imgs[i] = toImage(c.Value)
+	}
+	return photo.Largest(imgs)
+}
+
+// Keeps the most complete date, 19850415 over --0415 and any date over
+// one only as text. Ties go to the newest card.
+func PreferCompleteDate(candidates []Candidate) int {
+	best := -1
+	var tied []Candidate
+	var index []int
+	for i, c := range candidates {
+		score := dateScore(c.Value)
+		if score > best {
+			best, tied, index = score, nil, nil
+		}
+		if score == best {
+			tied = append(tied, c)
+			index = append(index, i)
+		}
+	}
+	return index[PreferNewest(tied)]
+}
+
+// One for each part of the date that's known, 0 for text.
+func dateScore(s string) int {
+	d, err := parsing.ParseDateOrTime(s)
+	if err != nil || d.IsText() {
+		return 0
+	}
+	score := 1
+	for _, part := range []int{d.Year, d.Month, d.Day} {
+		if part != 0 {
+			score++
+		}
+	}
+	if d.HasTime() {
+		score++
+	}
+	return score
+}
+
+type Options struct {
+	// used for every single valued field not in Fields
+	Default Strategy
+	Fields  map[Field]Strategy
+	// region for phone numbers without a country code, e.g. "US".
+	// When empty it's guessed from the numbers on the cards.
+	Region string
+}
+
+var DefaultOptions = Options{
+	Default: PreferNewest,
+	Fields: map[Field]Strategy{
+		Notes:       PreferLongest,
+		Birthday:    PreferCompleteDate,
+		Anniversary: PreferCompleteDate,
+		DeathDate:   PreferCompleteDate,
+		Photo:       PreferLargestImage,
+		Logos:       PreferLargestImage,
+	},
+}
+
+// A value that didn't make it into the merged card.
+type Conflict struct {
+	Field   Field
+	Kept    string
+	Dropped []string
+}
+
+type Report struct {
+	Conflicts []Conflict
+}
+
+func (r *Report) add(field Field, kept string, dropped []string) {
+	if len(dropped) == 0 {
+		return
+	}
+	for i := range r.Conflicts {
+		if r.Conflicts[i].Field == field && r.Conflicts[i].Kept == kept {
+			r.Conflicts[i].Dropped = append(r.Conflicts[i].Dropped, dropped...)
+			return
+		}
+	}
+	r.Conflicts = append(r.Conflicts, Conflict{Field: field, Kept: kept, Dropped: dropped})
+}
+
+// Merge combines cards into one using the DefaultOptions.
+// The report lists every value that was dropped along the way.
+func Merge(cards []*contact.ContactCard) (*contact.ContactCard, Report) {
+	return MergeWithOptions(cards, DefaultOptions)
+}
+
+// MergeWithOptions is Merge with custom options.
+func MergeWithOptions(cards []*contact.ContactCard, opts Options) (*contact.ContactCard, Report) {
+	merged := &contact.ContactCard{}
+	var report Report
+	if len(cards) == 0 {
+		return merged, report
+	}
+
+	for _, f := range singleFields {
+		strategy := opts.Default
+		if s, ok := opts.Fields[f.name]; ok {
+			strategy = s
+		}
+		if strategy == nil {
+			strategy = PreferNewest
+		}
+		mergeSingle(merged, cards, f, strategy, &report)
+	}
+
+	for _, card := range cards {
+		if card.Revision.After(merged.Revision) {
+			merged.Revision = card.Revision
+		}
+	}
+
+	region := opts.Region
+	if region == "" {
+		region = dedupe.GuessRegion(cards)
+	}
+	mergeTelephones(merged, cards, region, &report)
+	mergeEmails(merged, cards, &report)
+	mergeAddresses(merged, cards)
+	merged.InstantMessaging = unionStrings(cards, InstantMessaging, func(c *contact.ContactCard) []string { return c.InstantMessaging }, &report)
+	merged.Categories = unionStrings(cards, Categories, func(c *contact.ContactCard) []string { return c.Categories }, &report)
+	mergeSocialProfiles(merged, cards)
+	mergeItems(merged, cards)
+	mergeExtendedFields(merged, cards)
+	mergeCustomFields(merged, cards, &report)
+	return merged, report
+}
+
+// how to read and copy a single valued field
+type fieldAccess struct {
+	name Field
+	get  func(c *contact.ContactCard) string
+	set  func(dst, src *contact.ContactCard)
+}
+
+var singleFields = []fieldAccess{
+	{Version, func(c *contact.ContactCard) string { return c.Version }, func(d, s *contact.ContactCard) { d.Version = s.Version }},
+	{ProdID, func(c *contact.ContactCard) string { return c.ProdID }, func(d, s *contact.ContactCard) { d.ProdID = s.ProdID }},
+	{UID, func(c *contact.ContactCard) string { return c.UID }, func(d, s *contact.ContactCard) { d.UID = s.UID }},
+	{FullName, func(c *contact.ContactCard) string { return c.FullName }, func(d, s *contact.ContactCard) { d.FullName = s.FullName }},
+	{FirstName, func(c *contact.ContactCard) string { return c.FirstName }, func(d, s *contact.ContactCard) { d.FirstName = s.FirstName }},
+	{LastName, func(c *contact.ContactCard) string { return c.LastName }, func(d, s *contact.ContactCard) { d.LastName = s.LastName }},
+	{MiddleName, func(c *contact.ContactCard) string { return c.MiddleName }, func(d, s *contact.ContactCard) { d.MiddleName = s.MiddleName }},
+	{Prefix, func(c *contact.ContactCard) string { return c.Prefix }, func(d, s *contact.ContactCard) { d.Prefix = s.Prefix }},
+	{Suffix, func(c *contact.ContactCard) string { return c.Suffix }, func(d, s *contact.ContactCard) { d.Suffix = s.Suffix }},
+	// the parts of a phonetic name go together
+	{Phonetic, func(c *contact.ContactCard) string {
+		return strings.Join([]string{c.PhoneticFirst, c.PhoneticMiddle, c.PhoneticLast}, " ")
+	}, func(d, s *contact.ContactCard) {
+		d.PhoneticFirst, d.PhoneticMiddle, d.PhoneticLast = s.PhoneticFirst, s.PhoneticMiddle, s.PhoneticLast
+	}},
+	{Nickname, func(c *contact.ContactCard) string { return c.Nickname }, func(d, s *contact.ContactCard) { d.Nickname = s.Nickname }},
+	{Organization, func(c *contact.ContactCard) string { return c.Organization }, func(d, s *contact.ContactCard) { d.Organization = s.Organization }},
+	{Titles, func(c *contact.ContactCard) string { return c.Titles }, func(d, s *contact.ContactCard) { d.Titles = s.Titles }},
+	{URL, func(c *contact.ContactCard) string { return c.URL }, func(d, s *contact.ContactCard) { d.URL = s.URL }},
+	{Notes, func(c *contact.ContactCard) string { return c.Notes }, func(d, s *contact.ContactCard) { d.Notes = s.Notes }},
+	{Birthday, func(c *contact.ContactCard) string { return dateString(c.Birthday) }, func(d, s *contact.ContactCard) { d.Birthday = copyDate(s.Birthday) }},
+	{Anniversary, func(c *contact.ContactCard) string { return dateString(c.Anniversary) }, func(d, s *contact.ContactCard) { d.Anniversary = copyDate(s.Anniversary) }},
+	{DeathDate, func(c *contact.ContactCard) string { return dateString(c.DeathDate) }, func(d, s *contact.ContactCard) { d.DeathDate = copyDate(s.DeathDate) }},
+	{Photo, func(c *contact.ContactCard) string { return imageString(c.Photo) }, func(d, s *contact.ContactCard) { d.Photo = s.Photo }},
+	{Logos, func(c *contact.ContactCard) string { return imageString(c.Logos) }, func(d, s *contact.ContactCard) { d.Logos = s.Logos }},
+	{Sound, func(c *contact.ContactCard) string { return imageString(c.Sound) }, func(d, s *contact.ContactCard) { d.Sound = s.Sound }},
+}
+
+// The merged card gets its own date, changing it leaves the cards
+// it came from alone.
+func copyDate(d *contact.DateOrTime) *contact.DateOrTime {
+	if d == nil {
+		return nil
+	}
+	c := *d
+	return &c
+}
+
+func dateString(d *contact.DateOrTime) string {
+	if d == nil {
+		return ""
+	}
+	return d.String()
+}
+
+// Turns an imageString back into an image.
+func toImage(s string) contact.Image {
+	if strings.HasPrefix(strings.ToLower(s), "data:") || !strings.Contains(s, ":") {
+		return contact.EncodedImage(s)
+	}
+	return contact.ImageURL(s)
+}
+
+// Values that look different but mean the same thing.
+var sameValue = map[Field]func(a, b string) bool{
+	Photo:       samePicture,
+	Logos:       samePicture,
+	Birthday:    sameDate,
+	Anniversary: sameDate,
+	DeathDate:   sameDate,
+}
+
+// --0415 is the same birthday as 19850415, only with less of it.
+func sameDate(a, b string) bool {
+	if sameText(a, b) {
+		return true
+	}
+	da, errA := parsing.ParseDateOrTime(a)
+	db, errB := parsing.ParseDateOrTime(b)
+	if errA != nil || errB != nil || da.IsText() || db.IsText() || da.HasTime() != db.HasTime() {
+		return false
+	}
+	agree := func(x, y int) bool { return x == 0 || y == 0 || x == y }
+	return agree(da.Year, db.Year) && agree(da.Month, db.Month) && agree(da.Day, db.Day)
+}
+
+// The same picture at another size or encoding isn't a conflict.
+func samePicture(a, b string) bool {
+	if sameText(a, b) {
+		return true
+	}
+	same, err := photo.Same(toImage(a), toImage(b))
+	return err == nil && same
+}
+
+func imageString(img contact.Image) string {
+	switch img := img.(type) {
+	case contact.EncodedImage:
+		return string(img)
+	case contact.ImageURL:
+		return string(img)
+	}
+	return ""
+}
+
+func mergeSingle(merged *contact.ContactCard, cards []*contact.ContactCard, f fieldAccess, strategy Strategy, report *Report) {
+	var candidates []Candidate
+	for i, card := range cards {
+		if val := f.get(card); strings.TrimSpace(val) != "" {
+			candidates = append(candidates, Candidate{Value: val, Revision: card.Revision, Index: i})
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return
+	case 1:
+		f.set(merged, cards[candidates[0].Index])
+		return
+	}
+
+	keep := candidates[strategy(candidates)]
+	f.set(merged, cards[keep.Index])
+
+	same := sameText
+	if f, ok := sameValue[f.name]; ok {
+		same = f
+	}
+	var dropped []string
+	for _, c := range candidates {
+		if !same(c.Value, keep.Value) && !containsText(dropped, c.Value) {
+			dropped = append(dropped, c.Value)
+		}
+	}
+	report.add(f.name, keep.Value, dropped)
+}
+
+// Numbers that normalize to the same E.164 form are merged into the first
+// one seen and their types are combined.
+func mergeTelephones(merged *contact.ContactCard, cards []*contact.ContactCard, region string, report *Report) {
+	index := make(map[string]int)
+	for _, card := range cards {
+		for _, tel := range card.Telephones {
+			key := dedupe.NormalizeTelephone(tel, region)
+			if key == "" {
+				key = strings.TrimSpace(tel.Number)
+			}
+			if i, ok := index[key]; ok {
+				kept := &merged.Telephones[i]
+				kept.Type = unionTypes(kept.Type, tel.Type)
+				if kept.Label == "" {
+					kept.Label = tel.Label
+				}
+				if tel.Number != kept.Number {
+					report.add(Telephones, kept.Number, []string{tel.Number})
+				}
+				continue
+			}
+			index[key] = len(merged.Telephones)
+			tel.Type = append([]string(nil), tel.Type...)
+			merged.Telephones = append(merged.Telephones, tel)
+		}
+	}
+}
+
+func mergeEmails(merged *contact.ContactCard, cards []*contact.ContactCard, report *Report) {
+	index := make(map[string]int)
+	for _, card := range cards {
+		for _, email := range card.Emails {
+			key := dedupe.NormalizeEmail(email.Address)
+			if i, ok := index[key]; ok {
+				kept := &merged.Emails[i]
+				kept.Type = unionTypes(kept.Type, email.Type)
+				if kept.Label == "" {
+					kept.Label = email.Label
+				}
+				if email.Address != kept.Address {
+					report.add(Emails, kept.Address, []string{email.Address})
+				}
+				continue
+			}
+			index[key] = len(merged.Emails)
+			email.Type = append([]string(nil), email.Type...)
+			merged.Emails = append(merged.Emails, email)
+		}
+	}
+}
+
+func mergeAddresses(merged *contact.ContactCard, cards []*contact.ContactCard) {
+	index := make(map[string]int)
+	for _, card := range cards {
+		for _, adr := range card.Addresses {
+			key := normalizeText(strings.Join([]string{adr.POBox, adr.Extended, adr.Street, adr.City, adr.State, adr.Zip, adr.Country}, "|"))
+			if i, ok := index[key]; ok {
+				kept := &merged.Addresses[i]
+				kept.Type = unionTypes(kept.Type, adr.Type)
+				if kept.Label == "" {
+					kept.Label = adr.Label
+				}
+				continue
+			}
+			index[key] = len(merged.Addresses)
+			adr.Type = append([]string(nil), adr.Type...)
+			merged.Addresses = append(merged.Addresses, adr)
+		}
+	}
+}
+
+func mergeSocialProfiles(merged *contact.ContactCard, cards []*contact.ContactCard) {
+	seen := make(map[string]bool)
+	for _, card := range cards {
+		for _, profile := range card.SocialProfiles {
+			key := normalizeText(profile.Type + "|" + profile.URL)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged.SocialProfiles = append(merged.SocialProfiles, profile)
+		}
+	}
+}
+
+func mergeItems(merged *contact.ContactCard, cards []*contact.ContactCard) {
+	seen := make(map[string]bool)
+	for _, card := range cards {
+		for _, item := range card.Items {
+			// the item number is only a link to the label, cards from
+			// different places number them differently
+			key := fmt.Sprintf("%s|%v|%s|%s", strings.ToUpper(item.ItemName), item.Type, item.ItemValue, normalizeText(item.Label))
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged.Items = append(merged.Items, item)
+		}
+	}
+}
+
+func mergeExtendedFields(merged *contact.ContactCard, cards []*contact.ContactCard) {
+	seen := make(map[string]bool)
+	for _, card := range cards {
+		for _, xf := range card.ExtendedFields {
+			key := fmt.Sprintf("%s|%s|%v|%s", xf.Group, strings.ToUpper(xf.Type), xf.Params, xf.Data)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged.ExtendedFields = append(merged.ExtendedFields, xf)
+		}
+	}
+}
+
+// Keys are unioned, for a key on several cards the newest card wins.
+func mergeCustomFields(merged *contact.ContactCard, cards []*contact.ContactCard, report *Report) {
+	candidates := make(map[string][]Candidate)
+	var keys []string
+	for i, card := range cards {
+		for k, v := range card.CustomFields {
+			if _, ok := candidates[k]; !ok {
+				keys = append(keys, k)
+			}
+			candidates[k] = append(candidates[k], Candidate{Value: v, Revision: card.Revision, Index: i})
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	merged.CustomFields = make(map[string]string)
+	for _, k := range keys {
+		cs := candidates[k]
+		keep := cs[PreferNewest(cs)]
+		merged.CustomFields[k] = keep.Value
+		var dropped []string
+		for _, c := range cs {
+			if c.Value != keep.Value && !containsText(dropped, c.Value) {
+				dropped = append(dropped, c.Value)
+			}
+		}
+		report.add(Field(string(CustomFields)+"."+k), keep.Value, dropped)
+	}
+}
+
+// Unions a []string field ignoring case and surrounding whitespace.
+func unionStrings(cards []*contact.ContactCard, field Field, get func(c *contact.ContactCard) []string, report *Report) []string {
+	var out []string
+	index := make(map[string]int)
+	for _, card := range cards {
+		for _, val := range get(card) {
+			key := normalizeText(val)
+			if key == "" {
+				continue
+			}
+			if i, ok := index[key]; ok {
+				if val != out[i] {
+					report.add(field, out[i], []string{val})
+				}
+				continue
+			}
+			index[key] = len(out)
+			out = append(out, val)
+		}
+	}
+	return out
+}
+
+func unionTypes(a, b []string) []string {
+	for _, t := range b {
+		if !containsText(a, t) {
+			a = append(a, t)
+		}
+	}
+	return a
+}
+
+func normalizeText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func sameText(a, b string) bool {
+	return normalizeText(a) == normalizeText(b)
+}
+
+func containsText(list []string, s string) bool {
+	for _, l := range list {
+		if sameText(l, s) {
+			return true
+		}
+	}
+	return false
+}
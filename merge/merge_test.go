@@ -0,0 +1,164 @@
+package merge
+
+import (
+	"ContactCleaner/contact"
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	older := &contact.ContactCard{
+		Revision:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		FullName:     "Taco Cat",
+		Organization: "Old Tacos",
+		Notes:        "Likes tacos. Also burritos, on Tuesdays.",
+		Categories:   []string{"Friends"},
+		Telephones:   []contact.Telephone{{Type: []string{"cell"}, Number: "(111) 555-1212"}},
+		Emails:       []contact.EmailAddr{{Type: []string{"home"}, Address: "Taco@Example.com"}},
+		CustomFields: map[string]string{"X-SHOE-SIZE": "9"},
+	}
+	newer := &contact.ContactCard{
+		Revision:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		FullName:     "Taco Cat",
+		Titles:       "Head of Tacos",
+		Organization: "New Tacos",
+		Notes:        "Likes tacos.",
+		Categories:   []string{"friends", "work"},
+		Telephones: []contact.Telephone{
+			{Type: []string{"voice"}, Number: "+1 111 555 1212"},
+			{Type: []string{"work"}, Number: "222-555-1313"},
+		},
+		Emails:       []contact.EmailAddr{{Type: []string{"work"}, Address: "taco@example.com"}},
+		CustomFields: map[string]string{"X-SHOE-SIZE": "10"},
+	}
+
+	merged, report := Merge([]*contact.ContactCard{older, newer})
+
+	if merged.Organization != "New Tacos" {
+		t.Errorf("Expected the newest organization, got '%s'", merged.Organization)
+	}
+	if merged.Titles != "Head of Tacos" {
+		t.Errorf("Expected the only title, got '%s'", merged.Titles)
+	}
+	if merged.Notes != older.Notes {
+		t.Errorf("Expected the longest notes, got '%s'", merged.Notes)
+	}
+	if !merged.Revision.Equal(newer.Revision) {
+		t.Errorf("Expected the newest revision, got %v", merged.Revision)
+	}
+	if len(merged.Telephones) != 2 || !slices.Equal(merged.Telephones[0].Type, []string{"cell", "voice"}) {
+		t.Errorf("Unexpected telephones: %+v", merged.Telephones)
+	}
+	if len(merged.Emails) != 1 || !slices.Equal(merged.Emails[0].Type, []string{"home", "work"}) {
+		t.Errorf("Unexpected emails: %+v", merged.Emails)
+	}
+	if !slices.Equal(merged.Categories, []string{"Friends", "work"}) {
+		t.Errorf("Unexpected categories: %v", merged.Categories)
+	}
+	if merged.CustomFields["X-SHOE-SIZE"] != "10" {
+		t.Errorf("Expected the newest custom field, got %v", merged.CustomFields)
+	}
+
+	dropped := make(map[Field][]string)
+	for _, c := range report.Conflicts {
+		dropped[c.Field] = append(dropped[c.Field], c.Dropped...)
+	}
+	expected := map[Field][]string{
+		Organization:                  {"Old Tacos"},
+		Notes:                         {"Likes tacos."},
+		Telephones:                    {"+1 111 555 1212"},
+		Emails:                        {"taco@example.com"},
+		Categories:                    {"friends"},
+		CustomFields + ".X-SHOE-SIZE": {"9"},
+	}
+	for field, vals := range expected {
+		if !slices.Equal(dropped[field], vals) {
+			t.Errorf("Expected %s to drop %v, got %v", field, vals, dropped[field])
+		}
+	}
+	if len(dropped) != len(expected) {
+		t.Errorf("Unexpected conflicts: %+v", report.Conflicts)
+	}
+}
+
+func TestMergeWithOptions(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{FullName: "Taco Cat", Revision: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{FullName: "Taco A. Cat", Revision: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	merged, _ := MergeWithOptions(cards, Options{Default: PreferNonEmpty})
+	if merged.FullName != "Taco Cat" {
+		t.Errorf("Expected the first non-empty name, got '%s'", merged.FullName)
+	}
+	merged, _ = MergeWithOptions(cards, Options{
+		Default: PreferNonEmpty,
+		Fields:  map[Field]Strategy{FullName: PreferLongest},
+	})
+	if merged.FullName != "Taco A. Cat" {
+		t.Errorf("Expected the longest name, got '%s'", merged.FullName)
+	}
+}
+
+func TestMergeDates(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{FullName: "Taco Cat", Birthday: &contact.DateOrTime{Year: 1985, Month: 4, Day: 15}, Anniversary: &contact.DateOrTime{Text: "spring"}},
+		{FullName: "Taco Cat", Birthday: &contact.DateOrTime{Month: 4, Day: 15}, Anniversary: &contact.DateOrTime{Month: 6}, Revision: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	merged, report := Merge(cards)
+	if *merged.Birthday != *cards[0].Birthday {
+		t.Errorf("Expected the birthday with the year, got %+v", merged.Birthday)
+	}
+	if *merged.Anniversary != *cards[1].Anniversary {
+		t.Errorf("Expected a date over text, got %+v", merged.Anniversary)
+	}
+	for _, c := range report.Conflicts {
+		if c.Field == Birthday {
+			t.Errorf("A birthday without the year isn't a conflict: %+v", c)
+		}
+	}
+
+	// the merged card has its own dates
+	merged.Birthday.Day = 16
+	merged.Anniversary.Month = 7
+	if cards[0].Birthday.Day != 15 || cards[1].Anniversary.Month != 6 {
+		t.Errorf("Changing the merged card changed the input: %+v %+v", cards[0].Birthday, cards[1].Anniversary)
+	}
+}
+
+func testPhoto(t *testing.T, size int) contact.Image {
+	m := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			v := uint8((x + y) * 255 / (2 * size))
+			m.Set(x, y, color.RGBA{v, v, 255 - v, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return contact.NewEncodedImage("image/png", buf.Bytes())
+}
+
+func TestMergePhotos(t *testing.T) {
+	small, big := testPhoto(t, 32), testPhoto(t, 96)
+	cards := []*contact.ContactCard{
+		{FullName: "Taco Cat", Photo: small, Revision: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{FullName: "Taco Cat", Photo: big, Revision: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	merged, report := Merge(cards)
+	if merged.Photo != big {
+		t.Errorf("Expected the larger photo to be kept")
+	}
+	// same picture, so nothing was really dropped
+	for _, c := range report.Conflicts {
+		if c.Field == Photo {
+			t.Errorf("Expected no photo conflict, got %d dropped", len(c.Dropped))
+		}
+	}
+}
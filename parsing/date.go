@@ -0,0 +1,191 @@
+package parsing
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/vcard"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDateOrTime reads a vCard date-and-or-time value in the basic
+// or extended ISO 8601 format, including the reduced (1985-04),
+// truncated (--0415, ---15) and time only (T1030) forms.
+// https://tools.ietf.org/html/rfc6350#section-4.3
+func ParseDateOrTime(s string) (contact.DateOrTime, error) {
+	s = strings.TrimSpace(s)
+	var d contact.DateOrTime
+	datePart, timePart, hasTime := strings.Cut(s, "T")
+	if datePart == "" && !hasTime {
+		return d, ErrInvalidDate
+	}
+	if datePart != "" && !parseDatePart(&d, datePart) {
+		return d, ErrInvalidDate
+	}
+	if hasTime && !parseTimePart(&d, timePart) {
+		return d, ErrInvalidDate
+	}
+	return d, nil
+}
+
+// 19850415, 1985-04-15, 1985-04, 1985, --0415, --04-15, --04, ---15
+func parseDatePart(d *contact.DateOrTime, s string) bool {
+	switch {
+	case strings.HasPrefix(s, "---"):
+		d.Day, _ = digits(s[3:], 2)
+		return validDate(d) && d.Day != 0
+	case strings.HasPrefix(s, "--"):
+		rest := strings.ReplaceAll(s[2:], "-", "")
+		var ok bool
+		if d.Month, ok = digits(rest[:min(2, len(rest))], 2); !ok || d.Month == 0 {
+			return false
+		}
+		if len(rest) > 2 {
+			if d.Day, ok = digits(rest[2:], 2); !ok || d.Day == 0 {
+				return false
+			}
+		}
+		return validDate(d)
+	}
+
+	var ok bool
+	if d.Year, ok = digits(s[:min(4, len(s))], 4); !ok {
+		return false
+	}
+	rest := s[4:]
+	switch {
+	case rest == "":
+	case len(rest) == 4 && !strings.Contains(rest, "-"):
+		// 19850415
+		d.Month, _ = digits(rest[:2], 2)
+		d.Day, ok = digits(rest[2:], 2)
+		ok = ok && d.Month != 0 && d.Day != 0
+	case strings.HasPrefix(rest, "-"):
+		// 1985-04 or 1985-04-15
+		parts := strings.Split(rest[1:], "-")
+		if len(parts) > 2 {
+			return false
+		}
+		d.Month, ok = digits(parts[0], 2)
+		ok = ok && d.Month != 0
+		if ok && len(parts) == 2 {
+			d.Day, ok = digits(parts[1], 2)
+			ok = ok && d.Day != 0
+		}
+	default:
+		return false
+	}
+	return ok && validDate(d)
+}
+
+// 103000, 1030, 10, -3000, --00, each with an optional zone
+// (Z, -0500, +05:30) and seconds fraction, which is dropped.
+func parseTimePart(d *contact.DateOrTime, s string) bool {
+	if s == "" {
+		return false
+	}
+	s, d.Zone = splitZone(s)
+	if i := strings.IndexAny(s, ".,"); i >= 0 {
+		s = s[:i]
+	}
+
+	var ok bool
+	switch {
+	case strings.HasPrefix(s, "--"):
+		d.Second, ok = digits(s[2:], 2)
+		d.HasSecond = true
+	case strings.HasPrefix(s, "-"):
+		rest := strings.ReplaceAll(s[1:], ":", "")
+		d.Minute, ok = digits(rest[:min(2, len(rest))], 2)
+		d.HasMinute = true
+		if ok && len(rest) > 2 {
+			d.Second, ok = digits(rest[2:], 2)
+			d.HasSecond = true
+		}
+	default:
+		rest := strings.ReplaceAll(s, ":", "")
+		d.Hour, ok = digits(rest[:min(2, len(rest))], 2)
+		d.HasHour = true
+		if ok && len(rest) > 2 {
+			d.Minute, ok = digits(rest[2:min(4, len(rest))], 2)
+			d.HasMinute = true
+		}
+		if ok && len(rest) > 4 {
+			d.Second, ok = digits(rest[4:], 2)
+			d.HasSecond = true
+		}
+	}
+	return ok && d.Hour <= 23 && d.Minute <= 59 && d.Second <= 60
+}
+
+// Splits off a trailing Z or UTC offset. The zone is returned in the
+// basic format, -0500.
+func splitZone(s string) (string, string) {
+	if strings.HasSuffix(s, "Z") || strings.HasSuffix(s, "z") {
+		return s[:len(s)-1], "Z"
+	}
+	// a leading - is a truncated time, not an offset
+	i := strings.LastIndexAny(s, "+-")
+	if i <= 0 || s[i-1] == '-' {
+		return s, ""
+	}
+	zone := strings.ReplaceAll(s[i:], ":", "")
+	if len(zone) == 3 {
+		zone += "00"
+	}
+	if _, ok := digits(zone[1:], 4); !ok {
+		return s, ""
+	}
+	return s[:i], zone
+}
+
+// Reads exactly n digits.
+func digits(s string, n int) (int, bool) {
+	if len(s) != n {
+		return 0, false
+	}
+	v := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		v = v*10 + int(s[i]-'0')
+	}
+	return v, true
+}
+
+// The day has to be in the month, without a year February 29 is fine.
+func validDate(d *contact.DateOrTime) bool {
+	if d.Month > 12 || d.Day > 31 {
+		return false
+	}
+	if d.Month == 0 || d.Day == 0 {
+		return true
+	}
+	year := d.Year
+	if year == 0 {
+		// a leap year
+		year = 2000
+	}
+	// day 0 of the next month is the last one of this month
+	return d.Day <= time.Date(year, time.Month(d.Month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// Reads a BDAY, ANNIVERSARY or DEATHDATE. Anything that isn't a
+// date is kept as text so nothing is lost.
+// Apple writes year-less birthdays as 1604-04-15 with X-APPLE-OMIT-YEAR=1604.
+func parseDateProp(prop vcard.Property) contact.DateOrTime {
+	for _, v := range prop.GetParam(vcard.VALUE_PARAM) {
+		if strings.EqualFold(v, "text") {
+			return contact.DateOrTime{Text: prop.Text()}
+		}
+	}
+	d, err := ParseDateOrTime(string(prop.Value))
+	if err != nil {
+		return contact.DateOrTime{Text: prop.Text()}
+	}
+	if omit := prop.GetParam("X-APPLE-OMIT-YEAR"); len(omit) > 0 && omit[0] == strconv.Itoa(d.Year) {
+		d.Year = 0
+	}
+	return d
+}
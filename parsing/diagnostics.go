@@ -0,0 +1,91 @@
+package parsing
+
+import (
+	"ContactCleaner/vcard"
+	"errors"
+)
+
+type Mode int
+
+const (
+	// Lenient skips or repairs what it can and keeps going.
+	// Every problem is recorded as a Diagnostic.
+	Lenient Mode = iota
+	// Strict stops at the first spec violation.
+	Strict
+)
+
+type Severity int
+
+const (
+	// The value was kept as it was or repaired, nothing is lost.
+	SeverityWarning Severity = iota
+	// A line was dropped or a card was cut short.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a problem found in the input.
+// Err is usually a *vcard.ParseError wrapping one of the sentinel errors.
+type Diagnostic struct {
+	Line     int
+	Severity Severity
+	Err      error
+}
+
+// e.g. warning: line 4: BDAY: invalid date "last tuesday"
+func (d Diagnostic) Error() string {
+	return d.Severity.String() + ": " + d.Err.Error()
+}
+
+func (d Diagnostic) Unwrap() error {
+	return d.Err
+}
+
+type Option func(*Parser)
+
+// WithMode sets how the parser handles invalid input, Lenient is the default.
+func WithMode(m Mode) Option {
+	return func(p *Parser) {
+		p.mode = m
+	}
+}
+
+// Diagnostics returns every problem found so far, in the order of the input.
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+// Records a problem. In strict mode the error is returned so the
+// caller can stop, in lenient mode it returns nil.
+func (p *Parser) report(severity Severity, err error) error {
+	line := 0
+	var pe *vcard.ParseError
+	if errors.As(err, &pe) {
+		line = pe.Line
+	}
+	p.diagnostics = append(p.diagnostics, Diagnostic{Line: line, Severity: severity, Err: err})
+	if p.mode == Strict {
+		return err
+	}
+	return nil
+}
+
+// Records every error joined together in err.
+func (p *Parser) reportAll(severity Severity, err error) error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if err := p.report(severity, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return p.report(severity, err)
+}
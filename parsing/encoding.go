@@ -0,0 +1,236 @@
+package parsing
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/vcard"
+	"bufio"
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var ErrUnknownCharset = errors.New("unknown charset")
+
+// Windows-1252 characters in 0x80-0x9F, the rest of the code page
+// is the same as Latin-1. 0 marks the unused ones.
+// https://www.unicode.org/Public/MAPPINGS/VENDORS/MICSFT/WINDOWS/CP1252.TXT
+var windows1252 = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+// Decodes b from charset to UTF-8.
+func decodeCharset(b []byte, charset string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return string(b), nil
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes), nil
+	case "windows-1252", "cp1252":
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+			if c >= 0x80 && c <= 0x9F && windows1252[c-0x80] != 0 {
+				runes[i] = windows1252[c-0x80]
+			}
+		}
+		return string(runes), nil
+	case "utf-16", "utf16":
+		// big endian unless there is a BOM
+		if len(b) >= 2 && b[0] == 0xFF && b[1] == 0xFE {
+			return decodeUTF16(b[2:], false), nil
+		}
+		if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+			b = b[2:]
+		}
+		return decodeUTF16(b, true), nil
+	case "utf-16le":
+		return decodeUTF16(b, false), nil
+	case "utf-16be":
+		return decodeUTF16(b, true), nil
+	}
+	return "", ErrUnknownCharset
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		} else {
+			units[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// Returns true if the property value is quoted-printable,
+// ENCODING=QUOTED-PRINTABLE or a bare QUOTED-PRINTABLE in 2.1.
+func isQuotedPrintable(prop vcard.Property) bool {
+	for _, enc := range prop.GetParam(vcard.ENCODING_PARAM) {
+		if strings.EqualFold(enc, "quoted-printable") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the property value is inline base64,
+// ENCODING=b in 3.0 and ENCODING=BASE64 in 2.1.
+func isBase64(prop vcard.Property) bool {
+	for _, enc := range prop.GetParam(vcard.ENCODING_PARAM) {
+		if strings.EqualFold(enc, "b") || strings.EqualFold(enc, "base64") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true for inline data in a 4.0 data: URI.
+func isDataURI(prop vcard.Property) bool {
+	_, _, ok := contact.SplitDataURI(string(prop.Value))
+	return ok
+}
+
+// Turns quoted-printable and non UTF-8 values into plain UTF-8 so the
+// rest of the parser doesn't have to care. The ENCODING and CHARSET
+// params go away once the value is decoded, the writer adds them back
+// if the version needs them.
+// Values in 2.1 without a CHARSET that aren't valid UTF-8 are read as
+// Windows-1252, which is what old Outlook exports use.
+func decodeValue(prop *vcard.Property) error {
+	qp := isQuotedPrintable(*prop)
+	charsets := prop.GetParam(vcard.CHARSET_PARAM)
+	if !qp && len(charsets) == 0 && utf8.ValidString(string(prop.Value)) {
+		return nil
+	}
+
+	raw := []byte(prop.Value)
+	if qp {
+		decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(string(prop.Value))))
+		if err != nil {
+			return &vcard.ParseError{Line: prop.Line, Property: prop.Name, Param: vcard.ENCODING_PARAM, Value: string(prop.Value), Err: err}
+		}
+		raw = decoded
+	}
+
+	charset := ""
+	if len(charsets) > 0 {
+		charset = charsets[0]
+	} else if !utf8.Valid(raw) {
+		charset = "windows-1252"
+	}
+	value, err := decodeCharset(raw, charset)
+	if err != nil {
+		return &vcard.ParseError{Line: prop.Line, Property: prop.Name, Param: vcard.CHARSET_PARAM, Value: charset, Err: err}
+	}
+	if qp {
+		// decoded line breaks go back to the escaped form Value is kept in
+		value = strings.ReplaceAll(value, "\r\n", "\n")
+		value = strings.ReplaceAll(value, "\n", `\n`)
+	}
+
+	prop.Value = vcard.PropValue(value)
+	params := prop.Params[:0]
+	for _, p := range prop.Params {
+		name := vcard.ParamName(strings.ToUpper(string(p.GetName())))
+		if name == vcard.CHARSET_PARAM || (name == vcard.ENCODING_PARAM && qp) {
+			continue
+		}
+		params = append(params, p)
+	}
+	prop.Params = params
+	return nil
+}
+
+// Strips a UTF-8 byte order mark and turns UTF-16 input, which
+// Windows exports as "Unicode", into UTF-8.
+func decodeBOM(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	bom, _ := br.Peek(3)
+	switch {
+	case len(bom) >= 3 && bom[0] == 0xEF && bom[1] == 0xBB && bom[2] == 0xBF:
+		br.Discard(3)
+	case len(bom) >= 2 && bom[0] == 0xFF && bom[1] == 0xFE:
+		br.Discard(2)
+		return &utf16Reader{r: br}
+	case len(bom) >= 2 && bom[0] == 0xFE && bom[1] == 0xFF:
+		br.Discard(2)
+		return &utf16Reader{r: br, bigEndian: true}
+	}
+	return br
+}
+
+// utf16Reader reads UTF-16 and returns UTF-8.
+type utf16Reader struct {
+	r         *bufio.Reader
+	bigEndian bool
+	buf       []byte  // decoded bytes not returned yet
+	next      *uint16 // the unit after a lone high surrogate
+}
+
+func (ur *utf16Reader) Read(p []byte) (int, error) {
+	for len(ur.buf) == 0 {
+		r, err := ur.readRune()
+		if err != nil {
+			return 0, err
+		}
+		ur.buf = utf8.AppendRune(ur.buf, r)
+	}
+	n := copy(p, ur.buf)
+	ur.buf = ur.buf[n:]
+	return n, nil
+}
+
+func (ur *utf16Reader) readUnit() (uint16, error) {
+	if ur.next != nil {
+		u := *ur.next
+		ur.next = nil
+		return u, nil
+	}
+	var b [2]byte
+	if _, err := io.ReadFull(ur.r, b[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			// a stray odd byte at the end
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+	if ur.bigEndian {
+		return uint16(b[0])<<8 | uint16(b[1]), nil
+	}
+	return uint16(b[1])<<8 | uint16(b[0]), nil
+}
+
+func (ur *utf16Reader) readRune() (rune, error) {
+	u, err := ur.readUnit()
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(rune(u)) {
+		return rune(u), nil
+	}
+	if u >= 0xDC00 {
+		// a low surrogate on its own
+		return utf8.RuneError, nil
+	}
+	u2, err := ur.readUnit()
+	if err != nil {
+		return utf8.RuneError, nil
+	}
+	r := utf16.DecodeRune(rune(u), rune(u2))
+	if r == utf8.RuneError {
+		// no low surrogate after it, u2 is read again as its own unit
+		ur.next = &u2
+	}
+	return r, nil
+}
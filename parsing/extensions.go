@@ -0,0 +1,173 @@
+package parsing
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/vcard"
+	"strings"
+)
+
+// Android contact_event types
+// https://developer.android.com/reference/android/provider/ContactsContract.CommonDataKinds.Event
+const (
+	androidAnniversary = "1"
+	androidBirthday    = "3"
+)
+
+// Android relation types, in the labels Apple uses where it has one.
+// https://developer.android.com/reference/android/provider/ContactsContract.CommonDataKinds.Relation
+var androidRelations = map[string]string{
+	"1":  "Assistant",
+	"2":  "Brother",
+	"3":  "Child",
+	"4":  "Partner",
+	"5":  "Father",
+	"6":  "Friend",
+	"7":  "Manager",
+	"8":  "Mother",
+	"9":  "Parent",
+	"10": "Partner",
+	"11": "Referred by",
+	"12": "Relative",
+	"13": "Sister",
+	"14": "Spouse",
+}
+
+// Moves the vendor X- properties that have a typed field into it.
+// Everything else is kept, plain X-NAME:value lines in CustomFields and
+// the ones with a group or parameters in ExtendedFields.
+func parseExtension(card *contact.ContactCard, prop vcard.Property, label string) {
+	if scheme, ok := vcard.IM_SCHEMES[prop.Name]; ok {
+		handle := strings.TrimSpace(prop.Text())
+		if !strings.Contains(handle, ":") {
+			handle = scheme + ":" + handle
+		}
+		card.InstantMessaging = append(card.InstantMessaging, handle)
+		return
+	}
+
+	switch prop.Name {
+	case vcard.X_TWITTER:
+		handle := strings.TrimPrefix(strings.TrimSpace(prop.Text()), "@")
+		if !strings.Contains(handle, "/") {
+			handle = "https://twitter.com/" + handle
+		}
+		card.SocialProfiles = append(card.SocialProfiles, contact.SocialMediaProfile{Type: "twitter", URL: handle})
+		return
+
+	case vcard.X_SOCIALPROFILE:
+		card.SocialProfiles = append(card.SocialProfiles, parseSocialProfile(prop))
+		return
+
+	case vcard.X_PHONETIC_FIRST_NAME:
+		setOnce(card, &card.PhoneticFirst, prop, prop.Text())
+		return
+	case vcard.X_PHONETIC_MIDDLE_NAME:
+		setOnce(card, &card.PhoneticMiddle, prop, prop.Text())
+		return
+	case vcard.X_PHONETIC_LAST_NAME:
+		setOnce(card, &card.PhoneticLast, prop, prop.Text())
+		return
+
+	case vcard.X_ABDATE:
+		// item1.X-ABDATE:2010-06-01 with item1.X-ABLabel:_$!<Anniversary>!$_
+		if strings.EqualFold(label, "Anniversary") && card.Anniversary == nil {
+			d := parseDateProp(prop)
+			card.Anniversary = &d
+			return
+		}
+		if label != "" {
+			addItem(card, prop, label)
+			return
+		}
+
+	case vcard.X_ANDROID_CUSTOM:
+		if parseAndroidCustom(card, prop) {
+			return
+		}
+	}
+	addCustom(card, prop)
+}
+
+// X-ANDROID-CUSTOM holds a row of the Android contacts database, the
+// MIME type of the row and then its data columns.
+// e.g. X-ANDROID-CUSTOM:vnd.android.cursor.item/nickname;Tac;1;;;;;;;;;;;;;
+// Returns false for the rows that have no typed field.
+func parseAndroidCustom(card *contact.ContactCard, prop vcard.Property) bool {
+	comps := prop.Components()
+	for len(comps) < 4 {
+		comps = append(comps, "")
+	}
+	mimeType, data, kind, customLabel := comps[0], comps[1], comps[2], comps[3]
+	if data == "" {
+		return false
+	}
+
+	switch mimeType {
+	case "vnd.android.cursor.item/nickname":
+		if card.Nickname != "" {
+			return false
+		}
+		card.Nickname = data
+		return true
+
+	case "vnd.android.cursor.item/contact_event":
+		field := &card.Anniversary
+		switch kind {
+		case androidAnniversary:
+		case androidBirthday:
+			field = &card.Birthday
+		default:
+			return false
+		}
+		d, err := ParseDateOrTime(data)
+		if err != nil || *field != nil {
+			return false
+		}
+		*field = &d
+		return true
+
+	case "vnd.android.cursor.item/relation":
+		label := customLabel
+		if l, ok := androidRelations[kind]; ok {
+			label = l
+		}
+		if label == "" {
+			return false
+		}
+		card.Items = append(card.Items, contact.Item{
+			ItemName:  vcard.X_ABRELATEDNAMES,
+			ItemValue: vcard.Escape(data),
+			Label:     label,
+		})
+		return true
+	}
+	return false
+}
+
+// SOCIALPROFILE;SERVICE-TYPE=Twitter:https://twitter.com/taco and
+// Apple's X-SOCIALPROFILE;type=twitter:https://twitter.com/taco
+func parseSocialProfile(prop vcard.Property) contact.SocialMediaProfile {
+	profile := contact.SocialMediaProfile{URL: strings.TrimSpace(prop.Text())}
+	if service := prop.GetParam(vcard.SERVICE_TYPE_PARAM); len(service) > 0 {
+		profile.Type = strings.ToLower(service[0])
+	} else if types := prop.Types(); len(types) > 0 {
+		profile.Type = types[0]
+	}
+	return profile
+}
+
+// Keeps an X- property nothing else knows about. A plain one goes into
+// CustomFields: no group or parameters, only there once, and a value
+// that escapes back to the same text.
+func addCustom(card *contact.ContactCard, prop vcard.Property) {
+	name := string(prop.Name)
+	_, seen := card.CustomFields[name]
+	if seen || prop.Group != "" || len(prop.Params) > 0 || vcard.Escape(prop.Text()) != string(prop.Value) {
+		addExtended(card, prop)
+		return
+	}
+	if card.CustomFields == nil {
+		card.CustomFields = make(map[string]string)
+	}
+	card.CustomFields[name] = prop.Text()
+}
@@ -0,0 +1,98 @@
+package parsing
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// lineReader reads logical content lines.
+// Folded lines (a line break followed by a space or tab) are joined back
+// together before they are returned, per RFC 6350 section 3.2.
+// Handles both CRLF and bare LF line endings.
+type lineReader struct {
+	r    *bufio.Reader
+	line int // number of the last physical line read
+	// physical line the last logical line started on
+	start int
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// reads one physical line without its line ending
+func (lr *lineReader) readPhysical() (string, error) {
+	s, err := lr.r.ReadString('\n')
+	if err != nil && (err != io.EOF || s == "") {
+		return "", err
+	}
+	lr.line++
+	s = strings.TrimSuffix(s, "\n")
+	s = strings.TrimSuffix(s, "\r")
+	return s, nil
+}
+
+// returns true if the next physical line is a continuation of the current one
+func (lr *lineReader) folded() bool {
+	b, err := lr.r.Peek(1)
+	if err != nil {
+		return false
+	}
+	return b[0] == ' ' || b[0] == '\t'
+}
+
+// Next returns the next unfolded logical line.
+// Returns io.EOF when the input is exhausted.
+func (lr *lineReader) Next() (string, error) {
+	line, err := lr.readPhysical()
+	if err != nil {
+		return "", err
+	}
+	lr.start = lr.line
+
+	// 2.1 quoted-printable values continue after a soft line break,
+	// a trailing =. The next line is taken as it is, a leading space
+	// is part of the value and not a fold.
+	if quotedPrintableLine(line) {
+		for strings.HasSuffix(line, "=") {
+			cont, err := lr.readPhysical()
+			if err != nil {
+				break
+			}
+			line = line[:len(line)-1] + cont
+		}
+		return line, nil
+	}
+
+	if !lr.folded() {
+		return line, nil
+	}
+	var sb strings.Builder
+	sb.WriteString(line)
+	for lr.folded() {
+		cont, err := lr.readPhysical()
+		if err != nil {
+			return "", err
+		}
+		// only the single leading whitespace character belongs to the fold
+		sb.WriteString(cont[1:])
+	}
+	return sb.String(), nil
+}
+
+// Line returns the physical line number the last logical line started on.
+func (lr *lineReader) Line() int {
+	return lr.start
+}
+
+// Returns true if the parameters of line say its value is quoted-printable.
+func quotedPrintableLine(line string) bool {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return false
+	}
+	return strings.Contains(strings.ToUpper(line[:i]), "QUOTED-PRINTABLE")
+}
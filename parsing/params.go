@@ -0,0 +1,257 @@
+package parsing
+
+import (
+	"ContactCleaner/vcard"
+	"errors"
+	"strings"
+)
+
+// Splits the part of a line before the colon into the property name
+// and its parameters, ignoring separators inside quoted values.
+// e.g. item1.ADR;LABEL="Main St; Any Town";TYPE=home
+func splitParams(s string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Finds the colon between the parameters and the value, colons in
+// quoted parameter values (GEO="geo:...") don't count.
+func indexColon(line string) int {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Splits a parameter value on commas outside of quotes, removes the
+// quotes and decodes the caret escapes in each value.
+// e.g. "work",voice -> [work voice]
+func splitParamValues(s string) []string {
+	var vals []string
+	var sb strings.Builder
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if quoted {
+				sb.WriteByte(',')
+				continue
+			}
+			vals = append(vals, decodeCaret(sb.String()))
+			sb.Reset()
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return append(vals, decodeCaret(sb.String()))
+}
+
+// Removes the quotes around a parameter value and decodes its caret
+// escapes, commas are part of the value.
+func unquoteParamValue(s string) string {
+	return decodeCaret(strings.ReplaceAll(s, `"`, ""))
+}
+
+// Decodes RFC 6868 escapes: ^n is a newline, ^' a double quote and
+// ^^ a caret. A caret followed by anything else is left alone.
+// https://tools.ietf.org/html/rfc6868#section-3.1
+func decodeCaret(s string) string {
+	if !strings.Contains(s, "^") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '^' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case 'n', 'N':
+			sb.WriteByte('\n')
+		case '\'':
+			sb.WriteByte('"')
+		case '^':
+			sb.WriteByte('^')
+		default:
+			sb.WriteByte('^')
+			continue
+		}
+		i++
+	}
+	return sb.String()
+}
+
+// Parses the parameters of a property line. Each one goes through its
+// vcard.New*Param constructor. Parameters that fail validation are kept
+// as a plain vcard.BaseParam so nothing is lost, the validation errors
+// are returned joined together.
+func parseParams(raw []string, prop vcard.PropName, value string) ([]vcard.Param, error) {
+	var params []vcard.Param
+	var errs []error
+	// position of the TYPE param built from bare 2.1 types
+	bareTypes := -1
+	for _, param := range raw {
+		if param == "" {
+			continue
+		}
+		pname, pval, found := strings.Cut(param, vcard.EQUAL)
+		name := vcard.ParamName(strings.ToUpper(strings.TrimSpace(pname)))
+		if !found {
+			// 2.1 allows the value without the name, TEL;HOME;VOICE or
+			// NOTE;QUOTED-PRINTABLE. They're collected into one TYPE param.
+			switch name {
+			case "QUOTED-PRINTABLE", "BASE64", "8BIT", "7BIT":
+				name, pval = vcard.ENCODING_PARAM, string(name)
+			default:
+				if bareTypes >= 0 {
+					var err error
+					params[bareTypes], err = appendType(params[bareTypes], strings.ToLower(string(name)), prop)
+					if err != nil {
+						errs = append(errs, err)
+					}
+					continue
+				}
+				bareTypes = len(params)
+				name, pval = vcard.TYPE_PARAM, strings.ToLower(string(name))
+			}
+		}
+
+		p, err := newParam(name, pval, prop, value)
+		if err != nil {
+			var pe *vcard.ParseError
+			if errors.As(err, &pe) {
+				pe.Property = prop
+			}
+			errs = append(errs, err)
+			p = &vcard.BaseParam{Name: name, Val: splitParamValues(pval)}
+		}
+		params = append(params, p)
+	}
+	return params, errors.Join(errs...)
+}
+
+// Adds a type to a TYPE param, it stays typed if the type is valid.
+func appendType(param vcard.Param, typ string, prop vcard.PropName) (vcard.Param, error) {
+	_, err := vcard.NewTypeParam(typ, prop)
+	if tp, ok := param.(*vcard.TypeParam); ok && err == nil {
+		tp.Val = append(tp.Val, typ)
+		return tp, nil
+	}
+	var pe *vcard.ParseError
+	if errors.As(err, &pe) {
+		pe.Property = prop
+	}
+	return &vcard.BaseParam{Name: vcard.TYPE_PARAM, Val: append(param.GetVal(), typ)}, err
+}
+
+// Builds the typed parameter for name. Only TYPE, PID, SORT-AS and
+// unknown parameters can have more than one value, for the rest a
+// comma is part of the value. The lists of TYPE, PID and SORT-AS can
+// be quoted as a whole, TYPE="work,voice".
+func newParam(name vcard.ParamName, raw string, prop vcard.PropName, value string) (vcard.Param, error) {
+	val := unquoteParamValue(raw)
+	list := strings.Split(val, vcard.COMMA)
+	switch name {
+	case vcard.TYPE_PARAM:
+		var tp *vcard.TypeParam
+		for _, v := range list {
+			next, err := vcard.NewTypeParam(v, prop)
+			if err != nil {
+				return nil, err
+			}
+			if tp == nil {
+				tp = next
+				continue
+			}
+			tp.Val = append(tp.Val, next.Val...)
+		}
+		return tp, nil
+	case vcard.PID_PARAM:
+		var pp *vcard.PIDParam
+		for _, v := range list {
+			next, err := vcard.NewPIDParam(v)
+			if err != nil {
+				return nil, err
+			}
+			if pp == nil {
+				pp = next
+				continue
+			}
+			pp.Val = append(pp.Val, next.Val...)
+		}
+		return pp, nil
+	case vcard.SORTAS_PARAM:
+		comps := len(vcard.SplitUnescaped(value, ';'))
+		return vcard.NewSortAsParam(val, comps)
+	case vcard.LANGUAGE_PARAM:
+		return vcard.NewLanguageParam(val)
+	case vcard.VALUE_PARAM:
+		return vcard.NewValueParam(val)
+	case vcard.PREF_PARAM:
+		return vcard.NewPrefParam(val)
+	case vcard.ALTID_PARAM:
+		return vcard.NewAltIdParam(val)
+	case vcard.MEDIATYPE_PARAM:
+		return vcard.NewMediatypeParam(val)
+	case vcard.CALSCALE_PARAM:
+		return vcard.NewCalscaleParam(val)
+	case vcard.GEO_PARAM:
+		return vcard.NewGeoParam(val)
+	case vcard.TZ_PARAM:
+		return vcard.NewTzParam(val)
+	case vcard.INDEX_PARAM:
+		return vcard.NewIndexParam(val)
+	case vcard.LEVEL_PARAM:
+		return vcard.NewLevelParam(val)
+	case vcard.GROUP_PARAM:
+		return vcard.NewGroupParam(val)
+	case vcard.CC_PARAM:
+		return vcard.NewCcParam(val)
+	case vcard.AUTHOR_PARAM:
+		return vcard.NewAuthorParam(val)
+	case vcard.AUTHOR_NAME_PARAM:
+		return vcard.NewAuthorNameParam(val)
+	case vcard.CREATED_PARAM:
+		return vcard.NewCreatedParam(val)
+	case vcard.DERIVED_PARAM:
+		return vcard.NewDerivedParam(val)
+	case vcard.LABEL_PARAM:
+		return vcard.NewLabelParam(val)
+	case vcard.PHONETIC_PARAM:
+		return vcard.NewPhoneticParam(val)
+	case vcard.PROP_ID_PARAM:
+		return vcard.NewPropIDParam(val)
+	case vcard.SCRIPT_PARAM:
+		return vcard.NewScriptParam(val)
+	case vcard.SERVICE_TYPE_PARAM:
+		return vcard.NewServiceTypeParam(val)
+	case vcard.USERNAME_PARAM:
+		return vcard.NewUsernameParam(val)
+	case vcard.JSPTR_PARAM:
+		return vcard.NewJsptrParam(val)
+	}
+	return &vcard.BaseParam{Name: name, Val: splitParamValues(raw)}, nil
+}
@@ -3,166 +3,655 @@ package parsing
 import (
 	"ContactCleaner/contact"
 	"ContactCleaner/vcard"
-	"bufio"
 	"errors"
+	"io"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Parser struct {
-	error        error
-	currentCard  *contact.ContactCard
-	scanner      *bufio.Scanner
-	currentLine  string
-	base64Flag   bool
-	b64BuffDaddy []byte
+	error       error
+	currentCard *vcard.VCard
+	lines       *lineReader
+	currentLine string
+	base64Flag  bool
+	mode        Mode
+	diagnostics []Diagnostic
 }
 
-func NewParser() *Parser {
-	return &Parser{}
+var (
+	ErrUnexpectedEOF = errors.New("unexpected end of input: missing END:VCARD")
+	ErrInvalidLine   = errors.New("line is not a property, it has no colon")
+	ErrInvalidDate   = errors.New("invalid date")
+	ErrNestedBegin   = errors.New("BEGIN:VCARD before the END:VCARD of the card")
+	ErrUnexpectedEnd = errors.New("END:VCARD without a BEGIN:VCARD")
+)
+
+// Creates a new Parser that reads vCards from r.
+// A single input can hold any number of cards, call Next
+// until it returns io.EOF to read them all.
+// The input can be UTF-8 or UTF-16 with a byte order mark.
+// By default the parser is lenient, see WithMode.
+func NewParser(r io.Reader, opts ...Option) *Parser {
+	p := &Parser{
+		lines: newLineReader(decodeBOM(r)),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
-func (p *Parser) NextLine() {
-	p.currentLine = p.scanner.Text()
+// NextLine advances to the next unfolded line of input.
+// Returns false when there is nothing left to read or reading failed.
+func (p *Parser) NextLine() bool {
+	line, err := p.lines.Next()
+	if err != nil {
+		if err != io.EOF {
+			p.error = err
+		}
+		return false
+	}
+	p.currentLine = line
+	return true
 }
 
-func (p *Parser) Parse() (*contact.ContactCard, error) {
-	// Parse the vCard string
-	var err error
+// Parse reads every remaining card from the input.
+// In lenient mode it only fails if reading fails.
+func (p *Parser) Parse() ([]*contact.ContactCard, error) {
+	var cards []*contact.ContactCard
+	for {
+		card, err := p.Next()
+		if err == io.EOF {
+			return cards, nil
+		}
+		if err != nil {
+			return cards, err
+		}
+		cards = append(cards, card)
+	}
+}
+
+// Next reads the next card from the input.
+// It returns io.EOF once there are no more cards.
+func (p *Parser) Next() (*contact.ContactCard, error) {
+	v, err := p.NextVCard()
+	if err != nil {
+		return nil, err
+	}
+	return ToContact(v)
+}
 
-	for p.scanner.Scan() {
-		if p.error != nil {
-			return nil, p.error
+// NextVCard reads the next card from the input as its property lines.
+// Nothing is dropped, unknown and X- properties are kept as they are.
+// It returns io.EOF once there are no more cards.
+func (p *Parser) NextVCard() (*vcard.VCard, error) {
+	for p.NextLine() {
+		if p.currentLine == "" {
+			// a blank line ends a 2.1 base64 block
+			p.base64Flag = false
+			continue
 		}
+
 		// If we are in the middle of a base64 encoded block, keep reading until we find the end
 		if p.base64Flag {
-			p.parseBase64()
+			if p.parseBase64() {
+				continue
+			}
+		}
+
+		prop, err := parseLine(p.currentLine)
+		if errors.Is(err, ErrInvalidLine) {
+			err = &vcard.ParseError{Line: p.lines.Line(), Value: p.currentLine, Err: err}
+			if p.repairLine() {
+				err = p.report(SeverityWarning, err)
+			} else {
+				err = p.report(SeverityError, err)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		prop.Line = p.lines.Line()
+		// invalid parameters are kept untyped, the property is still good
+		if err != nil {
+			if err := p.reportAll(SeverityWarning, withLine(err, prop.Line)); err != nil {
+				return nil, err
+			}
+		}
+
+		// values that can't be decoded are kept as they are
+		if err := decodeValue(&prop); err != nil {
+			if err := p.report(SeverityWarning, err); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkValue(prop); err != nil {
+			if err := p.report(SeverityWarning, err); err != nil {
+				return nil, err
+			}
+		}
+
+		switch prop.Name {
+		case vcard.BEGIN:
+			card := p.currentCard
+			p.currentCard = vcard.NewVCard()
+			if card == nil {
+				continue
+			}
+			// the card before is missing its END, it's returned as it is
+			if err := p.report(SeverityError, &vcard.ParseError{Line: prop.Line, Err: ErrNestedBegin}); err != nil {
+				return nil, err
+			}
+			return card, nil
+
+		case vcard.END:
+			card := p.currentCard
+			p.currentCard = nil
+			if card == nil {
+				if err := p.report(SeverityWarning, &vcard.ParseError{Line: prop.Line, Err: ErrUnexpectedEnd}); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return card, nil
+		}
+
+		// anything outside of BEGIN/END is ignored
+		if p.currentCard == nil {
 			continue
 		}
-		p.NextLine()
 
-		switch {
-		case strings.HasPrefix(p.currentLine, vcard.BEGIN):
-			p.currentCard = &contact.ContactCard{}
+		// inline base64 that isn't folded can spill onto the next lines
+		if (isBase64(prop) || isDataURI(prop)) && !strings.HasSuffix(string(prop.Value), vcard.EQUAL) {
+			p.base64Flag = true
+		}
+		p.currentCard.AddProperty(prop)
+	}
+	if p.error != nil {
+		return nil, p.error
+	}
+	if p.currentCard != nil {
+		card := p.currentCard
+		p.currentCard = nil
+		if err := p.report(SeverityError, &vcard.ParseError{Line: p.lines.Line(), Err: ErrUnexpectedEOF}); err != nil {
+			return nil, err
+		}
+		return card, nil
+	}
+	return nil, io.EOF
+}
 
-		case strings.HasPrefix(p.currentLine, vcard.END):
-			return p.currentCard, nil
+// A line without a colon right after a property is most likely a line
+// break that wasn't escaped, Outlook writes notes like that. The line
+// is added to the value of that property.
+func (p *Parser) repairLine() bool {
+	if p.currentCard == nil || len(p.currentCard.Properties) == 0 {
+		return false
+	}
+	last := &p.currentCard.Properties[len(p.currentCard.Properties)-1]
+	last.Value += vcard.PropValue(`\n` + vcard.Escape(p.currentLine))
+	return true
+}
 
-		case strings.HasPrefix(p.currentLine, vcard.VERSION):
-			p.currentCard.Version = strings.Split(p.currentLine, vcard.COLON)[1]
+// Checks the values the parser would otherwise keep quietly as text.
+func checkValue(prop vcard.Property) error {
+	switch prop.Name {
+	case vcard.BDAY, vcard.ANNIVERSARY, vcard.DEATHDATE:
+		for _, v := range prop.GetParam(vcard.VALUE_PARAM) {
+			if strings.EqualFold(v, "text") {
+				return nil
+			}
+		}
+		if _, err := ParseDateOrTime(string(prop.Value)); err != nil {
+			return &vcard.ParseError{Line: prop.Line, Property: prop.Name, Value: string(prop.Value), Err: err}
+		}
+	}
+	return nil
+}
 
-		case strings.HasPrefix(p.currentLine, vcard.PRODID):
-			p.currentCard.ProdID = strings.Split(p.currentLine, vcard.COLON)[1]
+// Sets the line of the parameter errors in err.
+func withLine(err error, line int) error {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, e := range errs {
+		var pe *vcard.ParseError
+		if errors.As(e, &pe) {
+			pe.Line = line
+		}
+	}
+	return err
+}
 
-		case strings.HasPrefix(p.currentLine, vcard.N):
-			p.parseName()
+// ToContact builds a ContactCard from the properties of v.
+// Properties without a typed field on ContactCard, and extra
+// instances of single valued ones, end up in ExtendedFields.
+func ToContact(v *vcard.VCard) (*contact.ContactCard, error) {
+	card := &contact.ContactCard{}
+	labels := groupLabels(v)
 
-		case strings.HasPrefix(p.currentLine, vcard.FN):
-			p.currentCard.FullName = strings.Split(p.currentLine, vcard.COLON)[1]
+	for _, prop := range v.Properties {
+		label := labels[strings.ToLower(prop.Group)]
+		switch prop.Name {
+		case vcard.VERSION:
+			card.Version = string(prop.Value)
 
-		case strings.HasPrefix(p.currentLine, vcard.BDAY):
-			p.currentCard.Birthday, err = StringtoDateParser(strings.Split(p.currentLine, vcard.COLON)[1])
-			if err != nil {
-				return nil, err
+		case vcard.PRODID:
+			card.ProdID = prop.Text()
+
+		case vcard.N:
+			parseName(card, prop)
+
+		case vcard.FN:
+			card.FullName = prop.Text()
+
+		case vcard.BDAY:
+			setDateOnce(card, &card.Birthday, prop)
+
+		case vcard.ANNIVERSARY:
+			setDateOnce(card, &card.Anniversary, prop)
+
+		case vcard.DEATHDATE:
+			setDateOnce(card, &card.DeathDate, prop)
+
+		case vcard.REV:
+			rev, err := parseTimestamp(string(prop.Value))
+			if err != nil || !card.Revision.IsZero() {
+				addExtended(card, prop)
+				continue
 			}
+			card.Revision = rev
 
-		case strings.HasPrefix(p.currentLine, vcard.UID):
-			p.currentCard.UID = strings.Split(p.currentLine, vcard.COLON)[1]
+		case vcard.UID:
+			setOnce(card, &card.UID, prop, string(prop.Value))
 
-		case strings.HasPrefix(p.currentLine, vcard.NICKNAME):
-			p.currentCard.Nickname = strings.Split(p.currentLine, vcard.COLON)[1]
+		case vcard.NICKNAME:
+			setOnce(card, &card.Nickname, prop, prop.Text())
 
-		case strings.HasPrefix(p.currentLine, vcard.ORG):
-			p.currentCard.Organization = removeSemiColon(strings.Split(p.currentLine, vcard.COLON)[1])
+		case vcard.ORG:
+			setOnce(card, &card.Organization, prop, parseOrganization(string(prop.Value)))
 
-		case strings.HasPrefix(p.currentLine, vcard.URL):
-			p.currentCard.URL = strings.Split(p.currentLine, vcard.COLON)[1]
+		case vcard.URL:
+			if label != "" {
+				addItem(card, prop, label)
+				continue
+			}
+			setOnce(card, &card.URL, prop, string(prop.Value))
 
-		case strings.HasPrefix(p.currentLine, vcard.NOTE):
-			p.currentCard.Notes = strings.Split(p.currentLine, vcard.COLON)[1]
+		case vcard.RELATED, vcard.X_ABRELATEDNAMES:
+			if label != "" {
+				addItem(card, prop, label)
+				continue
+			}
+			addExtended(card, prop)
 
-		case strings.HasPrefix(p.currentLine, vcard.TITLE):
-			p.currentCard.Titles = strings.Split(p.currentLine, vcard.COLON)[1]
+		case vcard.X_ABLABEL:
+			// linked to a property of its group, unless nothing in
+			// the group has somewhere to keep it
+			if label != "" && labeled(v, prop.Group) {
+				continue
+			}
+			addExtended(card, prop)
 
-		case strings.HasPrefix(p.currentLine, vcard.PHOTO):
-			p.base64Flag = true
-			// check if url or base64
-			p.b64BuffDaddy = []byte(p.currentLine)
+		case vcard.NOTE:
+			setOnce(card, &card.Notes, prop, prop.Text())
+
+		case vcard.TITLE:
+			setOnce(card, &card.Titles, prop, prop.Text())
+
+		case vcard.CATEGORIES:
+			for _, category := range prop.Values() {
+				if category = strings.TrimSpace(category); category != "" {
+					card.Categories = append(card.Categories, category)
+				}
+			}
+
+		case vcard.TEL:
+			tel := parseTelephone(prop)
+			tel.Label = label
+			card.Telephones = append(card.Telephones, tel)
+
+		case vcard.EMAIL:
+			email := parseEmail(prop)
+			email.Label = label
+			card.Emails = append(card.Emails, email)
+
+		case vcard.ADR:
+			adr := parseAddress(prop)
+			adr.Label = label
+			card.Addresses = append(card.Addresses, adr)
 
+		case vcard.IMPP:
+			card.InstantMessaging = append(card.InstantMessaging, strings.TrimSpace(string(prop.Value)))
+
+		case vcard.PHOTO:
+			setImageOnce(card, &card.Photo, prop)
+
+		case vcard.LOGO:
+			setImageOnce(card, &card.Logos, prop)
+
+		case vcard.SOUND:
+			setImageOnce(card, &card.Sound, prop)
+
+		case vcard.SOCIALPROFILE:
+			card.SocialProfiles = append(card.SocialProfiles, parseSocialProfile(prop))
+
+		default:
+			if strings.HasPrefix(string(prop.Name), vcard.X) {
+				parseExtension(card, prop, label)
+				continue
+			}
+			addExtended(card, prop)
 		}
 	}
-	return nil, nil
+	return card, nil
 }
 
 /*
 Takes into account all the parameters
-eg. TEL;TYPE=WORK,VOICE:(111) 555-1212
-Splits the field into the correct type
+eg. item1.TEL;TYPE=WORK,VOICE:(111) 555-1212
+Splits the line into its group, name, parameters and value.
+The property is returned even when some of its parameters are
+invalid, the error says which ones.
 */
-func parseLine(currentLine string) ([]string, string, error) {
-	line := strings.SplitN(currentLine, vcard.COLON, 2)
-	if len(line) < 2 {
-		return nil, "", errors.New("Invalid line: " + currentLine)
+func parseLine(currentLine string) (vcard.Property, error) {
+	colon := indexColon(currentLine)
+	if colon < 0 {
+		return vcard.Property{}, ErrInvalidLine
 	}
-	// Split the parameters
-	params := strings.Split(line[0], vcard.SEMICOLON)
-	value := line[1]
-	return params, value, nil
+	params := splitParams(currentLine[:colon])
+
+	prop := vcard.Property{
+		Value: vcard.PropValue(currentLine[colon+1:]),
+	}
+	name := params[0]
+	if group, n, found := strings.Cut(name, vcard.DOT); found {
+		prop.Group = group
+		name = n
+	}
+	prop.Name = vcard.PropName(strings.ToUpper(strings.TrimSpace(name)))
+
+	var err error
+	prop.Params, err = parseParams(params[1:], prop.Name, string(prop.Value))
+	return prop, err
 }
 
-func (p *Parser) parseBase64() {
+// Appends the current line to the last property of the card.
+// Returns false if the line is not part of the block (it looks like a
+// property) so the caller can handle it as usual.
+func (p *Parser) parseBase64() bool {
+	if strings.Contains(p.currentLine, vcard.COLON) || p.currentCard == nil || len(p.currentCard.Properties) == 0 {
+		p.base64Flag = false
+		return false
+	}
+	last := &p.currentCard.Properties[len(p.currentCard.Properties)-1]
+	last.Value += vcard.PropValue(strings.TrimSpace(p.currentLine))
 	if strings.HasSuffix(p.currentLine, vcard.EQUAL) || strings.HasSuffix(p.currentLine, vcard.DUBQUAL) {
-		p.currentCard.Photo = contact.EncodedImage(string(p.b64BuffDaddy))
 		p.base64Flag = false
-	} else {
-		p.b64BuffDaddy = append(p.b64BuffDaddy, p.currentLine...)
-		p.NextLine()
-		p.parseBase64()
 	}
+	return true
 }
 
-func (p *Parser) parseName() {
-	line := strings.Split(p.currentLine, vcard.COLON)
-	p.currentCard.FullName = strings.TrimSpace(strings.ReplaceAll(line[1], vcard.SEMICOLON, " "))
-	names := strings.Split(line[1], vcard.SEMICOLON)
+func parseName(card *contact.ContactCard, prop vcard.Property) {
+	names := prop.Components()
+	// FN wins over a name built from N
+	if card.FullName == "" {
+		card.FullName = strings.Join(strings.Fields(strings.Join(names, " ")), " ")
+	}
 	for i, name := range names {
 		switch i {
 		case 0:
 			if name != "" {
-				p.currentCard.LastName = name
+				card.LastName = name
 			}
 		case 1:
 			if name != "" {
-				p.currentCard.FirstName = name
+				card.FirstName = name
 			}
 		case 2:
 			if name != "" {
-				p.currentCard.MiddleName = name
+				card.MiddleName = name
 			}
 		case 3:
 			if name != "" {
-				p.currentCard.Prefix = name
+				card.Prefix = name
 			}
 		case 4:
 			if name != "" {
-				p.currentCard.Suffix = name
+				card.Suffix = name
 			}
 		}
 	}
 
 }
 
+// TEL;TYPE=WORK,VOICE:(111) 555-1212
+func parseTelephone(prop vcard.Property) contact.Telephone {
+	tel := contact.Telephone{
+		Type:   prop.Types(),
+		Number: strings.TrimSpace(string(prop.Value)),
+		Group:  prop.Group,
+	}
+	if cc := prop.GetParam(vcard.CC_PARAM); len(cc) > 0 {
+		tel.Region = strings.TrimSpace(cc[0])
+	}
+	return tel
+}
+
+// EMAIL;TYPE=work:taco@example.com
+func parseEmail(prop vcard.Property) contact.EmailAddr {
+	return contact.EmailAddr{
+		Type:    prop.Types(),
+		Address: strings.TrimSpace(prop.Text()),
+		Group:   prop.Group,
+	}
+}
+
+// ADR;TYPE=home:;;123 Main Street;Any Town;CA;91921-1234;U.S.A.
+// The components are in order: post office box, extended address,
+// street, locality, region, postal code and country.
+// https://tools.ietf.org/html/rfc6350#section-6.3.1
+func parseAddress(prop vcard.Property) contact.Address {
+	adr := contact.Address{
+		Type:  prop.Types(),
+		Group: prop.Group,
+	}
+	for i, comp := range prop.Components() {
+		switch i {
+		case 0:
+			adr.POBox = comp
+		case 1:
+			adr.Extended = comp
+		case 2:
+			adr.Street = comp
+		case 3:
+			adr.City = comp
+		case 4:
+			adr.State = comp
+		case 5:
+			adr.Zip = comp
+		case 6:
+			adr.Country = comp
+		}
+	}
+	return adr
+}
+
+// Sets a single valued field, if it's already set the property
+// is kept in ExtendedFields instead of overwriting it.
+func setOnce(card *contact.ContactCard, field *string, prop vcard.Property, val string) {
+	if *field != "" {
+		addExtended(card, prop)
+		return
+	}
+	*field = val
+}
+
+// Like setOnce for dates.
+func setDateOnce(card *contact.ContactCard, field **contact.DateOrTime, prop vcard.Property) {
+	if *field != nil {
+		addExtended(card, prop)
+		return
+	}
+	d := parseDateProp(prop)
+	*field = &d
+}
+
+// Like setOnce for PHOTO, LOGO and SOUND.
+func setImageOnce(card *contact.ContactCard, field *contact.Image, prop vcard.Property) {
+	if *field != nil {
+		addExtended(card, prop)
+		return
+	}
+	*field = parseImage(prop)
+}
+
+// Reads inline data or a URI:
+// PHOTO;MEDIATYPE=image/png:http://example.com/taco.png (4.0)
+// PHOTO:data:image/jpeg;base64,/9j/4AAQ... (4.0)
+// PHOTO;ENCODING=b;TYPE=JPEG:/9j/4AAQ... (3.0)
+// PHOTO;ENCODING=BASE64;JPEG:/9j/4AAQ... (2.1)
+// Inline data always ends up as a data: URI so the media type is kept.
+func parseImage(prop vcard.Property) contact.Image {
+	value := strings.TrimSpace(string(prop.Value))
+	if _, _, ok := contact.SplitDataURI(value); ok {
+		return contact.EncodedImage(value)
+	}
+
+	uri := false
+	for _, v := range prop.GetParam(vcard.VALUE_PARAM) {
+		if strings.EqualFold(v, "uri") || strings.EqualFold(v, "url") {
+			uri = true
+		}
+	}
+	if !isBase64(prop) && (uri || strings.Contains(value, vcard.COLON)) {
+		return contact.ImageURL(value)
+	}
+
+	// base64 that was split over several lines can have whitespace in it
+	data := strings.Join(strings.Fields(value), "")
+	mediaType := ""
+	if mt := prop.GetParam(vcard.MEDIATYPE_PARAM); len(mt) > 0 {
+		mediaType = mt[0]
+	}
+	for _, t := range prop.Types() {
+		if mediaType != "" {
+			break
+		}
+		switch t {
+		case "work", "home", "pref":
+		default:
+			mediaType = vcard.MediaTypeFor(prop.Name, t)
+		}
+	}
+	if mediaType == "" {
+		mediaType = contact.SniffMediaType(data)
+	}
+	return contact.EncodedImage("data:" + mediaType + ";base64," + data)
+}
+
+// Collects the Apple X-ABLabel of each group, keyed by the lower
+// cased group. e.g. item1.X-ABLabel:_$!<Other>!$_ -> item1: Other
+func groupLabels(v *vcard.VCard) map[string]string {
+	labels := make(map[string]string)
+	for _, prop := range v.Properties {
+		if prop.Name == vcard.X_ABLABEL && prop.Group != "" {
+			labels[strings.ToLower(prop.Group)] = vcard.DecodeAppleLabel(prop.Text())
+		}
+	}
+	return labels
+}
+
+// Returns true if a property in group keeps its label on the card.
+func labeled(v *vcard.VCard, group string) bool {
+	for _, prop := range v.Properties {
+		if !strings.EqualFold(prop.Group, group) {
+			continue
+		}
+		switch prop.Name {
+		case vcard.TEL, vcard.EMAIL, vcard.ADR, vcard.URL, vcard.RELATED, vcard.X_ABRELATEDNAMES, vcard.X_ABDATE:
+			return true
+		}
+	}
+	return false
+}
+
+// Keeps a labeled URL, related name or date.
+func addItem(card *contact.ContactCard, prop vcard.Property, label string) {
+	n, _ := itemNumber(prop.Group)
+	card.Items = append(card.Items, contact.Item{
+		ItemNumber: n,
+		ItemName:   string(prop.Name),
+		ItemValue:  string(prop.Value),
+		Type:       prop.Types(),
+		Label:      label,
+	})
+}
+
+// item12 -> 12
+func itemNumber(group string) (int, bool) {
+	if len(group) <= len(vcard.ITEM_GROUP) || !strings.EqualFold(group[:len(vcard.ITEM_GROUP)], vcard.ITEM_GROUP) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(group[len(vcard.ITEM_GROUP):])
+	return n, err == nil
+}
+
+// Keeps a property that has no typed field on the card.
+func addExtended(card *contact.ContactCard, prop vcard.Property) {
+	xf := contact.XField{
+		Group: prop.Group,
+		Type:  string(prop.Name),
+		Data:  string(prop.Value),
+	}
+	if len(prop.Params) > 0 {
+		xf.Params = make(map[string][]string)
+		for _, param := range prop.Params {
+			name := string(param.GetName())
+			xf.Params[name] = append(xf.Params[name], param.GetVal()...)
+		}
+	}
+	card.ExtendedFields = append(card.ExtendedFields, xf)
+}
+
 // removes trailing semicolon
 // e.g. taco; -> taco
+// ORG:Acme\; Inc;Sales, the units are unescaped one by one so the ;
+// in the name doesn't become another unit.
+func parseOrganization(value string) string {
+	comps := vcard.SplitUnescaped(removeSemiColon(value), ';')
+	for i, comp := range comps {
+		comps[i] = vcard.Unescape(comp)
+	}
+	return contact.JoinOrg(comps...)
+}
+
 func removeSemiColon(s string) string {
 	return strings.TrimRight(s, vcard.SEMICOLON)
 }
 
-// Parse the birthday string into a time.Time. (YYYY-MM-D)
-func StringtoDateParser(date string) (*time.Time, error) {
-	day, err := time.Parse("2006-01-02", date)
-	if err != nil {
-		return nil, err
+// Parse a REV timestamp, basic (19951031T222710Z) or extended
+// (1995-10-31T22:27:10Z) format.
+func parseTimestamp(ts string) (time.Time, error) {
+	layouts := []string{
+		"20060102T150405Z",
+		"20060102T150405Z0700",
+		"20060102T150405",
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"20060102",
+		"2006-01-02",
+	}
+	var err error
+	for _, layout := range layouts {
+		var t time.Time
+		if t, err = time.Parse(layout, ts); err == nil {
+			return t, nil
+		}
 	}
-	return &day, err
+	return time.Time{}, err
 }
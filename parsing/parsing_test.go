@@ -2,45 +2,741 @@ package parsing
 
 import (
 	"ContactCleaner/contact"
+	"ContactCleaner/vcard"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"unicode/utf16"
 )
 
-// parseTelephone is a mock function for demonstration.
-// Replace this with your actual implementation.
-func parseTelephone(line string) contact.Telephone {
-	var tel contact.Telephone
-	parts := strings.Split(line, ":")
-	if len(parts) == 2 {
-		tel.Number = parts[1]
-		typePart := strings.Split(parts[0], ";")
-		if len(typePart) > 1 {
-			tel.Type = typePart[1:]
-		}
-	}
-	return tel
-}
-
 func TestParseTelephone(t *testing.T) {
 	tests := []struct {
 		line   string
 		number string
 		typ    []string
 	}{
-		{"TEL:123-456-7890", "123-456-7890", []string{""}},
-		{"TEL;TYPE=WORK:555-123-4567", "555-123-4567", []string{"TYPE=WORK"}},
-		{"TEL;TYPE=CELL:987-654-3210", "987-654-3210", []string{"TYPE=CELL"}},
-		{"TEL;TYPE=HOME;PREF:+44 20 7946 0200", "+44 20 7946 0200", []string{"TYPE=HOME;PREF"}},
-		{"TEL;bogus=data:123-456-7890", "123-456-7890", []string{"bogus=data"}},
+		{"TEL:123-456-7890", "123-456-7890", nil},
+		{"TEL;TYPE=WORK:555-123-4567", "555-123-4567", []string{"work"}},
+		{"TEL;TYPE=CELL:987-654-3210", "987-654-3210", []string{"cell"}},
+		{"TEL;TYPE=HOME;PREF:+44 20 7946 0200", "+44 20 7946 0200", []string{"home", "pref"}},
+		{"TEL;HOME;VOICE:555-123-4567", "555-123-4567", []string{"home", "voice"}},
+		{"TEL;bogus=data:123-456-7890", "123-456-7890", nil},
+		{"TEL;TYPE=WORK,VOICE;type=pref:(111) 555-1212", "(111) 555-1212", []string{"work", "voice", "pref"}},
+		{`TEL;TYPE="cell,text":+1-555-555-5555`, "+1-555-555-5555", []string{"cell", "text"}},
 	}
 
 	for _, test := range tests {
-		telephone := parseTelephone(test.line)
+		prop, err := parseLine(test.line)
+		if err != nil {
+			t.Fatalf("Unexpected error for '%s': %v", test.line, err)
+		}
+		telephone := parseTelephone(prop)
 		if telephone.Number != test.number {
 			t.Errorf("Expected phone number '%s', got '%s'", test.number, telephone.Number)
 		}
-		if telephone.Type[0] != test.typ[0] {
+		if !slices.Equal(telephone.Type, test.typ) {
 			t.Errorf("Expected phone type '%s', got '%s'", test.typ, telephone.Type)
 		}
 	}
 }
+
+func TestParseContactMethods(t *testing.T) {
+	input := `BEGIN:VCARD
+VERSION:4.0
+FN:Taco Cat
+TEL;TYPE=cell:+1 111 555 1212
+TEL;TYPE=work;TYPE=voice:(111) 555-1313
+EMAIL;TYPE=work:taco@example.com
+EMAIL:cat@example.com
+ADR;TYPE=home:PO Box 1;Apt 2;123 Main Street\, Unit 4;Any Town;CA;91921-1234;U.S.A.
+IMPP;PREF=1:xmpp:taco@example.com
+NOTE:Not a name
+END:VCARD
+`
+	card, err := NewParser(strings.NewReader(input)).Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(card.Telephones) != 2 || !slices.Equal(card.Telephones[1].Type, []string{"work", "voice"}) {
+		t.Errorf("Unexpected telephones: %+v", card.Telephones)
+	}
+	if len(card.Emails) != 2 || card.Emails[0].Address != "taco@example.com" || !slices.Equal(card.Emails[0].Type, []string{"work"}) {
+		t.Errorf("Unexpected emails: %+v", card.Emails)
+	}
+	expected := contact.Address{
+		Type:     []string{"home"},
+		POBox:    "PO Box 1",
+		Extended: "Apt 2",
+		Street:   "123 Main Street, Unit 4",
+		City:     "Any Town",
+		State:    "CA",
+		Zip:      "91921-1234",
+		Country:  "U.S.A.",
+	}
+	if len(card.Addresses) != 1 || !reflect.DeepEqual(card.Addresses[0], expected) {
+		t.Errorf("Expected address %+v, got %+v", expected, card.Addresses)
+	}
+	if len(card.InstantMessaging) != 1 || card.InstantMessaging[0] != "xmpp:taco@example.com" {
+		t.Errorf("Unexpected instant messaging: %v", card.InstantMessaging)
+	}
+	if card.LastName != "" || card.Notes != "Not a name" {
+		t.Errorf("NOTE was parsed as a name: last name '%s', notes '%s'", card.LastName, card.Notes)
+	}
+}
+
+func TestNextMultipleCards(t *testing.T) {
+	input := `BEGIN:VCARD
+VERSION:4.0
+FN:Taco Cat
+UID:1
+END:VCARD
+BEGIN:VCARD
+VERSION:4.0
+FN:Burrito Dog
+UID:2
+END:VCARD
+BEGIN:VCARD
+VERSION:3.0
+FN:Nacho Bird
+UID:3
+END:VCARD
+`
+	p := NewParser(strings.NewReader(input))
+	var names []string
+	for {
+		card, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		names = append(names, card.FullName)
+	}
+	expected := []string{"Taco Cat", "Burrito Dog", "Nacho Bird"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected %d cards, got %d", len(expected), len(names))
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Expected card %d to be '%s', got '%s'", i, expected[i], names[i])
+		}
+	}
+}
+
+func TestNextMissingEnd(t *testing.T) {
+	p := NewParser(strings.NewReader("BEGIN:VCARD\nFN:Taco Cat\n"), WithMode(Strict))
+	if _, err := p.Next(); !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("Expected ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		err      error
+		line     int
+		property vcard.PropName
+		message  string
+	}{
+		{
+			"BEGIN:VCARD\nVERSION:4.0\nFN:Taco Cat\nnot a property\nEND:VCARD\n",
+			ErrInvalidLine, 4, "",
+			`line 4: line is not a property, it has no colon "not a property"`,
+		},
+		{
+			"BEGIN:VCARD\nVERSION:4.0\nFN:Taco Cat\nBDAY:last tuesday\nEND:VCARD\n",
+			ErrInvalidDate, 4, vcard.BDAY,
+			`line 4: BDAY: invalid date "last tuesday"`,
+		},
+		{
+			"BEGIN:VCARD\nVERSION:4.0\nFN:Taco Cat\nTEL;TYPE=spaceship:111-555-1212\nEND:VCARD\n",
+			vcard.ErrInvalidType, 4, vcard.TEL,
+			`line 4: TEL;TYPE: invalid type "spaceship"`,
+		},
+		{
+			"BEGIN:VCARD\nVERSION:4.0\nFN:Taco Cat\nBEGIN:VCARD\nEND:VCARD\n",
+			ErrNestedBegin, 4, "",
+			`line 4: BEGIN:VCARD before the END:VCARD of the card`,
+		},
+	}
+	for _, test := range tests {
+		_, err := NewParser(strings.NewReader(test.input), WithMode(Strict)).Next()
+		if !errors.Is(err, test.err) {
+			t.Errorf("Expected %v, got %v", test.err, err)
+			continue
+		}
+		var pe *vcard.ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("Expected a ParseError, got %T", err)
+			continue
+		}
+		if pe.Line != test.line || pe.Property != test.property {
+			t.Errorf("Expected line %d property %q, got line %d property %q", test.line, test.property, pe.Line, pe.Property)
+		}
+		if err.Error() != test.message {
+			t.Errorf("Expected message %q, got %q", test.message, err.Error())
+		}
+	}
+}
+
+func TestLenientParsing(t *testing.T) {
+	input := "BEGIN:VCARD\r\nVERSION:4.0\r\n" +
+		"FN:Taco Cat\r\n" +
+		"NOTE:first line\r\n" +
+		"second line\r\n" +
+		"TEL;TYPE=spaceship:111-555-1212\r\n" +
+		"BDAY:last tuesday\r\n" +
+		"END:VCARD\r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nFN:No End\r\n" +
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Burrito\r\n"
+	p := NewParser(strings.NewReader(input))
+	cards, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cards) != 3 || cards[1].FullName != "No End" || cards[2].FullName != "Burrito" {
+		t.Fatalf("Expected all 3 cards, got %d", len(cards))
+	}
+	if cards[0].Notes != "first line\nsecond line" {
+		t.Errorf("Expected the broken note to be repaired, got %q", cards[0].Notes)
+	}
+	if cards[0].Birthday == nil || cards[0].Birthday.Text != "last tuesday" {
+		t.Errorf("Expected the birthday kept as text, got %+v", cards[0].Birthday)
+	}
+
+	expected := []struct {
+		line     int
+		severity Severity
+		err      error
+	}{
+		{5, SeverityWarning, ErrInvalidLine},
+		{6, SeverityWarning, vcard.ErrInvalidType},
+		{7, SeverityWarning, ErrInvalidDate},
+		{9, SeverityWarning, ErrUnexpectedEnd},
+		{13, SeverityError, ErrNestedBegin},
+		{15, SeverityError, ErrUnexpectedEOF},
+	}
+	diags := p.Diagnostics()
+	if len(diags) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %v", len(expected), diags)
+	}
+	for i, e := range expected {
+		d := diags[i]
+		if d.Line != e.line || d.Severity != e.severity || !errors.Is(d, e.err) {
+			t.Errorf("Expected line %d %s %v, got %v", e.line, e.severity, e.err, d)
+		}
+	}
+	if diags[2].Error() != `warning: line 7: BDAY: invalid date "last tuesday"` {
+		t.Errorf("Unexpected message %q", diags[2].Error())
+	}
+}
+
+func TestParamErrors(t *testing.T) {
+	_, err := vcard.NewPrefParam("101")
+	if !errors.Is(err, vcard.ErrPrefParam) {
+		t.Fatalf("Expected ErrPrefParam, got %v", err)
+	}
+	if err.Error() != `PREF: invalid preference value "101"` {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+}
+
+func TestLineUnfolding(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"crlf", "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Taco\r\n  Cat\r\nTITLE:Head of\r\n\t Tacos\r\nEND:VCARD\r\n"},
+		{"lf", "BEGIN:VCARD\nVERSION:4.0\nFN:Taco\n  Cat\nTITLE:Head of\n\t Tacos\nEND:VCARD\n"},
+		{"no trailing newline", "BEGIN:VCARD\nVERSION:4.0\nFN:Taco\n  Cat\nTITLE:Head of\n\t Tacos\nEND:VCARD"},
+	}
+
+	for _, test := range tests {
+		card, err := NewParser(strings.NewReader(test.input)).Next()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if card.FullName != "Taco Cat" {
+			t.Errorf("%s: expected full name 'Taco Cat', got '%s'", test.name, card.FullName)
+		}
+		if card.Titles != "Head of Tacos" {
+			t.Errorf("%s: expected title 'Head of Tacos', got '%s'", test.name, card.Titles)
+		}
+	}
+}
+
+func TestNextVCardKeepsEverything(t *testing.T) {
+	input := `BEGIN:VCARD
+VERSION:4.0
+FN:Taco Cat
+item1.EMAIL;TYPE=work:taco@example.com
+item1.X-ABLabel:Tacos
+TEL;TYPE=cell:111
+TEL;TYPE=home:222
+GEO:geo:37.386013,-122.082932
+X-CUSTOM;TYPE=work:taco.cat
+END:VCARD
+`
+	v, err := NewParser(strings.NewReader(input)).NextVCard()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(v.Properties) != 8 {
+		t.Fatalf("Expected 8 properties, got %d", len(v.Properties))
+	}
+	email := v.Properties[2]
+	if email.Group != "item1" || email.Name != vcard.EMAIL || !slices.Equal(email.Types(), []string{"work"}) {
+		t.Errorf("Unexpected grouped property: %+v", email)
+	}
+	if tels := v.GetProperties(vcard.TEL); len(tels) != 2 {
+		t.Errorf("Expected 2 TEL properties, got %d", len(tels))
+	}
+
+	card, err := ToContact(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var names []string
+	for _, xf := range card.ExtendedFields {
+		names = append(names, xf.Type)
+	}
+	if !slices.Equal(names, []string{"GEO", "X-CUSTOM"}) {
+		t.Errorf("Unexpected extended fields: %v", names)
+	}
+	if card.Emails[0].Group != "item1" || card.Emails[0].Label != "Tacos" {
+		t.Errorf("Expected the label on the email, got %+v", card.Emails[0])
+	}
+	custom := card.ExtendedFields[1]
+	if custom.Data != "taco.cat" || !slices.Equal(custom.Params["TYPE"], []string{"work"}) {
+		t.Errorf("Unexpected X-CUSTOM field: %+v", custom)
+	}
+}
+
+func TestAppleLabels(t *testing.T) {
+	input := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Taco Cat\r\n" +
+		"item1.TEL;type=CELL:111-555-1212\r\n" +
+		"item1.X-ABLabel:Boat\r\n" +
+		"item2.EMAIL;type=INTERNET:taco@example.com\r\n" +
+		"item2.X-ABLabel:_$!<Other>!$_\r\n" +
+		"item3.URL;type=pref:https\\://example.com/blog\r\n" +
+		"item3.X-ABLabel:_$!<HomePage>!$_\r\n" +
+		"item4.X-ABRELATEDNAMES:Burrito Cat\r\n" +
+		"item4.X-ABLabel:_$!<Spouse>!$_\r\n" +
+		"item5.X-ABLabel:orphan\r\n" +
+		"END:VCARD\r\n"
+	card, err := NewParser(strings.NewReader(input)).Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tel := card.Telephones[0]; tel.Label != "Boat" || tel.Group != "item1" {
+		t.Errorf("Unexpected telephone %+v", tel)
+	}
+	if email := card.Emails[0]; email.Label != "Other" || email.Group != "item2" {
+		t.Errorf("Unexpected email %+v", email)
+	}
+	expected := []contact.Item{
+		{ItemNumber: 3, ItemName: "URL", ItemValue: `https\://example.com/blog`, Type: []string{"pref"}, Label: "HomePage"},
+		{ItemNumber: 4, ItemName: "X-ABRELATEDNAMES", ItemValue: "Burrito Cat", Type: nil, Label: "Spouse"},
+	}
+	if !reflect.DeepEqual(card.Items, expected) {
+		t.Errorf("Expected items %+v, got %+v", expected, card.Items)
+	}
+	if card.URL != "" {
+		t.Errorf("Expected the labeled URL in Items, got %q", card.URL)
+	}
+	// a label without anything to link to is kept as it is
+	if len(card.ExtendedFields) != 1 || card.ExtendedFields[0].Group != "item5" || card.ExtendedFields[0].Type != vcard.X_ABLABEL {
+		t.Errorf("Unexpected extended fields %+v", card.ExtendedFields)
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	input := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Taco Cat\r\n" +
+		"X-AIM:tacocat\r\n" +
+		"X-SKYPE;TYPE=work:taco.cat\r\n" +
+		"X-TWITTER:@tacocat\r\n" +
+		"X-SOCIALPROFILE;type=linkedin:https://linkedin.com/in/tacocat\r\n" +
+		"X-PHONETIC-FIRST-NAME:Tako\r\n" +
+		"X-PHONETIC-LAST-NAME:Kyatto\r\n" +
+		"item1.X-ABDATE:2010-06-01\r\n" +
+		"item1.X-ABLabel:_$!<Anniversary>!$_\r\n" +
+		"item2.X-ABDATE:2015-09-01\r\n" +
+		"item2.X-ABLabel:Adopted\r\n" +
+		"X-ANDROID-CUSTOM:vnd.android.cursor.item/nickname;Tac;1;;;;;;;;;;;;;\r\n" +
+		"X-ANDROID-CUSTOM:vnd.android.cursor.item/contact_event;1985-04-15;3;;;;;;;;;;;;;\r\n" +
+		"X-ANDROID-CUSTOM:vnd.android.cursor.item/relation;Burrito Cat;14;;;;;;;;;;;;;\r\n" +
+		"X-ANDROID-CUSTOM:vnd.android.cursor.item/website;x;;;;;;;;;;;;;;\r\n" +
+		"X-FAVORITE-FOOD:tacos\r\n" +
+		"X-FAVORITE-FOOD:burritos\r\n" +
+		"END:VCARD\r\n"
+	card, err := NewParser(strings.NewReader(input)).Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !slices.Equal(card.InstantMessaging, []string{"aim:tacocat", "skype:taco.cat"}) {
+		t.Errorf("Unexpected instant messaging %v", card.InstantMessaging)
+	}
+	profiles := []contact.SocialMediaProfile{
+		{Type: "twitter", URL: "https://twitter.com/tacocat"},
+		{Type: "linkedin", URL: "https://linkedin.com/in/tacocat"},
+	}
+	if !reflect.DeepEqual(card.SocialProfiles, profiles) {
+		t.Errorf("Expected profiles %+v, got %+v", profiles, card.SocialProfiles)
+	}
+	if card.PhoneticFirst != "Tako" || card.PhoneticLast != "Kyatto" {
+		t.Errorf("Unexpected phonetic name %q %q", card.PhoneticFirst, card.PhoneticLast)
+	}
+	if card.Anniversary == nil || card.Anniversary.String() != "20100601" {
+		t.Errorf("Expected the anniversary from X-ABDATE, got %v", card.Anniversary)
+	}
+	if card.Birthday == nil || card.Birthday.String() != "19850415" || card.Nickname != "Tac" {
+		t.Errorf("Expected the Android birthday and nickname, got %v %q", card.Birthday, card.Nickname)
+	}
+	items := []contact.Item{
+		{ItemNumber: 2, ItemName: "X-ABDATE", ItemValue: "2015-09-01", Label: "Adopted"},
+		{ItemName: "X-ABRELATEDNAMES", ItemValue: "Burrito Cat", Label: "Spouse"},
+	}
+	if !reflect.DeepEqual(card.Items, items) {
+		t.Errorf("Expected items %+v, got %+v", items, card.Items)
+	}
+
+	// the rest is kept to write back out
+	if card.CustomFields["X-FAVORITE-FOOD"] != "tacos" {
+		t.Errorf("Unexpected custom fields %v", card.CustomFields)
+	}
+	var names []string
+	for _, xf := range card.ExtendedFields {
+		names = append(names, xf.Type+":"+xf.Data)
+	}
+	expected := []string{"X-ANDROID-CUSTOM:vnd.android.cursor.item/website;x;;;;;;;;;;;;;;", "X-FAVORITE-FOOD:burritos"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("Expected extended fields %v, got %v", expected, names)
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	line := `item1.ADR;type="home,pref";Label="Main St; Any Town^nU.S.A.";geo="geo:37.38,-122.08";sort-as=Main;x-note=a,"b,c";PREF=1:;;Main St;Any Town;CA;91921;U.S.A.`
+	prop, err := parseLine(line)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if prop.Group != "item1" || prop.Name != vcard.ADR {
+		t.Errorf("Expected item1.ADR, got %s.%s", prop.Group, prop.Name)
+	}
+	if string(prop.Value) != ";;Main St;Any Town;CA;91921;U.S.A." {
+		t.Errorf("Unexpected value %q", prop.Value)
+	}
+
+	tp, ok := prop.Params[0].(*vcard.TypeParam)
+	if !ok || !slices.Equal(tp.Val, []string{"home", "pref"}) || tp.Prop != vcard.ADR {
+		t.Errorf("Expected TYPE home,pref, got %#v", prop.Params[0])
+	}
+	if lp, ok := prop.Params[1].(*vcard.LabelParam); !ok || lp.Val[0] != "Main St; Any Town\nU.S.A." {
+		t.Errorf("Expected decoded LABEL, got %#v", prop.Params[1])
+	}
+	if gp, ok := prop.Params[2].(*vcard.GeoParam); !ok || gp.Val[0] != "geo:37.38,-122.08" {
+		t.Errorf("Expected GEO, got %#v", prop.Params[2])
+	}
+	if _, ok := prop.Params[3].(*vcard.SortAsParam); !ok {
+		t.Errorf("Expected SORT-AS, got %#v", prop.Params[3])
+	}
+	if bp, ok := prop.Params[4].(*vcard.BaseParam); !ok || bp.Name != "X-NOTE" || !slices.Equal(bp.Val, []string{"a", "b,c"}) {
+		t.Errorf("Expected X-NOTE a and b,c, got %#v", prop.Params[4])
+	}
+	if _, ok := prop.Params[5].(*vcard.PrefParam); !ok {
+		t.Errorf("Expected PREF, got %#v", prop.Params[5])
+	}
+}
+
+func TestParseInvalidParams(t *testing.T) {
+	prop, err := parseLine("TEL;TYPE=spaceship;PREF=500:+1 111 555 1212")
+	if !errors.Is(err, vcard.ErrInvalidType) || !errors.Is(err, vcard.ErrPrefParam) {
+		t.Fatalf("Expected ErrInvalidType and ErrPrefParam, got %v", err)
+	}
+	var pe *vcard.ParseError
+	if !errors.As(err, &pe) || pe.Property != vcard.TEL || pe.Param != vcard.TYPE_PARAM || pe.Value != "spaceship" {
+		t.Errorf("Unexpected ParseError %+v", pe)
+	}
+	// kept untyped so nothing is lost
+	if len(prop.Params) != 2 || prop.GetParam(vcard.TYPE_PARAM)[0] != "spaceship" || prop.GetParam(vcard.PREF_PARAM)[0] != "500" {
+		t.Errorf("Expected the invalid params to be kept, got %#v", prop.Params)
+	}
+	if _, ok := prop.Params[0].(*vcard.BaseParam); !ok {
+		t.Errorf("Expected a BaseParam, got %T", prop.Params[0])
+	}
+}
+
+// The media type in TYPE of 3.0 and 2.1 is a valid type.
+func TestParseLegacyMediaTypes(t *testing.T) {
+	for _, line := range []string{
+		"PHOTO;ENCODING=b;TYPE=JPEG:/9j/4AAQ",
+		"PHOTO;JPEG;ENCODING=BASE64:/9j/4AAQ",
+		"LOGO;TYPE=work,GIF;ENCODING=b:R0lGODlh",
+		"SOUND;TYPE=WAVE;ENCODING=b:UklGRg==",
+		"KEY;TYPE=PGP;ENCODING=b:mQENBF",
+	} {
+		prop, err := parseLine(line)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", line, err)
+			continue
+		}
+		for _, p := range prop.Params {
+			if _, ok := p.(*vcard.TypeParam); p.GetName() == vcard.TYPE_PARAM && !ok {
+				t.Errorf("%s: expected a TypeParam, got %#v", line, p)
+			}
+		}
+	}
+	// only on the properties that have a media type
+	if _, err := parseLine("TEL;TYPE=JPEG:+1 111 555 1212"); !errors.Is(err, vcard.ErrInvalidType) {
+		t.Errorf("Expected ErrInvalidType, got %v", err)
+	}
+}
+
+// Strict mode takes what's valid for the card's own version.
+func TestStrictLegacyCards(t *testing.T) {
+	for _, input := range []string{
+		// iOS
+		"BEGIN:VCARD\r\nVERSION:3.0\r\n" +
+			"N:Cat;Taco;;;\r\nFN:Taco Cat\r\n" +
+			"EMAIL;type=INTERNET;type=HOME;type=pref:taco@example.com\r\n" +
+			"TEL;type=CELL;type=VOICE;type=pref:111-555-1212\r\n" +
+			"item1.ADR;type=HOME;type=pref:;;1 Main St;Any Town;;12345;\r\n" +
+			"X-SOCIALPROFILE;type=twitter:https://twitter.com/tacocat\r\n" +
+			"PHOTO;ENCODING=b;TYPE=JPEG:/9j/4AAQ\r\n" +
+			"END:VCARD\r\n",
+		// Outlook
+		"BEGIN:VCARD\r\nVERSION:2.1\r\n" +
+			"N:Cat;Taco\r\nFN:Taco Cat\r\n" +
+			"TEL;WORK;VOICE:111-555-1212\r\n" +
+			"ADR;WORK;PREF:;;1 Main St;Any Town;;12345\r\n" +
+			"LABEL;WORK;PREF;ENCODING=QUOTED-PRINTABLE:1 Main St=0D=0AAny Town 12345\r\n" +
+			"EMAIL;PREF;INTERNET:taco@example.com\r\n" +
+			"PHOTO;TYPE=JPEG;ENCODING=BASE64:/9j/4AAQ\r\n" +
+			"END:VCARD\r\n",
+	} {
+		card, err := NewParser(strings.NewReader(input), WithMode(Strict)).Next()
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			continue
+		}
+		if card.FullName != "Taco Cat" || card.Photo == nil || card.Photo.MediaType() != "image/jpeg" {
+			t.Errorf("Unexpected card %+v", card)
+		}
+	}
+}
+
+func TestQuotedPrintable(t *testing.T) {
+	input := "BEGIN:VCARD\r\n" +
+		"VERSION:2.1\r\n" +
+		"N;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:M=C3=BCller;J=C3=BCrgen\r\n" +
+		"NOTE;ENCODING=QUOTED-PRINTABLE;CHARSET=ISO-8859-1:Stra=DFe 1=0D=0A=\r\n" +
+		"zweite Zeile=3D=\r\n" +
+		"ok\r\n" +
+		"ADR;WORK;QUOTED-PRINTABLE;CHARSET=WINDOWS-1252:;;=93Main=94 St;Any Town\r\n" +
+		"TEL;HOME;VOICE:111-555-1212\r\n" +
+		"END:VCARD\r\n"
+	card, err := NewParser(strings.NewReader(input)).Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if card.LastName != "Müller" || card.FirstName != "Jürgen" {
+		t.Errorf("Expected Jürgen Müller, got %q %q", card.FirstName, card.LastName)
+	}
+	if card.Notes != "Straße 1\nzweite Zeile=ok" {
+		t.Errorf("Unexpected note %q", card.Notes)
+	}
+	if len(card.Addresses) != 1 || card.Addresses[0].Street != "“Main” St" || !slices.Equal(card.Addresses[0].Type, []string{"work"}) {
+		t.Errorf("Unexpected address %+v", card.Addresses)
+	}
+	if len(card.Telephones) != 1 || !slices.Equal(card.Telephones[0].Type, []string{"home", "voice"}) {
+		t.Errorf("Unexpected telephones %+v", card.Telephones)
+	}
+	if len(card.ExtendedFields) != 0 {
+		t.Errorf("Expected no extended fields, got %+v", card.ExtendedFields)
+	}
+}
+
+func TestRawCharsets(t *testing.T) {
+	// Latin-1 bytes without a CHARSET are read as Windows-1252
+	input := "BEGIN:VCARD\r\nVERSION:2.1\r\nFN:Fran\xe7ois \x80\r\nTITLE;CHARSET=ISO-8859-1:Ing\xe9nieur\r\nEND:VCARD\r\n"
+	card, err := NewParser(strings.NewReader(input)).Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if card.FullName != "François €" || card.Titles != "Ingénieur" {
+		t.Errorf("Unexpected values %q %q", card.FullName, card.Titles)
+	}
+}
+
+func TestUTF16Input(t *testing.T) {
+	text := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Zoë 😀\r\nEND:VCARD\r\n"
+	for _, bigEndian := range []bool{false, true} {
+		var b []byte
+		if bigEndian {
+			b = []byte{0xFE, 0xFF}
+		} else {
+			b = []byte{0xFF, 0xFE}
+		}
+		for _, u := range utf16.Encode([]rune(text)) {
+			if bigEndian {
+				b = append(b, byte(u>>8), byte(u))
+			} else {
+				b = append(b, byte(u), byte(u>>8))
+			}
+		}
+		card, err := NewParser(bytes.NewReader(b)).Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if card.FullName != "Zoë 😀" {
+			t.Errorf("Expected Zoë 😀, got %q", card.FullName)
+		}
+	}
+}
+
+// A surrogate without its other half is U+FFFD, the unit after it
+// isn't lost.
+func TestUTF16LoneSurrogate(t *testing.T) {
+	units := utf16.Encode([]rune("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Zo"))
+	units = append(units, 0xD800, 'e', 0xDC00, 0xD800, 0xD83D, 0xDE00)
+	units = append(units, utf16.Encode([]rune("\r\nEND:VCARD\r\n"))...)
+	b := []byte{0xFF, 0xFE}
+	for _, u := range units {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	card, err := NewParser(bytes.NewReader(b)).Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "Zo\uFFFDe\uFFFD\uFFFD😀"; card.FullName != expected {
+		t.Errorf("Expected %q, got %q", expected, card.FullName)
+	}
+}
+
+func TestParseImages(t *testing.T) {
+	input := "BEGIN:VCARD\r\nVERSION:3.0\r\n" +
+		"PHOTO;ENCODING=b;TYPE=PNG:iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg\r\n" +
+		"LOGO;VALUE=uri:http://example.com/logo.gif\r\n" +
+		"SOUND:data:audio/ogg;base64,T2dnUw==\r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:2.1\r\n" +
+		"PHOTO;ENCODING=BASE64;JPEG:/9j/4AAQ\r\n" +
+		"SkZJRg\r\n" +
+		"\r\n" +
+		"NOTE:after the photo\r\n" +
+		"END:VCARD\r\n"
+	p := NewParser(strings.NewReader(input))
+	card, err := p.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	photo, ok := card.Photo.(contact.EncodedImage)
+	if !ok || photo.MediaType() != "image/png" {
+		t.Fatalf("Expected an inline png, got %#v", card.Photo)
+	}
+	// no padding on the base64
+	b, err := photo.Bytes()
+	if err != nil || !bytes.HasPrefix(b, []byte("\x89PNG")) {
+		t.Errorf("Expected png bytes, got %q %v", b, err)
+	}
+
+	if logo, ok := card.Logos.(contact.ImageURL); !ok || logo != "http://example.com/logo.gif" || logo.MediaType() != "image/gif" {
+		t.Errorf("Expected a gif URL, got %#v", card.Logos)
+	}
+	if _, err := card.Logos.Bytes(); !errors.Is(err, contact.ErrNotInline) {
+		t.Errorf("Expected ErrNotInline, got %v", err)
+	}
+
+	sound, err := card.Sound.Bytes()
+	if err != nil || string(sound) != "OggS" || card.Sound.MediaType() != "audio/ogg" {
+		t.Errorf("Expected ogg sound, got %q %q %v", sound, card.Sound.MediaType(), err)
+	}
+
+	card, err = p.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if card.Photo != contact.EncodedImage("data:image/jpeg;base64,/9j/4AAQSkZJRg") {
+		t.Errorf("Unexpected 2.1 photo %#v", card.Photo)
+	}
+	if card.Notes != "after the photo" {
+		t.Errorf("Expected the note after the photo, got %q", card.Notes)
+	}
+}
+
+func TestParseDateOrTime(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected contact.DateOrTime
+		basic    string
+		extended string
+	}{
+		{"19850415", contact.DateOrTime{Year: 1985, Month: 4, Day: 15}, "19850415", "1985-04-15"},
+		{"1985-04-15", contact.DateOrTime{Year: 1985, Month: 4, Day: 15}, "19850415", "1985-04-15"},
+		{"1985-04", contact.DateOrTime{Year: 1985, Month: 4}, "1985-04", "1985-04"},
+		{"1985", contact.DateOrTime{Year: 1985}, "1985", "1985"},
+		{"--0415", contact.DateOrTime{Month: 4, Day: 15}, "--0415", "--04-15"},
+		{"--04-15", contact.DateOrTime{Month: 4, Day: 15}, "--0415", "--04-15"},
+		{"---15", contact.DateOrTime{Day: 15}, "---15", "---15"},
+		{"--0229", contact.DateOrTime{Month: 2, Day: 29}, "--0229", "--02-29"},
+		{"20000229", contact.DateOrTime{Year: 2000, Month: 2, Day: 29}, "20000229", "2000-02-29"},
+		{"T1030", contact.DateOrTime{Hour: 10, Minute: 30, HasHour: true, HasMinute: true}, "T1030", "T10:30"},
+		{
+			"19850415T103000Z",
+			contact.DateOrTime{Year: 1985, Month: 4, Day: 15, Hour: 10, Minute: 30, HasHour: true, HasMinute: true, HasSecond: true, Zone: "Z"},
+			"19850415T103000Z", "1985-04-15T10:30:00Z",
+		},
+		{
+			"1985-04-15T10:30:00-05:00",
+			contact.DateOrTime{Year: 1985, Month: 4, Day: 15, Hour: 10, Minute: 30, HasHour: true, HasMinute: true, HasSecond: true, Zone: "-0500"},
+			"19850415T103000-0500", "1985-04-15T10:30:00-05:00",
+		},
+	}
+	for _, test := range tests {
+		d, err := ParseDateOrTime(test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.input, err)
+			continue
+		}
+		if d != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.input, test.expected, d)
+		}
+		if d.String() != test.basic || d.Extended() != test.extended {
+			t.Errorf("%s: expected %s and %s, got %s and %s", test.input, test.basic, test.extended, d.String(), d.Extended())
+		}
+	}
+
+	for _, input := range []string{"", "last tuesday", "1985-13-01", "--0400", "19850415T2500", "--0231", "20230431", "20230229", "1985-06-31"} {
+		if _, err := ParseDateOrTime(input); !errors.Is(err, ErrInvalidDate) {
+			t.Errorf("%q: expected ErrInvalidDate, got %v", input, err)
+		}
+	}
+}
+
+func TestParseDates(t *testing.T) {
+	input := "BEGIN:VCARD\r\nVERSION:4.0\r\n" +
+		"BDAY;X-APPLE-OMIT-YEAR=1604:1604-04-15\r\n" +
+		"ANNIVERSARY:last tuesday\r\n" +
+		"DEATHDATE;VALUE=text:circa 1800\r\n" +
+		"END:VCARD\r\n"
+	card, err := NewParser(strings.NewReader(input)).Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if card.Birthday == nil || *card.Birthday != (contact.DateOrTime{Month: 4, Day: 15}) {
+		t.Errorf("Expected a year-less birthday, got %+v", card.Birthday)
+	}
+	if card.Anniversary == nil || card.Anniversary.Text != "last tuesday" {
+		t.Errorf("Expected the anniversary kept as text, got %+v", card.Anniversary)
+	}
+	if card.DeathDate == nil || !card.DeathDate.IsText() || card.DeathDate.String() != "circa 1800" {
+		t.Errorf("Expected a text death date, got %+v", card.DeathDate)
+	}
+}
@@ -0,0 +1,217 @@
+package phone
+
+import (
+	"ContactCleaner/vcard"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrNoDigits      = errors.New("phone number has no digits")
+	ErrUnknownRegion = errors.New("unknown region")
+	ErrUnknownCode   = errors.New("unknown country calling code")
+	ErrNeedsRegion   = errors.New("national number without a default region")
+	ErrInvalidLength = errors.New("phone number has the wrong length for its region")
+)
+
+// A parsed phone number.
+type Number struct {
+	CountryCode string // calling code without the +, e.g. "1"
+	National    string // national significant number, digits only
+	Extension   string
+	Region      string // ISO 3166 code, e.g. "US"
+}
+
+// E164 returns the number as +<country code><national number>.
+// https://www.itu.int/rec/T-REC-E.164
+func (n Number) E164() string {
+	return "+" + n.CountryCode + n.National
+}
+
+// Display returns the number in a readable international format,
+// e.g. "+1 111-555-1212" or "+44 207 946 0200 ext. 12".
+func (n Number) Display() string {
+	var national string
+	if n.CountryCode == "1" && len(n.National) == 10 {
+		national = n.National[:3] + "-" + n.National[3:6] + "-" + n.National[6:]
+	} else {
+		national = group(n.National)
+	}
+	s := "+" + n.CountryCode + " " + national
+	if n.Extension != "" {
+		s += " ext. " + n.Extension
+	}
+	return s
+}
+
+// Splits digits into groups of three with the last group of four.
+// Grouped from the right so any short group ends up first.
+func group(digits string) string {
+	if len(digits) <= 4 {
+		return digits
+	}
+	head, tail := digits[:len(digits)-4], digits[len(digits)-4:]
+	groups := []string{tail}
+	for len(head) > 3 {
+		groups = append([]string{head[len(head)-3:]}, groups...)
+		head = head[:len(head)-3]
+	}
+	if head != "" {
+		groups = append([]string{head}, groups...)
+	}
+	return strings.Join(groups, " ")
+}
+
+// Normalize parses raw and returns its E.164 and display forms.
+// Numbers without a country code use defaultRegion, e.g. "US".
+func Normalize(raw, defaultRegion string) (string, string, error) {
+	n, err := Parse(raw, defaultRegion)
+	if err != nil {
+		return "", "", err
+	}
+	return n.E164(), n.Display(), nil
+}
+
+// ParseProperty parses a TEL property. Its CC parameter, if there is
+// one, takes the place of defaultRegion.
+// https://tools.ietf.org/html/rfc8605#section-3.1
+func ParseProperty(prop vcard.Property, defaultRegion string) (Number, error) {
+	if cc := prop.GetParam(vcard.CC_PARAM); len(cc) > 0 && cc[0] != "" {
+		defaultRegion = cc[0]
+	}
+	return Parse(string(prop.Value), defaultRegion)
+}
+
+// Parse reads a phone number as people write them:
+// "(111) 555-1212", "+1 111 555 1212", "tel:+1-111-555-1212;ext=12",
+// "0044 20 7946 0200", "020 7946 0200 x12". Numbers without a
+// country code use defaultRegion, it can be empty if every number
+// is international.
+func Parse(raw, defaultRegion string) (Number, error) {
+	defaultRegion = strings.ToUpper(strings.TrimSpace(defaultRegion))
+	var def region
+	if defaultRegion != "" {
+		var ok bool
+		if def, ok = regions[defaultRegion]; !ok {
+			return Number{}, ErrUnknownRegion
+		}
+	}
+
+	number, ext := splitExtension(stripURI(raw))
+	international := strings.HasPrefix(strings.TrimSpace(number), "+")
+	digits := onlyDigits(number)
+	if digits == "" {
+		return Number{}, ErrNoDigits
+	}
+
+	n := Number{Extension: ext}
+	switch {
+	case international:
+	case strings.HasPrefix(digits, "00"):
+		// international prefix used by most of the world
+		digits = digits[2:]
+		international = true
+	case def.code == "1" && strings.HasPrefix(digits, "011"):
+		// the North American one
+		digits = digits[3:]
+		international = true
+	}
+
+	if international {
+		code, ok := callingCode(digits)
+		if !ok {
+			return Number{}, ErrUnknownCode
+		}
+		n.CountryCode = code
+		n.National = digits[len(code):]
+		n.Region = codes[code][0]
+		if def.code == code {
+			n.Region = defaultRegion
+		}
+	} else {
+		if defaultRegion == "" {
+			return Number{}, ErrNeedsRegion
+		}
+		n.CountryCode = def.code
+		n.Region = defaultRegion
+		n.National = stripTrunk(digits, def)
+	}
+
+	r := regions[n.Region]
+	// some people write the trunk prefix after the country code, +44 (0)20 ...
+	if len(n.National) > r.maxLen && r.trunk != "" && strings.HasPrefix(n.National, r.trunk) {
+		n.National = n.National[len(r.trunk):]
+	}
+	if len(n.National) < r.minLen || len(n.National) > r.maxLen {
+		return Number{}, ErrInvalidLength
+	}
+	return n, nil
+}
+
+// Strips the tel: scheme and any URI parameters other than ext.
+// https://tools.ietf.org/html/rfc3966
+func stripURI(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if len(raw) < 4 || !strings.EqualFold(raw[:4], "tel:") {
+		return raw
+	}
+	raw = raw[4:]
+	parts := strings.Split(raw, vcard.SEMICOLON)
+	out := parts[0]
+	for _, p := range parts[1:] {
+		if strings.HasPrefix(strings.ToLower(p), "ext=") {
+			out += " ext " + p[4:]
+		}
+	}
+	return out
+}
+
+// Splits off extensions written as "ext. 12", "x12", "#12" or ";ext=12".
+func splitExtension(s string) (string, string) {
+	lower := strings.ToLower(s)
+	for _, marker := range []string{";ext=", "extension", "ext.", "ext", " x", "#"} {
+		i := strings.LastIndex(lower, marker)
+		if i < 0 {
+			continue
+		}
+		ext := onlyDigits(s[i+len(marker):])
+		if ext == "" {
+			continue
+		}
+		return s[:i], ext
+	}
+	return s, ""
+}
+
+func onlyDigits(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// Calling codes are prefix free, so the first match is the only one.
+func callingCode(digits string) (string, bool) {
+	for l := 1; l <= 3 && l <= len(digits); l++ {
+		if _, ok := codes[digits[:l]]; ok {
+			return digits[:l], true
+		}
+	}
+	return "", false
+}
+
+func stripTrunk(digits string, r region) string {
+	if r.trunk == "" || !strings.HasPrefix(digits, r.trunk) {
+		return digits
+	}
+	// only strip it if what's left is a valid length, a national
+	// number can start with the same digit
+	rest := digits[len(r.trunk):]
+	if len(rest) >= r.minLen && (r.trunk != "1" || len(digits) > r.maxLen) {
+		return rest
+	}
+	return digits
+}
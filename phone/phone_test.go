@@ -0,0 +1,77 @@
+package phone
+
+import (
+	"ContactCleaner/vcard"
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		raw     string
+		region  string
+		e164    string
+		display string
+	}{
+		{"(111) 555-1212", "US", "+11115551212", "+1 111-555-1212"},
+		{"+1 111 555 1212", "", "+11115551212", "+1 111-555-1212"},
+		{"tel:+1-111-555-1212", "GB", "+11115551212", "+1 111-555-1212"},
+		{"1-111-555-1212", "US", "+11115551212", "+1 111-555-1212"},
+		{"011 44 20 7946 0200", "US", "+442079460200", "+44 207 946 0200"},
+		{"tel:+1-111-555-1212;ext=42", "", "+11115551212", "+1 111-555-1212 ext. 42"},
+		{"(111) 555-1212 x42", "US", "+11115551212", "+1 111-555-1212 ext. 42"},
+		{"020 7946 0200", "GB", "+442079460200", "+44 207 946 0200"},
+		{"+44 (0)20 7946 0200", "", "+442079460200", "+44 207 946 0200"},
+		{"0044 20 7946 0200", "DE", "+442079460200", "+44 207 946 0200"},
+		{"06 12 34 56 78", "FR", "+33612345678", "+33 61 234 5678"},
+		{"06 1234 5678", "IT", "+390612345678", "+39 061 234 5678"},
+		{"8 (916) 123-45-67", "RU", "+79161234567", "+7 916 123 4567"},
+	}
+	for _, test := range tests {
+		e164, display, err := Normalize(test.raw, test.region)
+		if err != nil {
+			t.Errorf("Normalize(%q, %q): unexpected error: %v", test.raw, test.region, err)
+			continue
+		}
+		if e164 != test.e164 {
+			t.Errorf("Normalize(%q, %q): expected %s, got %s", test.raw, test.region, test.e164, e164)
+		}
+		if display != test.display {
+			t.Errorf("Normalize(%q, %q): expected display %q, got %q", test.raw, test.region, test.display, display)
+		}
+	}
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	tests := []struct {
+		raw    string
+		region string
+		err    error
+	}{
+		{"555-1212", "US", ErrInvalidLength},
+		{"(111) 555-1212", "", ErrNeedsRegion},
+		{"(111) 555-1212", "XX", ErrUnknownRegion},
+		{"n/a", "US", ErrNoDigits},
+		{"+999 1234 5678", "", ErrUnknownCode},
+	}
+	for _, test := range tests {
+		if _, _, err := Normalize(test.raw, test.region); !errors.Is(err, test.err) {
+			t.Errorf("Normalize(%q, %q): expected %v, got %v", test.raw, test.region, test.err, err)
+		}
+	}
+}
+
+func TestParseProperty(t *testing.T) {
+	prop := vcard.Property{
+		Name:   vcard.TEL,
+		Params: []vcard.Param{&vcard.BaseParam{Name: vcard.CC_PARAM, Val: []string{"GB"}}},
+		Value:  "020 7946 0200",
+	}
+	n, err := ParseProperty(prop, "US")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n.E164() != "+442079460200" || n.Region != "GB" {
+		t.Errorf("Expected the CC parameter to win, got %+v", n)
+	}
+}
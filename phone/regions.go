@@ -0,0 +1,144 @@
+package phone
+
+// Country calling codes and national number lengths.
+// Lengths are of the national significant number, without the
+// trunk prefix. Trunk is the prefix dialed in front of national
+// numbers inside the country, "" when there is none.
+// https://www.itu.int/pub/T-SP-E.164D
+type region struct {
+	code   string
+	trunk  string
+	minLen int
+	maxLen int
+}
+
+var regions = map[string]region{
+	// North American Numbering Plan
+	"US": {"1", "1", 10, 10},
+	"CA": {"1", "1", 10, 10},
+	"PR": {"1", "1", 10, 10},
+	"JM": {"1", "1", 10, 10},
+	"BS": {"1", "1", 10, 10},
+	"TT": {"1", "1", 10, 10},
+	"DO": {"1", "1", 10, 10},
+
+	// Europe
+	"GB": {"44", "0", 9, 10},
+	"IE": {"353", "0", 7, 11},
+	"FR": {"33", "0", 9, 9},
+	"DE": {"49", "0", 6, 13},
+	"AT": {"43", "0", 4, 13},
+	"CH": {"41", "0", 9, 9},
+	"LI": {"423", "", 7, 9},
+	"NL": {"31", "0", 9, 9},
+	"BE": {"32", "0", 8, 9},
+	"LU": {"352", "", 4, 11},
+	"ES": {"34", "", 9, 9},
+	"PT": {"351", "", 9, 9},
+	"IT": {"39", "", 6, 11}, // the leading 0 is part of the number
+	"MT": {"356", "", 8, 8},
+	"GR": {"30", "", 10, 10},
+	"CY": {"357", "", 8, 8},
+	"DK": {"45", "", 8, 8},
+	"NO": {"47", "", 8, 8},
+	"SE": {"46", "0", 7, 13},
+	"FI": {"358", "0", 5, 12},
+	"IS": {"354", "", 7, 9},
+	"EE": {"372", "", 7, 8},
+	"LV": {"371", "", 8, 8},
+	"LT": {"370", "8", 8, 8},
+	"PL": {"48", "", 9, 9},
+	"CZ": {"420", "", 9, 9},
+	"SK": {"421", "0", 9, 9},
+	"HU": {"36", "06", 8, 9},
+	"SI": {"386", "0", 8, 8},
+	"HR": {"385", "0", 8, 9},
+	"RS": {"381", "0", 8, 10},
+	"BA": {"387", "0", 8, 9},
+	"BG": {"359", "0", 8, 9},
+	"RO": {"40", "0", 9, 9},
+	"MD": {"373", "0", 8, 8},
+	"UA": {"380", "0", 9, 9},
+	"BY": {"375", "8", 9, 10},
+	"RU": {"7", "8", 10, 10},
+	"KZ": {"7", "8", 10, 10},
+	"TR": {"90", "0", 10, 10},
+
+	// Middle East and Africa
+	"IL": {"972", "0", 8, 9},
+	"AE": {"971", "0", 8, 9},
+	"SA": {"966", "0", 8, 9},
+	"QA": {"974", "", 8, 8},
+	"KW": {"965", "", 8, 8},
+	"JO": {"962", "0", 8, 9},
+	"LB": {"961", "0", 7, 8},
+	"IR": {"98", "0", 10, 10},
+	"EG": {"20", "0", 9, 10},
+	"MA": {"212", "0", 9, 9},
+	"DZ": {"213", "0", 8, 9},
+	"TN": {"216", "", 8, 8},
+	"NG": {"234", "0", 8, 10},
+	"GH": {"233", "0", 9, 9},
+	"KE": {"254", "0", 9, 9},
+	"ET": {"251", "0", 9, 9},
+	"ZA": {"27", "0", 9, 9},
+
+	// Asia and Oceania
+	"IN": {"91", "0", 10, 10},
+	"PK": {"92", "0", 9, 10},
+	"BD": {"880", "0", 8, 10},
+	"LK": {"94", "0", 9, 9},
+	"NP": {"977", "0", 8, 10},
+	"CN": {"86", "0", 9, 11},
+	"HK": {"852", "", 8, 8},
+	"MO": {"853", "", 8, 8},
+	"TW": {"886", "0", 8, 9},
+	"JP": {"81", "0", 9, 10},
+	"KR": {"82", "0", 8, 10},
+	"SG": {"65", "", 8, 8},
+	"MY": {"60", "0", 8, 10},
+	"TH": {"66", "0", 8, 9},
+	"VN": {"84", "0", 9, 10},
+	"PH": {"63", "0", 8, 10},
+	"ID": {"62", "0", 8, 12},
+	"AU": {"61", "0", 9, 9},
+	"NZ": {"64", "0", 8, 10},
+
+	// Latin America
+	"MX": {"52", "", 10, 10},
+	"BR": {"55", "0", 10, 11},
+	"AR": {"54", "0", 10, 11},
+	"CL": {"56", "", 9, 9},
+	"CO": {"57", "", 10, 10},
+	"PE": {"51", "0", 8, 9},
+	"VE": {"58", "0", 10, 10},
+	"EC": {"593", "0", 8, 9},
+	"UY": {"598", "0", 8, 8},
+	"CR": {"506", "", 8, 8},
+	"PA": {"507", "", 7, 8},
+	"GT": {"502", "", 8, 8},
+	"CU": {"53", "0", 8, 8},
+}
+
+// the region a shared calling code belongs to when nothing else says
+var mainRegions = map[string]string{
+	"1": "US",
+	"7": "RU",
+}
+
+// calling code -> regions using it
+var codes = map[string][]string{}
+
+func init() {
+	for name, r := range regions {
+		if main, ok := mainRegions[r.code]; ok && main != name {
+			continue
+		}
+		codes[r.code] = append([]string{name}, codes[r.code]...)
+	}
+	for name, r := range regions {
+		if main, ok := mainRegions[r.code]; ok && main != name {
+			codes[r.code] = append(codes[r.code], name)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package photo
+
+import (
+	"ContactCleaner/contact"
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"math/bits"
+)
+
+var (
+	ErrNotImage = errors.New("not a JPEG, PNG or GIF image")
+	ErrTooLarge = errors.New("image can't be made small enough")
+)
+
+// Hashes this many bits apart or less are the same picture.
+// Re-encoding and resizing moves a hash a few bits, a different
+// picture moves it around half of them.
+const maxDistance = 10
+
+// below this the picture isn't worth keeping
+const minShrinkSize = 16
+
+// Decode decodes an inline JPEG, PNG or GIF.
+func Decode(img contact.Image) (image.Image, error) {
+	if img == nil {
+		return nil, ErrNotImage
+	}
+	b, err := img.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	m, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	return m, nil
+}
+
+// Resolution returns the width and height of an inline image
+// without decoding all of it.
+func Resolution(img contact.Image) (int, int, error) {
+	if img == nil {
+		return 0, 0, ErrNotImage
+	}
+	b, err := img.Bytes()
+	if err != nil {
+		return 0, 0, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return 0, 0, ErrNotImage
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// Hash returns a perceptual hash (dHash) of m. Pictures that look the
+// same have hashes a few bits apart, whatever their size or encoding.
+// https://www.hackerfactor.com/blog/index.php?/archives/529-Kind-of-Like-That.html
+func Hash(m image.Image) uint64 {
+	small := resize(m, 9, 8)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray(small.RGBAAt(x, y)) < gray(small.RGBAAt(x+1, y)) {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Distance returns the number of bits two hashes differ by.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Same returns true if a and b are the same picture, even if one
+// of them was resized or re-encoded.
+func Same(a, b contact.Image) (bool, error) {
+	ma, err := Decode(a)
+	if err != nil {
+		return false, err
+	}
+	mb, err := Decode(b)
+	if err != nil {
+		return false, err
+	}
+	return Distance(Hash(ma), Hash(mb)) <= maxDistance, nil
+}
+
+// Largest returns the position of the image with the most pixels.
+// Images that can't be decoded count as empty, ties go to the first.
+func Largest(imgs []contact.Image) int {
+	best, bestPixels := 0, -1
+	for i, img := range imgs {
+		w, h, err := Resolution(img)
+		if err != nil {
+			w, h = 0, 0
+		}
+		if w*h > bestPixels {
+			best, bestPixels = i, w*h
+		}
+	}
+	return best
+}
+
+// Shrink downscales and re-encodes img as a JPEG until it's at most
+// maxBytes. Images that already fit, and URLs, are returned as they are.
+func Shrink(img contact.Image, maxBytes int) (contact.Image, error) {
+	b, err := img.Bytes()
+	if errors.Is(err, contact.ErrNotInline) || (err == nil && len(b) <= maxBytes) {
+		return img, nil
+	}
+	m, err := Decode(img)
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := m.Bounds().Dx(), m.Bounds().Dy()
+	for w >= minShrinkSize && h >= minShrinkSize {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resize(m, w, h), &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		if buf.Len() <= maxBytes {
+			return contact.NewEncodedImage("image/jpeg", buf.Bytes()), nil
+		}
+		w, h = w*3/4, h*3/4
+	}
+	return nil, ErrTooLarge
+}
+
+// Scales m to w x h by averaging the pixels each new pixel covers.
+// Transparent pixels are put on white since JPEG has no alpha.
+func resize(m image.Image, w, h int) *image.RGBA {
+	b := m.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := b.Dx(), b.Dy()
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*sh/h
+		y1 := max(b.Min.Y+(y+1)*sh/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*sw/w
+			x1 := max(b.Min.X+(x+1)*sw/w, x0+1)
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1 && sy < b.Max.Y; sy++ {
+				for sx := x0; sx < x1 && sx < b.Max.X; sx++ {
+					cr, cg, cb, ca := m.At(sx, sy).RGBA()
+					// premultiplied, add white for the transparent part
+					white := 0xffff - uint64(ca)
+					r += uint64(cr) + white
+					g += uint64(cg) + white
+					bl += uint64(cb) + white
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
+
+func gray(c color.RGBA) int {
+	return (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+}
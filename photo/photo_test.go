@@ -0,0 +1,104 @@
+package photo
+
+import (
+	"ContactCleaner/contact"
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// a diagonal gradient with a dark square, size x size
+func testImage(size int, flip bool) image.Image {
+	m := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			v := uint8((x + y) * 255 / (2 * size))
+			if flip {
+				v = 255 - v
+			}
+			if x > size/4 && x < size/2 && y > size/4 && y < size/2 {
+				v /= 4
+			}
+			m.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return m
+}
+
+func encodePNG(t *testing.T, m image.Image) contact.Image {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return contact.NewEncodedImage("", buf.Bytes())
+}
+
+func encodeJPEG(t *testing.T, m image.Image) contact.Image {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, m, &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatal(err)
+	}
+	return contact.NewEncodedImage("", buf.Bytes())
+}
+
+func TestSame(t *testing.T) {
+	big := encodePNG(t, testImage(128, false))
+	small := encodeJPEG(t, testImage(40, false))
+	other := encodePNG(t, testImage(128, true))
+
+	if same, err := Same(big, small); err != nil || !same {
+		t.Errorf("Expected the resized JPEG to be the same picture: %v %v", same, err)
+	}
+	if same, err := Same(big, other); err != nil || same {
+		t.Errorf("Expected a different picture: %v %v", same, err)
+	}
+	if _, err := Same(big, contact.ImageURL("https://example.com/a.png")); err != contact.ErrNotInline {
+		t.Errorf("Expected ErrNotInline, got %v", err)
+	}
+	if _, err := Same(big, contact.EncodedImage("data:image/png;base64,bm9wZQ==")); err != ErrNotImage {
+		t.Errorf("Expected ErrNotImage, got %v", err)
+	}
+}
+
+func TestLargest(t *testing.T) {
+	imgs := []contact.Image{
+		contact.ImageURL("https://example.com/a.png"),
+		encodeJPEG(t, testImage(40, false)),
+		encodePNG(t, testImage(128, false)),
+		encodePNG(t, testImage(64, false)),
+	}
+	if i := Largest(imgs); i != 2 {
+		t.Errorf("Expected the 128px image, got %d", i)
+	}
+}
+
+func TestShrink(t *testing.T) {
+	img := encodePNG(t, testImage(512, false))
+	before, _ := img.Bytes()
+
+	shrunk, err := Shrink(img, 8000)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	after, _ := shrunk.Bytes()
+	if len(after) > 8000 || len(after) >= len(before) {
+		t.Errorf("Expected at most 8000 bytes, got %d (was %d)", len(after), len(before))
+	}
+	if shrunk.MediaType() != "image/jpeg" {
+		t.Errorf("Expected a JPEG, got %s", shrunk.MediaType())
+	}
+	if same, _ := Same(img, shrunk); !same {
+		t.Errorf("Expected the shrunk photo to be the same picture")
+	}
+
+	// small enough already
+	if out, _ := Shrink(img, len(before)); out != img {
+		t.Errorf("Expected the image back as it was")
+	}
+	if _, err := Shrink(img, 10); err != ErrTooLarge {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package vcard
+
+import "strings"
+
+// Apple Contacts extensions. Labels are linked to a property by giving
+// both the same group, item1.EMAIL and item1.X-ABLabel.
+const (
+	X_ABLABEL        = "X-ABLABEL"
+	X_ABRELATEDNAMES = "X-ABRELATEDNAMES"
+	X_ABDATE         = "X-ABDATE"
+	X_SOCIALPROFILE  = "X-SOCIALPROFILE"
+	ITEM_GROUP       = "item"
+)
+
+// The labels Apple translates, written as _$!<Other>!$_.
+// Anything else is a custom label and written as it is.
+var APPLE_LABELS = []string{
+	"Other", "HomePage", "Home", "Work", "Main", "Mobile", "Pager",
+	"HomeFAX", "WorkFAX", "OtherFAX", "Anniversary",
+	"Father", "Mother", "Parent", "Brother", "Sister", "Child",
+	"Friend", "Spouse", "Partner", "Assistant", "Manager",
+}
+
+// Returns the readable label, _$!<Other>!$_ -> Other.
+func DecodeAppleLabel(s string) string {
+	if strings.HasPrefix(s, "_$!<") && strings.HasSuffix(s, ">!$_") {
+		return s[len("_$!<") : len(s)-len(">!$_")]
+	}
+	return s
+}
+
+// The opposite of DecodeAppleLabel, known labels get wrapped.
+func EncodeAppleLabel(s string) string {
+	for _, label := range APPLE_LABELS {
+		if strings.EqualFold(s, label) {
+			return "_$!<" + label + ">!$_"
+		}
+	}
+	return s
+}
@@ -14,6 +14,13 @@ const (
 	FOLDEDLINE = "\r\n"
 )
 
+// vCard versions
+const (
+	VERSION21 = "2.1"
+	VERSION30 = "3.0"
+	VERSION40 = "4.0"
+)
+
 // vCard property Names
 const (
 	VERSION       = "VERSION"
@@ -73,11 +80,18 @@ type ValueType string
 type PropName string
 type PropValue string
 
+// Property is used both for the definitions in PROPERTIES and for the
+// property lines of a card. For a line, Group, Params and Value are set
+// and Value holds the raw (still escaped) value. Line is where the
+// property started in the input, 0 if it didn't come from a parser.
 type Property struct {
+	Group      string
 	Name       PropName
+	Params     []Param
 	ValueTypes []ValueType
 	PosVals    []PropValue
 	Value      PropValue
+	Line       int
 }
 
 var PROPERTIES = map[PropName]Property{
@@ -150,7 +164,7 @@ var PROPERTIES = map[PropName]Property{
 	GENDER: {
 		Name:       GENDER,
 		ValueTypes: []ValueType{"text"},
-		PosVals:    []PropValue{"M", "F", "O", "N"},
+		PosVals:    []PropValue{"M", "F", "O", "N", "U"},
 		Value:      "",
 	},
 	ADR: {
@@ -393,3 +407,37 @@ var PROPERTIES = map[PropName]Property{
 		Value:      "",
 	},
 }
+
+// Properties with a cardinality of *1, they can appear at most once.
+// Instances with the same ALTID are alternatives and count as one.
+// https://tools.ietf.org/html/rfc6350#section-6
+var AT_MOST_ONCE = map[PropName]bool{
+	VERSION:     true,
+	KIND:        true,
+	N:           true,
+	BDAY:        true,
+	ANNIVERSARY: true,
+	GENDER:      true,
+	PRODID:      true,
+	REV:         true,
+	UID:         true,
+	BIRTHPLACE:  true,
+	DEATHPLACE:  true,
+	DEATHDATE:   true,
+	CREATED:     true,
+}
+
+// Properties whose value is a list of components separated by ;
+var STRUCTURED = map[PropName]bool{
+	N:            true,
+	ADR:          true,
+	ORG:          true,
+	GENDER:       true,
+	CLIENTPIDMAP: true,
+}
+
+// Properties whose value is a list of values separated by ,
+var MULTI_VALUED = map[PropName]bool{
+	NICKNAME:   true,
+	CATEGORIES: true,
+}
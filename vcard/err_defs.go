@@ -1,64 +1,107 @@
 package vcard
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrLangTag            = errors.New("invalid language tag")
+	ErrParam              = errors.New("invalid parameter")
+	ErrNilAltId           = errors.New("missing required parameter")
+	ErrParamSyntax        = errors.New("parameter syntax error")
+	ErrValParamValue      = errors.New("invalid value-type for Value tag")
+	ErrPrefParam          = errors.New("invalid preference value")
+	ErrNilPref            = errors.New("missing required preference value")
+	ErrInvalidPid         = errors.New("invalid property id")
+	ErrNilType            = errors.New("missing required type")
+	ErrInvalidType        = errors.New("invalid type")
+	ErrNilMediaType       = errors.New("missing required media type value")
+	ErrInvalidMediaType   = errors.New("invalid media type value")
+	ErrNilCalscale        = errors.New("missing required calscale value")
+	ErrInvalidCalscale    = errors.New("invalid calscale value")
+	ErrNilSortAs          = errors.New("missing required sort-as value")
+	ErrInvalidSortAs      = errors.New("invalid sort-as value")
+	ErrNilGeo             = errors.New("missing required geo value")
+	ErrInvalidGeo         = errors.New("invalid geo value")
+	ErrNilTz              = errors.New("missing required timezone value")
+	ErrInvalidTz          = errors.New("invalid timezone value")
+	ErrNilIndex           = errors.New("missing required index value")
+	ErrInvalidIndex       = errors.New("invalid index value")
+	ErrNilLevel           = errors.New("missing required level value")
+	ErrInvalidLevel       = errors.New("invalid level value")
+	ErrInvalidGroup       = errors.New("invalid group value")
+	ErrNilGroup           = errors.New("missing required group value")
+	ErrNilCc              = errors.New("missing required country code")
+	ErrInvalidCc          = errors.New("invalid country code")
+	ErrNilAuthor          = errors.New("missing required author value")
+	ErrInvalidAuthor      = errors.New("invalid author value")
+	ErrNilAuthorName      = errors.New("missing required author name")
+	ErrInvalidAuthorName  = errors.New("invalid author name")
+	ErrNilCreated         = errors.New("missing required created value")
+	ErrInvalidCreated     = errors.New("invalid created value")
+	ErrNilDerived         = errors.New("missing required derived value")
+	ErrInvalidDerived     = errors.New("invalid derived value")
+	ErrNilLabel           = errors.New("missing required label value")
+	ErrInvalidLabel       = errors.New("invalid label value")
+	ErrNilPhonetic        = errors.New("missing required phonetic value")
+	ErrInvalidPhonetic    = errors.New("invalid phonetic value")
+	ErrNilPropID          = errors.New("missing required property id")
+	ErrInvalidPropID      = errors.New("invalid property id")
+	ErrNilScript          = errors.New("missing required script value")
+	ErrInvalidScript      = errors.New("invalid script value")
+	ErrNilServiceType     = errors.New("missing required service type value")
+	ErrNilUsername        = errors.New("missing required username value")
+	ErrInvalidUsername    = errors.New("invalid username value")
+	ErrInvalidServiceType = errors.New("invalid service type value")
+	ErrNilJsptr           = errors.New("missing required json-pointer value")
+	ErrInvalidJsptr       = errors.New("invalid json-pointer value")
+
+	// card level, from Validate
+	ErrMissingProperty = errors.New("missing required property")
+	ErrCardinality     = errors.New("property can only appear once")
+	ErrValueType       = errors.New("value type not allowed")
+	ErrPropValue       = errors.New("value not allowed")
+)
 
-type err struct {
-	message string
+// ParseError is returned when a line, property or parameter of a vCard
+// is invalid. Err is one of the sentinel errors above (or the parser's),
+// so callers can check it with errors.Is and get the details with
+// errors.As.
+type ParseError struct {
+	Line     int // line the property starts on, 0 if unknown
+	Property PropName
+	Param    ParamName
+	Value    string
+	Err      error
 }
 
-func (e *err) Error(val string) error {
-	return fmt.Errorf(e.message, val)
+// e.g. line 4: TEL;TYPE: invalid type "fax2"
+func (e *ParseError) Error() string {
+	var sb strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, "line %d: ", e.Line)
+	}
+	switch {
+	case e.Property != "" && e.Param != "":
+		sb.WriteString(string(e.Property) + SEMICOLON + string(e.Param) + ": ")
+	case e.Property != "":
+		sb.WriteString(string(e.Property) + ": ")
+	case e.Param != "":
+		sb.WriteString(string(e.Param) + ": ")
+	}
+	sb.WriteString(e.Err.Error())
+	if e.Value != "" {
+		fmt.Fprintf(&sb, " %q", e.Value)
+	}
+	return sb.String()
 }
 
-var (
-	ErrLangTag            = &err{"Invalid language tag"}
-	ErrParam              = &err{"Invalid parameter"}
-	ErrNilAltId           = &err{"Missing required parameter"}
-	ErrParamSyntax        = &err{"Parameter syntax error"}
-	ErrValParamValue      = &err{"Invalid value-type for Value tag"}
-	ErrPrefParam          = &err{"Invalid preference value"}
-	ErrNilPref            = &err{"Missing required preference value"}
-	ErrInvalidPid         = &err{"Invalid property id"}
-	ErrNilType            = &err{"Missing required type"}
-	ErrInvalidType        = &err{"Invalid type"}
-	ErrNilMediaType       = &err{"Missing required media type value"}
-	ErrInvalidMediaType   = &err{"Invalid media type value"}
-	ErrNilCalscale        = &err{"Missing required calscale value"}
-	ErrInvalidCalscale    = &err{"Invalid calscale value"}
-	ErrNilSortAs          = &err{"Missing required sort-as value"}
-	ErrInvalidSortAs      = &err{"Invalid sort-as value"}
-	ErrNilGeo             = &err{"Missing required geo value"}
-	ErrInvalidGeo         = &err{"Invalid geo value"}
-	ErrNilTz              = &err{"Missing required timezone value"}
-	ErrInvalidTz          = &err{"Invalid timezone value"}
-	ErrNilIndex           = &err{"Missing required index value"}
-	ErrInvalidIndex       = &err{"Invalid index value"}
-	ErrNilLevel           = &err{"Missing required level value"}
-	ErrInvalidLevel       = &err{"Invalid level value"}
-	ErrInvalidGroup       = &err{"Invalid group value"}
-	ErrNilGroup           = &err{"Missing required group value"}
-	ErrNilCc              = &err{"Missing required country code"}
-	ErrInvalidCc          = &err{"Invalid country code"}
-	ErrNilAuthor          = &err{"Missing required author value"}
-	ErrInvalidAuthor      = &err{"Invalid author value"}
-	ErrNilAuthorName      = &err{"Missing required author name"}
-	ErrInvalidAuthorName  = &err{"Invalid author name"}
-	ErrNilCreated         = &err{"Missing required created value"}
-	ErrInvalidCreated     = &err{"Invalid created value"}
-	ErrNilDerived         = &err{"Missing required derived value"}
-	ErrInvalidDerived     = &err{"Invalid derived value"}
-	ErrNilLabel           = &err{"Missing required label value"}
-	ErrInvalidLabel       = &err{"Invalid label value"}
-	ErrNilPhonetic        = &err{"Missing required phonetic value"}
-	ErrInvalidPhonetic    = &err{"Invalid phonetic value"}
-	ErrNilPropID          = &err{"Missing required property id"}
-	ErrInvalidPropID      = &err{"Invalid property id"}
-	ErrNilScript          = &err{"Missing required script value"}
-	ErrInvalidScript      = &err{"Invalid script value"}
-	ErrNilServiceType     = &err{"Missing required service type value"}
-	ErrNilUsername        = &err{"Missing required username value"}
-	ErrInvalidUsername    = &err{"Invalid username value"}
-	ErrInvalidServiceType = &err{"Invalid service type value"}
-	ErrNilJsptr           = &err{"Missing required json-pointer value"}
-	ErrInvalidJsptr       = &err{"Invalid json-pointer value"}
-)
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func paramError(err error, name ParamName, val string) error {
+	return &ParseError{Param: name, Value: val, Err: err}
+}
@@ -0,0 +1,92 @@
+package vcard
+
+import "strings"
+
+// Splits s on every sep that is not escaped with a backslash.
+// The escapes are kept, use Unescape on the parts afterwards.
+// e.g. `a\;b;c` -> [`a\;b`, `c`]
+func SplitUnescaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++ // skip the escaped character
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Removes the backslash escaping used in text values.
+// https://tools.ietf.org/html/rfc6350#section-3.4
+func Unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			sb.WriteByte('\n')
+		default:
+			// \, \; \\ and anything else unknown
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// Escapes backslashes, newlines, commas and semicolons in a text value.
+// https://tools.ietf.org/html/rfc6350#section-3.4
+func Escape(s string) string {
+	if !strings.ContainsAny(s, "\\\n\r,;") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\', ',', ';':
+			sb.WriteByte('\\')
+			sb.WriteByte(s[i])
+		case '\r':
+			// CRLF and bare CR both become \n
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+			sb.WriteString(`\n`)
+		case '\n':
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// Escapes each component and joins them into a structured value.
+// e.g. N, ADR and ORG
+func JoinComponents(comps ...string) string {
+	escaped := make([]string, len(comps))
+	for i, comp := range comps {
+		escaped[i] = Escape(comp)
+	}
+	return strings.Join(escaped, SEMICOLON)
+}
+
+// Escapes each value and joins them into a multi-valued value.
+// e.g. CATEGORIES and NICKNAME
+func JoinValues(vals ...string) string {
+	escaped := make([]string, len(vals))
+	for i, val := range vals {
+		escaped[i] = Escape(val)
+	}
+	return strings.Join(escaped, COMMA)
+}
@@ -0,0 +1,30 @@
+package vcard
+
+// Vendor X- properties that have a typed home on a contact.
+const (
+	X_ANDROID_CUSTOM       = "X-ANDROID-CUSTOM"
+	X_AIM                  = "X-AIM"
+	X_ICQ                  = "X-ICQ"
+	X_JABBER               = "X-JABBER"
+	X_GOOGLE_TALK          = "X-GOOGLE-TALK"
+	X_MSN                  = "X-MSN"
+	X_YAHOO                = "X-YAHOO"
+	X_SKYPE                = "X-SKYPE"
+	X_SKYPE_USERNAME       = "X-SKYPE-USERNAME"
+	X_TWITTER              = "X-TWITTER"
+	X_PHONETIC_FIRST_NAME  = "X-PHONETIC-FIRST-NAME"
+	X_PHONETIC_MIDDLE_NAME = "X-PHONETIC-MIDDLE-NAME"
+	X_PHONETIC_LAST_NAME   = "X-PHONETIC-LAST-NAME"
+)
+
+// The URI scheme IMPP uses for each of the old instant messaging properties.
+var IM_SCHEMES = map[PropName]string{
+	X_AIM:            "aim",
+	X_ICQ:            "icq",
+	X_JABBER:         "xmpp",
+	X_GOOGLE_TALK:    "xmpp",
+	X_MSN:            "msnim",
+	X_YAHOO:          "ymsgr",
+	X_SKYPE:          "skype",
+	X_SKYPE_USERNAME: "skype",
+}
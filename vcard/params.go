@@ -36,6 +36,12 @@ const (
 	JSPTR_PARAM        ParamName = "JSPTR"
 )
 
+// parameters of vCard 2.1 and 3.0 that 4.0 dropped
+const (
+	ENCODING_PARAM ParamName = "ENCODING"
+	CHARSET_PARAM  ParamName = "CHARSET"
+)
+
 const (
 	WORK         ParamVal = "work"
 	HOME         ParamVal = "home"
@@ -69,6 +75,51 @@ const (
 	EMERGENCY    ParamVal = "emergency"
 )
 
+// types from vCard 2.1 and 3.0 that 4.0 dropped
+// https://tools.ietf.org/html/rfc2426#section-3.2.1
+const (
+	PREF     ParamVal = "pref"
+	INTERNET ParamVal = "internet"
+	X400     ParamVal = "x400"
+	MSG      ParamVal = "msg"
+	BBS      ParamVal = "bbs"
+	MODEM    ParamVal = "modem"
+	CAR      ParamVal = "car"
+	ISDN     ParamVal = "isdn"
+	PCS      ParamVal = "pcs"
+	DOM      ParamVal = "dom"
+	INTL     ParamVal = "intl"
+	POSTAL   ParamVal = "postal"
+	PARCEL   ParamVal = "parcel"
+)
+
+// The old style media types of 2.1 and 3.0, PHOTO;TYPE=JPEG. 4.0 has
+// MEDIATYPE instead.
+// https://tools.ietf.org/html/rfc2426#section-3.1.4
+var MEDIATYPEGROUP = map[PropName]map[ParamVal]bool{
+	PHOTO: imageTypes,
+	LOGO:  imageTypes,
+	SOUND: {"wave": true, "wav": true, "pcm": true, "aiff": true, "aif": true, "mp3": true, "mpeg": true, "ogg": true, "aac": true, "m4a": true},
+	KEY:   {"pgp": true, "x509": true},
+}
+
+var imageTypes = map[ParamVal]bool{
+	"jpeg": true, "jpg": true, "png": true, "gif": true, "bmp": true, "tiff": true, "tif": true,
+	"cgm": true, "wmf": true, "met": true, "pmb": true, "dib": true, "pict": true, "ps": true,
+	"pdf": true, "mpeg": true, "mpeg2": true, "avi": true, "qtime": true, "heic": true, "webp": true,
+}
+
+// IsLegacyMediaType reports whether t is an old style media type of
+// prop, JPEG on a PHOTO. A full one, image/jpeg, counts too.
+func IsLegacyMediaType(prop PropName, t string) bool {
+	types, ok := MEDIATYPEGROUP[prop]
+	if !ok {
+		return false
+	}
+	t = strings.ToLower(t)
+	return types[ParamVal(t)] || strings.Contains(t, "/")
+}
+
 var TYPEGROUP = map[ParamVal]map[PropName]bool{
 	WORK: {
 		FN:         true,
@@ -205,6 +256,48 @@ var TYPEGROUP = map[ParamVal]map[PropName]bool{
 	EMERGENCY: {
 		RELATED: true,
 	},
+	PREF: {
+		ADR:   true,
+		TEL:   true,
+		EMAIL: true,
+		IMPP:  true,
+	},
+	INTERNET: {
+		EMAIL: true,
+	},
+	X400: {
+		EMAIL: true,
+	},
+	MSG: {
+		TEL: true,
+	},
+	BBS: {
+		TEL: true,
+	},
+	MODEM: {
+		TEL: true,
+	},
+	CAR: {
+		TEL: true,
+	},
+	ISDN: {
+		TEL: true,
+	},
+	PCS: {
+		TEL: true,
+	},
+	DOM: {
+		ADR: true,
+	},
+	INTL: {
+		ADR: true,
+	},
+	POSTAL: {
+		ADR: true,
+	},
+	PARCEL: {
+		ADR: true,
+	},
 }
 
 type Param interface {
@@ -232,6 +325,12 @@ func (bp *BaseParam) GetVal() []string {
 	return bp.Val
 }
 
+// A BaseParam on its own is an unknown or extension parameter,
+// anything goes.
+func (bp *BaseParam) validate() error {
+	return nil
+}
+
 type LanguageParam struct {
 	BaseParam
 }
@@ -265,11 +364,11 @@ func (lp *LanguageParam) GetLanguageTag() string {
 // Validates if the provided language tag conforms to the RFC 5646 standard.
 func (lp *LanguageParam) validate() error {
 	ltag := lp.GetLanguageTag()
-	languageTagRegex := regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z]{3})?$`)
+	languageTagRegex := regexp.MustCompile(`^[a-zA-Z]{2,8}(-[a-zA-Z0-9]{1,8})*$`)
 	if languageTagRegex.MatchString(ltag) {
 		return nil
 	}
-	return ErrLangTag.Error(ltag)
+	return paramError(ErrLangTag, lp.Name, ltag)
 }
 
 type ValueParam struct {
@@ -304,7 +403,7 @@ func (vp *ValueParam) validate() error {
 		"float", "utc-offset", "language-tag", "unknown":
 		return nil
 	default:
-		return ErrValParamValue.Error(valueType)
+		return paramError(ErrValParamValue, vp.Name, valueType)
 	}
 }
 
@@ -353,7 +452,7 @@ func (pp *PrefParam) validate() error {
 	if prefValueRegex.MatchString(prefValue) {
 		return nil
 	}
-	return ErrPrefParam.Error(prefValue)
+	return paramError(ErrPrefParam, pp.Name, prefValue)
 }
 
 type AltIdParam struct {
@@ -381,7 +480,7 @@ func NewAltIdParam(altId string) (*AltIdParam, error) {
 
 func (ap *AltIdParam) validate() error {
 	if len(ap.Val) == 0 {
-		return ErrNilAltId.Error(string(ALTID_PARAM))
+		return paramError(ErrNilAltId, ALTID_PARAM, "")
 	}
 	return nil
 }
@@ -422,7 +521,7 @@ func (pip *PIDParam) validate() error {
 	if pidRegex.MatchString(pid) {
 		return nil
 	}
-	return ErrInvalidPid.Error(pid)
+	return paramError(ErrInvalidPid, pip.Name, pid)
 }
 
 // Returns the pid value of the parameter
@@ -435,6 +534,8 @@ func (pip *PIDParam) GetPid() string {
 
 type TypeParam struct {
 	BaseParam
+	// the property the parameter is on, the allowed types depend on it
+	Prop PropName
 }
 
 // Creates a new TypeParam with the provided type value.
@@ -446,27 +547,39 @@ func NewTypeParam(typeValue string, propName PropName) (*TypeParam, error) {
 			Name: TYPE_PARAM,
 			Val:  []string{typeValue},
 		},
+		Prop: propName,
 	}
-	if err := tp.validate(propName); err != nil {
+	if err := tp.validate(); err != nil {
 		return nil, err
 	}
 	return tp, nil
 }
 
-func (tp *TypeParam) validate(propName PropName) error {
+func (tp *TypeParam) validate() error {
 	if len(tp.Val) == 0 {
-		return ErrNilType.Error(string(TYPE_PARAM))
+		return paramError(ErrNilType, TYPE_PARAM, "")
 	}
 
 	// Function to validate the TYPE parameter against the allowed values for a property
 	validateTypeParam := func(property PropName, paramValue ParamVal) bool {
-		if props, ok := TYPEGROUP[paramValue]; ok {
-			return props[property]
+		// extension types are allowed anywhere
+		if strings.HasPrefix(string(paramValue), "x-") {
+			return true
 		}
-		return false
+		// there's no list of types for X- properties or the 3.0 and 2.1
+		// ones 4.0 dropped (LABEL, MAILER, AGENT...), so any type goes
+		if _, known := PROPERTIES[property]; !known {
+			return true
+		}
+		if props, ok := TYPEGROUP[paramValue]; ok && props[property] {
+			return true
+		}
+		return IsLegacyMediaType(property, string(paramValue))
 	}
-	if !validateTypeParam(propName, ParamVal(tp.Val[0])) {
-		return ErrInvalidType.Error(tp.Val[0])
+	for _, val := range tp.Val {
+		if !validateTypeParam(tp.Prop, ParamVal(strings.ToLower(val))) {
+			return paramError(ErrInvalidType, tp.Name, val)
+		}
 	}
 	return nil
 }
@@ -493,11 +606,11 @@ func NewMediatypeParam(mediatype string) (*MediaTypeParam, error) {
 
 func (mtp *MediaTypeParam) validate() error {
 	if len(mtp.Val) == 0 {
-		return ErrNilMediaType.Error(string(MEDIATYPE_PARAM))
+		return paramError(ErrNilMediaType, MEDIATYPE_PARAM, "")
 	}
 	var mediaTypeRegex = regexp.MustCompile(`^[a-zA-Z0-9!#$&-^_]+/[a-zA-Z0-9!#$&-^_]+(;[a-zA-Z0-9!#$&-^_]+=[a-zA-Z0-9!#$&-^_]+)*$`)
 	if !mediaTypeRegex.MatchString(mtp.Val[0]) {
-		return ErrInvalidMediaType.Error(mtp.Val[0])
+		return paramError(ErrInvalidMediaType, mtp.Name, mtp.Val[0])
 	}
 	return nil
 }
@@ -524,12 +637,12 @@ func NewCalscaleParam(calscale string) (*CalscaleParam, error) {
 
 func (cp *CalscaleParam) validate() error {
 	if len(cp.Val) == 0 {
-		return ErrNilCalscale.Error(string(CALSCALE_PARAM))
+		return paramError(ErrNilCalscale, CALSCALE_PARAM, "")
 	}
 
 	var calscaleRegex = regexp.MustCompile(`^(gregorian|[a-zA-Z0-9-]+)$`)
 	if !calscaleRegex.MatchString(cp.Val[0]) {
-		return ErrInvalidCalscale.Error(cp.Val[0])
+		return paramError(ErrInvalidCalscale, cp.Name, cp.Val[0])
 	}
 
 	return nil
@@ -537,36 +650,40 @@ func (cp *CalscaleParam) validate() error {
 
 type SortAsParam struct {
 	BaseParam
+	// number of components in the property value, 0 if unknown
+	CompCount int
 }
 
 // Creates a new SortAsParam with the provided sortAs value.
+// The value is a comma separated list with at most one entry
+// per component of the property value.
 // If the sortAs value is invalid, an error is returned.
 // https://tools.ietf.org/html/rfc6350#section-5.9
 func NewSortAsParam(sortAs string, propCompCount int) (*SortAsParam, error) {
 	sap := &SortAsParam{
 		BaseParam: BaseParam{
 			Name: SORTAS_PARAM,
-			Val:  []string{sortAs},
+			Val:  strings.Split(sortAs, COMMA),
 		},
+		CompCount: propCompCount,
 	}
-	if err := sap.validate(propCompCount); err != nil {
+	if err := sap.validate(); err != nil {
 		return nil, err
 	}
 	return sap, nil
 }
 
-func (sap *SortAsParam) validate(propCompCount int) error {
-	sapVal := strings.Split(sap.Val[0], ",")
-	if len(sapVal) == 0 {
-		return ErrNilSortAs.Error(string(SORTAS_PARAM))
+func (sap *SortAsParam) validate() error {
+	if len(sap.Val) == 0 {
+		return paramError(ErrNilSortAs, SORTAS_PARAM, "")
 	}
-	if propCompCount > len(sapVal) {
-		return ErrInvalidSortAs.Error(sapVal[0])
+	if sap.CompCount > 0 && len(sap.Val) > sap.CompCount {
+		return paramError(ErrInvalidSortAs, sap.Name, strings.Join(sap.Val, COMMA))
 	}
-	for _, value := range sapVal {
+	for _, value := range sap.Val {
 		// If any element is empty, return false
 		if strings.TrimSpace(value) == "" {
-			return ErrInvalidSortAs.Error(value)
+			return paramError(ErrInvalidSortAs, sap.Name, value)
 		}
 	}
 	return nil
@@ -594,15 +711,16 @@ func NewGeoParam(geo string) (*GeoParam, error) {
 
 func (gp *GeoParam) validate() error {
 	if len(gp.Val) == 0 {
-		return ErrNilGeo.Error(string(GEO_PARAM))
+		return paramError(ErrNilGeo, GEO_PARAM, "")
 	}
 
 	validateGeoParam := func(paramValue ParamVal) bool {
-		var geoRegex = regexp.MustCompile(`^"([^"]+)"$`)
+		// a URI, e.g. geo:37.386013,-122.082932
+		var geoRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:[^"]+$`)
 		return geoRegex.MatchString(string(paramValue))
 	}
 	if !validateGeoParam(ParamVal(gp.Val[0])) {
-		return ErrInvalidGeo.Error(gp.Val[0])
+		return paramError(ErrInvalidGeo, gp.Name, gp.Val[0])
 	}
 	return nil
 }
@@ -629,7 +747,7 @@ func NewTzParam(tz string) (*TzParam, error) {
 
 func (tp *TzParam) validate() error {
 	if len(tp.Val) == 0 {
-		return ErrNilTz.Error(string(TZ_PARAM))
+		return paramError(ErrNilTz, TZ_PARAM, "")
 	}
 
 	validateTzParam := func(paramValue ParamVal) bool {
@@ -639,7 +757,7 @@ func (tp *TzParam) validate() error {
 		return paramRegex.MatchString(string(paramValue)) || uriRegex.MatchString(string(paramValue))
 	}
 	if !validateTzParam(ParamVal(tp.Val[0])) {
-		return ErrInvalidTz.Error(tp.Val[0])
+		return paramError(ErrInvalidTz, tp.Name, tp.Val[0])
 	}
 	return nil
 }
@@ -668,20 +786,20 @@ func (ip *IndexParam) validate() error {
 	param := ip.Val[0]
 
 	if len(param) == 0 {
-		return ErrNilIndex.Error(string(INDEX_PARAM))
+		return paramError(ErrNilIndex, INDEX_PARAM, "")
 	}
 
 	var indexRegex = regexp.MustCompile(`^[1-9][0-9]*$`)
 	if !indexRegex.MatchString(param) {
-		return ErrInvalidIndex.Error(param)
+		return paramError(ErrInvalidIndex, ip.Name, param)
 	}
 
 	index, err := strconv.Atoi(param)
 	if err != nil {
-		return ErrInvalidIndex.Error(param)
+		return paramError(ErrInvalidIndex, ip.Name, param)
 	}
 	if index < 1 {
-		return ErrInvalidIndex.Error(param)
+		return paramError(ErrInvalidIndex, ip.Name, param)
 	}
 
 	return nil
@@ -711,7 +829,7 @@ func (lp *LevelParam) validate() error {
 	param := lp.Val[0]
 
 	if len(param) == 0 {
-		return ErrNilLevel.Error(string(LEVEL_PARAM))
+		return paramError(ErrNilLevel, LEVEL_PARAM, "")
 	}
 
 	allowedLevels := map[string]bool{
@@ -724,7 +842,7 @@ func (lp *LevelParam) validate() error {
 	}
 
 	if !allowedLevels[strings.ToLower(param)] {
-		return ErrInvalidLevel.Error(param)
+		return paramError(ErrInvalidLevel, lp.Name, param)
 	}
 
 	return nil
@@ -754,12 +872,12 @@ func NewGroupParam(group string) (*GroupParam, error) {
 func (gp *GroupParam) validate() error {
 	param := gp.Val[0]
 	if len(param) == 0 {
-		return ErrNilGroup.Error(string(GROUP_PARAM))
+		return paramError(ErrNilGroup, GROUP_PARAM, "")
 	}
 
 	for _, char := range gp.Val[0] {
 		if !unicode.IsLetter(char) && !unicode.IsDigit(char) && char != '-' {
-			return ErrInvalidGroup.Error(string(char))
+			return paramError(ErrInvalidGroup, gp.Name, string(char))
 		}
 	}
 	return nil
@@ -788,7 +906,7 @@ func NewCcParam(cc string) (*CcParam, error) {
 func (cp *CcParam) validate() error {
 	param := cp.Val[0]
 	if len(param) == 0 {
-		return ErrNilCc.Error(string(CC_PARAM))
+		return paramError(ErrNilCc, CC_PARAM, "")
 	}
 
 	validateCcParam := func(paramValue ParamVal) bool {
@@ -796,7 +914,7 @@ func (cp *CcParam) validate() error {
 		return ccRegex.MatchString(string(paramValue))
 	}
 	if !validateCcParam(ParamVal(param)) {
-		return ErrInvalidCc.Error(param)
+		return paramError(ErrInvalidCc, cp.Name, param)
 	}
 	return nil
 }
@@ -824,15 +942,15 @@ func NewAuthorParam(author string) (*AuthorParam, error) {
 func (ap *AuthorParam) validate() error {
 	param := ap.Val[0]
 	if len(param) == 0 {
-		return ErrNilAuthor.Error(string(AUTHOR_PARAM))
+		return paramError(ErrNilAuthor, AUTHOR_PARAM, "")
 	}
 
 	validateAuthorParam := func(paramValue ParamVal) bool {
-		var uriRegex = regexp.MustCompile(`^".+"$`)
+		var uriRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:[^"]+$`)
 		return uriRegex.MatchString(string(paramValue))
 	}
 	if !validateAuthorParam(ParamVal(param)) {
-		return ErrInvalidAuthor.Error(param)
+		return paramError(ErrInvalidAuthor, ap.Name, param)
 	}
 
 	return nil
@@ -861,15 +979,15 @@ func NewAuthorNameParam(authorName string) (*AuthorNameParam, error) {
 func (anp *AuthorNameParam) validate() error {
 	param := anp.Val[0]
 	if len(param) == 0 {
-		return ErrNilAuthorName.Error(string(AUTHOR_NAME_PARAM))
+		return paramError(ErrNilAuthorName, AUTHOR_NAME_PARAM, "")
 	}
 
 	validateAuthorNameParam := func(paramValue ParamVal) bool {
-		var anpRegex = regexp.MustCompile(`^"[^"]+"$`)
+		var anpRegex = regexp.MustCompile(`^[^"]+$`)
 		return anpRegex.MatchString(string(paramValue))
 	}
 	if !validateAuthorNameParam(ParamVal(param)) {
-		return ErrInvalidAuthorName.Error(param)
+		return paramError(ErrInvalidAuthorName, anp.Name, param)
 	}
 
 	return nil
@@ -898,7 +1016,7 @@ func NewCreatedParam(created string) (*CreatedParam, error) {
 func (cp *CreatedParam) validate() error {
 	param := cp.Val[0]
 	if len(param) == 0 {
-		return ErrNilCreated.Error(string(CREATED_PARAM))
+		return paramError(ErrNilCreated, CREATED_PARAM, "")
 	}
 
 	validateCreatedParam := func(paramValue ParamVal) bool {
@@ -906,7 +1024,7 @@ func (cp *CreatedParam) validate() error {
 		return createdRegex.MatchString(string(paramValue))
 	}
 	if !validateCreatedParam(ParamVal(param)) {
-		return ErrInvalidCreated.Error(param)
+		return paramError(ErrInvalidCreated, cp.Name, param)
 	}
 
 	return nil
@@ -935,7 +1053,7 @@ func NewDerivedParam(derived string) (*DerivedParam, error) {
 func (dp *DerivedParam) validate() error {
 	param := dp.Val[0]
 	if len(param) == 0 {
-		return ErrNilDerived.Error(string(DERIVED_PARAM))
+		return paramError(ErrNilDerived, DERIVED_PARAM, "")
 	}
 
 	validateDerivedParam := func(paramValue string) bool {
@@ -943,7 +1061,7 @@ func (dp *DerivedParam) validate() error {
 		return derived == "true" || derived == "false"
 	}
 	if !validateDerivedParam(param) {
-		return ErrInvalidDerived.Error(param)
+		return paramError(ErrInvalidDerived, dp.Name, param)
 	}
 
 	return nil
@@ -972,7 +1090,7 @@ func NewLabelParam(label string) (*LabelParam, error) {
 func (lp *LabelParam) validate() error {
 	param := lp.Val[0]
 	if len(param) == 0 {
-		return ErrNilLabel.Error(string(LABEL_PARAM))
+		return paramError(ErrNilLabel, LABEL_PARAM, "")
 	}
 
 	return nil
@@ -1001,11 +1119,11 @@ func NewPhoneticParam(phonetic string) (*PhoneticParam, error) {
 func (pp *PhoneticParam) validate() error {
 	param := pp.Val[0]
 	if len(param) == 0 {
-		return ErrNilPhonetic.Error(string(PHONETIC_PARAM))
+		return paramError(ErrNilPhonetic, PHONETIC_PARAM, "")
 	}
 	allowedSystems := map[string]bool{"ipa": true, "piny": true, "jyut": true, "script": true}
 	if !allowedSystems[param] {
-		return ErrInvalidPhonetic.Error(param)
+		return paramError(ErrInvalidPhonetic, pp.Name, param)
 	}
 
 	return nil
@@ -1034,7 +1152,7 @@ func NewPropIDParam(prop string) (*PropIDParam, error) {
 func (pp *PropIDParam) validate() error {
 	param := pp.Val[0]
 	if len(param) == 0 {
-		return ErrNilPropID.Error(string(PROP_ID_PARAM))
+		return paramError(ErrNilPropID, PROP_ID_PARAM, "")
 	}
 
 	validatePropIDParam := func(paramValue ParamVal) bool {
@@ -1042,7 +1160,7 @@ func (pp *PropIDParam) validate() error {
 		return propIDRegex.MatchString(string(paramValue))
 	}
 	if !validatePropIDParam(ParamVal(param)) {
-		return ErrInvalidPropID.Error(param)
+		return paramError(ErrInvalidPropID, pp.Name, param)
 	}
 
 	return nil
@@ -1071,12 +1189,12 @@ func NewScriptParam(script string) (*ScriptParam, error) {
 func (sp *ScriptParam) validate() error {
 	param := sp.Val[0]
 	if len(param) == 0 {
-		return ErrNilScript.Error(string(SCRIPT_PARAM))
+		return paramError(ErrNilScript, SCRIPT_PARAM, "")
 	}
 
 	pattern := regexp.MustCompile(`^[A-Za-z]{4}$`)
 	if !pattern.MatchString(param) {
-		return ErrInvalidScript.Error(param)
+		return paramError(ErrInvalidScript, sp.Name, param)
 	}
 
 	return nil
@@ -1105,11 +1223,11 @@ func NewServiceTypeParam(serviceType string) (*ServiceTypeParam, error) {
 func (stp *ServiceTypeParam) validate() error {
 	param := stp.Val[0]
 	if len(param) == 0 {
-		return ErrNilServiceType.Error(string(SERVICE_TYPE_PARAM))
+		return paramError(ErrNilServiceType, SERVICE_TYPE_PARAM, "")
 	}
 	pattern := regexp.MustCompile(`^.*$`)
 	if !pattern.MatchString(param) {
-		return ErrInvalidServiceType.Error(param)
+		return paramError(ErrInvalidServiceType, stp.Name, param)
 	}
 
 	return nil
@@ -1138,12 +1256,12 @@ func NewUsernameParam(username string) (*UsernameParam, error) {
 func (up *UsernameParam) validate() error {
 	param := up.Val[0]
 	if len(param) == 0 {
-		return ErrNilUsername.Error(string(USERNAME_PARAM))
+		return paramError(ErrNilUsername, USERNAME_PARAM, "")
 	}
 
 	pattern := regexp.MustCompile(`^.*$`)
 	if !pattern.MatchString(param) {
-		return ErrInvalidUsername.Error(param)
+		return paramError(ErrInvalidUsername, up.Name, param)
 	}
 
 	return nil
@@ -1172,12 +1290,13 @@ func NewJsptrParam(jsptr string) (*JsptrParam, error) {
 func (jp *JsptrParam) validate() error {
 	param := jp.Val[0]
 	if len(param) == 0 {
-		return ErrNilJsptr.Error(string(JSPTR_PARAM))
+		return paramError(ErrNilJsptr, JSPTR_PARAM, "")
 	}
 
-	pattern := regexp.MustCompile(`^"\/(?:[^\/"]|\\")*\/"$`)
+	// a JSON pointer relative to the JSContact object, e.g. addresses/k1/street
+	pattern := regexp.MustCompile(`^[^"]+$`)
 	if !pattern.MatchString(param) {
-		return ErrInvalidJsptr.Error(param)
+		return paramError(ErrInvalidJsptr, jp.Name, param)
 	}
 
 	return nil
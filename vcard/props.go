@@ -1,5 +1,7 @@
 package vcard
 
+import "strings"
+
 type ParVal string
 type ParName string
 
@@ -10,3 +12,149 @@ type Par struct {
 	PosVals []ParVal
 	Val     []string
 }
+
+// Returns the values of every parameter called name.
+// Parameter names are case-insensitive.
+func (p Property) GetParam(name ParamName) []string {
+	var vals []string
+	for _, param := range p.Params {
+		if strings.EqualFold(string(param.GetName()), string(name)) {
+			vals = append(vals, param.GetVal()...)
+		}
+	}
+	return vals
+}
+
+// Returns true if the property has a parameter called name.
+func (p Property) HasParam(name ParamName) bool {
+	for _, param := range p.Params {
+		if strings.EqualFold(string(param.GetName()), string(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the lower cased values of all TYPE parameters.
+func (p Property) Types() []string {
+	var types []string
+	for _, t := range p.GetParam(TYPE_PARAM) {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// Returns the unescaped value.
+func (p Property) Text() string {
+	return Unescape(string(p.Value))
+}
+
+// Splits a structured value (N, ADR, ORG, ...) into its unescaped components.
+func (p Property) Components() []string {
+	comps := SplitUnescaped(string(p.Value), ';')
+	for i := range comps {
+		comps[i] = Unescape(comps[i])
+	}
+	return comps
+}
+
+// Splits a multi-valued value (CATEGORIES, NICKNAME, ...) into its unescaped values.
+func (p Property) Values() []string {
+	vals := SplitUnescaped(string(p.Value), ',')
+	for i := range vals {
+		vals[i] = Unescape(vals[i])
+	}
+	return vals
+}
+
+// Turns an old style media type, the TYPE=JPEG of 2.1 and 3.0 PHOTO,
+// LOGO, SOUND and KEY properties, into a full one like image/jpeg.
+func MediaTypeFor(name PropName, t string) string {
+	t = strings.ToLower(t)
+	if strings.Contains(t, "/") {
+		return t
+	}
+	switch t {
+	case "jpg":
+		t = "jpeg"
+	case "wave":
+		t = "wav"
+	}
+	switch name {
+	case SOUND:
+		return "audio/" + t
+	case KEY:
+		return "application/" + t
+	}
+	return "image/" + t
+}
+
+// The value type of the property: its VALUE param, or else the first
+// type PROPERTIES lists, except that a value with a URI scheme is a uri
+// if the property can be one. Unknown properties are "unknown".
+func (p Property) ValueType() string {
+	if vt := p.GetParam(VALUE_PARAM); len(vt) > 0 {
+		return strings.ToLower(vt[0])
+	}
+	return p.DefaultType()
+}
+
+// The type a reader takes the value for when there's no VALUE param.
+func (p Property) DefaultType() string {
+	def, ok := PROPERTIES[p.Name]
+	if !ok || len(def.ValueTypes) == 0 {
+		return "unknown"
+	}
+	for _, vt := range def.ValueTypes {
+		if vt == "uri" && HasScheme(string(p.Value)) {
+			return "uri"
+		}
+	}
+	if def.ValueTypes[0] == "uri" && len(def.ValueTypes) > 1 && !HasScheme(string(p.Value)) {
+		return string(def.ValueTypes[1])
+	}
+	return string(def.ValueTypes[0])
+}
+
+// Returns true if the property needs no VALUE param for valueType,
+// it's the type a reader would take the value for anyway.
+func (p Property) ImpliesType(valueType string) bool {
+	vt := p.DefaultType()
+	switch {
+	case vt == valueType:
+		return true
+	case vt == "unknown":
+		return valueType == "text"
+	case vt == "date-and-or-time":
+		return IsDateType(valueType) && valueType != "timestamp"
+	}
+	return false
+}
+
+// tel:, https:, urn:uuid:, data:
+func HasScheme(s string) bool {
+	scheme, _, ok := strings.Cut(s, ":")
+	if !ok || scheme == "" {
+		return false
+	}
+	for i, c := range scheme {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func IsDateType(vt string) bool {
+	switch vt {
+	case "date-and-or-time", "date", "time", "date-time", "timestamp":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package vcard
+
+import (
+	"strings"
+)
+
+// Finding is a spec violation Validate found on a card.
+// Err is one of the sentinel errors, check it with errors.Is.
+type Finding struct {
+	Line     int // 0 for things that are missing
+	Property PropName
+	Param    ParamName
+	Value    string
+	Err      error
+}
+
+// e.g. line 4: KIND: value not allowed "robot"
+func (f Finding) Error() string {
+	return (&ParseError{Line: f.Line, Property: f.Property, Param: f.Param, Value: f.Value, Err: f.Err}).Error()
+}
+
+func (f Finding) Unwrap() error {
+	return f.Err
+}
+
+// Validate checks card against PROPERTIES and TYPEGROUP: the required
+// properties of its VERSION, the ones that can only appear once, the
+// VALUE types, the enumerated values of KIND, GENDER and VERSION, and
+// the TYPE parameters for the version. X- and other unknown properties aren't checked.
+// Returns nil if the card is fine.
+func Validate(card *VCard) []Finding {
+	var findings []Finding
+	add := func(prop Property, param ParamName, value string, err error) {
+		findings = append(findings, Finding{Line: prop.Line, Property: prop.Name, Param: param, Value: value, Err: err})
+	}
+
+	version := ""
+	if prop, ok := card.GetProperty(VERSION); ok {
+		version = string(prop.Value)
+	}
+	for _, name := range requiredProps(version) {
+		if _, ok := card.GetProperty(name); !ok {
+			add(Property{Name: name}, "", "", ErrMissingProperty)
+		}
+	}
+
+	// ALTID values seen for each property, "" for the ones without
+	seen := make(map[PropName]map[string]bool)
+	for _, prop := range card.Properties {
+		def, known := PROPERTIES[prop.Name]
+		if !known {
+			continue
+		}
+
+		if AT_MOST_ONCE[prop.Name] {
+			altID := strings.Join(prop.GetParam(ALTID_PARAM), ",")
+			if seen[prop.Name] == nil {
+				seen[prop.Name] = make(map[string]bool)
+			}
+			if len(seen[prop.Name]) > 0 && (altID == "" || !seen[prop.Name][altID]) {
+				add(prop, "", "", ErrCardinality)
+			}
+			seen[prop.Name][altID] = true
+		}
+
+		for _, vt := range prop.GetParam(VALUE_PARAM) {
+			if !allowedValueType(def.ValueTypes, vt) {
+				add(prop, VALUE_PARAM, vt, ErrValueType)
+			}
+		}
+
+		if value, ok := enumValue(prop); ok && !allowedValue(def, value) {
+			add(prop, "", value, ErrPropValue)
+		}
+
+		for _, t := range prop.GetParam(TYPE_PARAM) {
+			if !validType(version, prop.Name, t) {
+				add(prop, TYPE_PARAM, t, ErrInvalidType)
+			}
+		}
+	}
+	return findings
+}
+
+// FN is required from 3.0 on, N up to 3.0.
+func requiredProps(version string) []PropName {
+	switch version {
+	case VERSION21:
+		return []PropName{VERSION, N}
+	case VERSION30:
+		return []PropName{VERSION, FN, N}
+	}
+	return []PropName{VERSION, FN}
+}
+
+// The date types are all a date-and-or-time, 2.1 calls a uri a url.
+func allowedValueType(allowed []ValueType, vt string) bool {
+	if allowed == nil {
+		return true
+	}
+	vt = strings.ToLower(vt)
+	for _, a := range allowed {
+		switch {
+		case string(a) == vt:
+			return true
+		case a == "date-and-or-time" && (vt == "date" || vt == "time" || vt == "date-time"):
+			return true
+		case a == "uri" && vt == "url":
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the part of the value PosVals lists, if the property has a
+// list of values. For GENDER it's the sex component, M;a description.
+func enumValue(prop Property) (string, bool) {
+	def := PROPERTIES[prop.Name]
+	if def.PosVals == nil || len(def.ValueTypes) != 1 || def.ValueTypes[0] != "text" {
+		return "", false
+	}
+	if prop.Name == GENDER {
+		sex := prop.Components()[0]
+		// only a description is fine too
+		return sex, sex != ""
+	}
+	return strings.TrimSpace(prop.Text()), true
+}
+
+// 3.0 and 2.1 put the media type of PHOTO, LOGO, SOUND and KEY in
+// TYPE, 4.0 has MEDIATYPE for it.
+func validType(version string, prop PropName, t string) bool {
+	if _, err := NewTypeParam(t, prop); err != nil {
+		return false
+	}
+	if version == VERSION40 && !TYPEGROUP[ParamVal(strings.ToLower(t))][prop] {
+		return !IsLegacyMediaType(prop, t)
+	}
+	return true
+}
+
+// Values are case-insensitive and x- ones are allowed for extensions.
+func allowedValue(def Property, value string) bool {
+	if strings.HasPrefix(strings.ToLower(value), "x-") {
+		return true
+	}
+	for _, v := range def.PosVals {
+		if strings.EqualFold(string(v), value) {
+			return true
+		}
+	}
+	return false
+}
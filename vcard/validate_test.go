@@ -0,0 +1,93 @@
+package vcard
+
+import (
+	"errors"
+	"testing"
+)
+
+func testCard(props ...Property) *VCard {
+	v := NewVCard()
+	v.AddProperty(Property{Name: VERSION, Value: VERSION40, Line: 2})
+	v.AddProperty(Property{Name: FN, Value: "Taco Cat", Line: 3})
+	for _, prop := range props {
+		v.AddProperty(prop)
+	}
+	return v
+}
+
+func typeParam(types ...string) Param {
+	return &BaseParam{Name: TYPE_PARAM, Val: types}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		card     *VCard
+		expected []Finding
+	}{
+		{"valid", testCard(
+			Property{Name: N, Value: "Cat;Taco;;;"},
+			Property{Name: TEL, Params: []Param{typeParam("cell", "pref")}, Value: "+1 111 555 1212"},
+			Property{Name: BDAY, Params: []Param{&BaseParam{Name: VALUE_PARAM, Val: []string{"date"}}}, Value: "19850415"},
+			Property{Name: KIND, Value: "Individual"},
+			Property{Name: GENDER, Value: ";it's complicated"},
+			Property{Name: "X-CUSTOM", Params: []Param{typeParam("anything")}, Value: "x"},
+		), nil},
+		{"missing", &VCard{Properties: []Property{{Name: N, Value: "Cat;Taco;;;"}}}, []Finding{
+			{Property: VERSION, Err: ErrMissingProperty},
+			{Property: FN, Err: ErrMissingProperty},
+		}},
+		{"3.0 needs N", &VCard{Properties: []Property{{Name: VERSION, Value: VERSION30}, {Name: FN, Value: "Taco"}}}, []Finding{
+			{Property: N, Err: ErrMissingProperty},
+		}},
+		{"cardinality", testCard(
+			Property{Name: UID, Value: "1", Line: 4},
+			Property{Name: UID, Value: "2", Line: 5},
+			Property{Name: N, Params: []Param{&BaseParam{Name: ALTID_PARAM, Val: []string{"1"}}}, Value: "Cat;Taco;;;", Line: 6},
+			Property{Name: N, Params: []Param{&BaseParam{Name: ALTID_PARAM, Val: []string{"1"}}}, Value: "キャット;タコ;;;", Line: 7},
+		), []Finding{
+			{Line: 5, Property: UID, Err: ErrCardinality},
+		}},
+		{"values", testCard(
+			Property{Name: KIND, Value: "robot", Line: 4},
+			Property{Name: GENDER, Value: "Q;other", Line: 5},
+			Property{Name: PHOTO, Params: []Param{&BaseParam{Name: VALUE_PARAM, Val: []string{"text"}}}, Value: "smiling", Line: 6},
+			Property{Name: EMAIL, Params: []Param{typeParam("work", "cell")}, Value: "taco@example.com", Line: 7},
+		), []Finding{
+			{Line: 4, Property: KIND, Value: "robot", Err: ErrPropValue},
+			{Line: 5, Property: GENDER, Value: "Q", Err: ErrPropValue},
+			{Line: 6, Property: PHOTO, Param: VALUE_PARAM, Value: "text", Err: ErrValueType},
+			{Line: 7, Property: EMAIL, Param: TYPE_PARAM, Value: "cell", Err: ErrInvalidType},
+		}},
+		{"3.0 media type", &VCard{Properties: []Property{
+			{Name: VERSION, Value: VERSION30},
+			{Name: N, Value: "Cat;Taco;;;"},
+			{Name: FN, Value: "Taco Cat"},
+			{Name: PHOTO, Params: []Param{&BaseParam{Name: ENCODING_PARAM, Val: []string{"b"}}, typeParam("JPEG")}, Value: "/9j/4AAQ"},
+			{Name: SOUND, Params: []Param{&BaseParam{Name: ENCODING_PARAM, Val: []string{"b"}}, typeParam("WAVE")}, Value: "UklGRg=="},
+		}}, nil},
+		{"4.0 media type", testCard(
+			Property{Name: PHOTO, Params: []Param{typeParam("work", "JPEG")}, Value: "https://example.com/taco.jpg", Line: 4},
+		), []Finding{
+			{Line: 4, Property: PHOTO, Param: TYPE_PARAM, Value: "JPEG", Err: ErrInvalidType},
+		}},
+	}
+	for _, test := range tests {
+		findings := Validate(test.card)
+		if len(findings) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, findings)
+			continue
+		}
+		for i, f := range findings {
+			e := test.expected[i]
+			if f.Line != e.Line || f.Property != e.Property || f.Param != e.Param || f.Value != e.Value || !errors.Is(f, e.Err) {
+				t.Errorf("%s: expected %+v, got %+v", test.name, e, f)
+			}
+		}
+	}
+
+	f := Validate(testCard(Property{Name: KIND, Value: "robot", Line: 4}))[0]
+	if f.Error() != `line 4: KIND: value not allowed "robot"` {
+		t.Errorf("Unexpected message %q", f.Error())
+	}
+}
@@ -1,20 +1,38 @@
 package vcard
 
-type vCard struct {
-	Properties map[PropName]Property
+// A single vCard as an ordered list of its property lines.
+// Properties can repeat (several TEL, EMAIL, ...) and keep the
+// order they were read in, so nothing is lost when written back out.
+type VCard struct {
+	Properties []Property
 }
 
-func NewVCard() *vCard {
-	return &vCard{
-		Properties: make(map[PropName]Property),
-	}
+func NewVCard() *VCard {
+	return &VCard{}
 }
 
-func (v *vCard) AddProperty(prop Property) {
-	v.Properties[prop.Name] = prop
+// Appends prop to the end of the card.
+func (v *VCard) AddProperty(prop Property) {
+	v.Properties = append(v.Properties, prop)
 }
 
-func (v *vCard) GetProperty(propName PropName) (Property, bool) {
-	prop, ok := v.Properties[propName]
-	return prop, ok
+// Returns the first property named propName.
+func (v *VCard) GetProperty(propName PropName) (Property, bool) {
+	for _, prop := range v.Properties {
+		if prop.Name == propName {
+			return prop, true
+		}
+	}
+	return Property{}, false
+}
+
+// Returns every property named propName in card order.
+func (v *VCard) GetProperties(propName PropName) []Property {
+	var props []Property
+	for _, prop := range v.Properties {
+		if prop.Name == propName {
+			props = append(props, prop)
+		}
+	}
+	return props
 }
@@ -0,0 +1,203 @@
+package writing
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/vcard"
+	"strconv"
+	"strings"
+)
+
+// FromContact builds the property lines for card, the opposite of
+// parsing.ToContact. Values are escaped the 4.0 way, the Writer
+// converts them for older versions.
+func FromContact(card *contact.ContactCard) *vcard.VCard {
+	v := vcard.NewVCard()
+	add := func(name vcard.PropName, value string, params ...vcard.Param) {
+		v.AddProperty(vcard.Property{
+			Name:   name,
+			Params: params,
+			Value:  vcard.PropValue(value),
+		})
+	}
+	text := func(name vcard.PropName, value string) {
+		if value != "" {
+			add(name, vcard.Escape(value))
+		}
+	}
+
+	text(vcard.PRODID, card.ProdID)
+	text(vcard.UID, card.UID)
+	text(vcard.FN, fullName(card))
+	if card.LastName != "" || card.FirstName != "" || card.MiddleName != "" || card.Prefix != "" || card.Suffix != "" {
+		add(vcard.N, vcard.JoinComponents(card.LastName, card.FirstName, card.MiddleName, card.Prefix, card.Suffix))
+	}
+	text(vcard.X_PHONETIC_FIRST_NAME, card.PhoneticFirst)
+	text(vcard.X_PHONETIC_MIDDLE_NAME, card.PhoneticMiddle)
+	text(vcard.X_PHONETIC_LAST_NAME, card.PhoneticLast)
+	text(vcard.NICKNAME, card.Nickname)
+	date := func(name vcard.PropName, d *contact.DateOrTime) {
+		switch {
+		case d == nil:
+		case d.IsText():
+			add(name, vcard.Escape(d.Text), &vcard.BaseParam{Name: vcard.VALUE_PARAM, Val: []string{"text"}})
+		default:
+			add(name, d.String())
+		}
+	}
+	date(vcard.BDAY, card.Birthday)
+	date(vcard.ANNIVERSARY, card.Anniversary)
+	date(vcard.DEATHDATE, card.DeathDate)
+	if card.Organization != "" {
+		// the ; between the organization and its units isn't text
+		add(vcard.ORG, vcard.JoinComponents(contact.OrgUnits(card.Organization)...))
+	}
+	text(vcard.TITLE, card.Titles)
+
+	groups := newGroups(card)
+	// adds a property with its Apple label in the same group
+	labeled := func(group, label string, name vcard.PropName, value string, params ...vcard.Param) {
+		group = groups.assign(group, label)
+		v.AddProperty(vcard.Property{Group: group, Name: name, Params: params, Value: vcard.PropValue(value)})
+		if label != "" {
+			v.AddProperty(vcard.Property{Group: group, Name: vcard.X_ABLABEL, Value: vcard.PropValue(vcard.Escape(vcard.EncodeAppleLabel(label)))})
+		}
+	}
+
+	for _, tel := range card.Telephones {
+		params := typeParams(tel.Type)
+		if tel.Region != "" {
+			params = append(params, &vcard.BaseParam{Name: vcard.CC_PARAM, Val: []string{tel.Region}})
+		}
+		labeled(tel.Group, tel.Label, vcard.TEL, tel.Number, params...)
+	}
+	for _, email := range card.Emails {
+		labeled(email.Group, email.Label, vcard.EMAIL, email.Address, typeParams(email.Type)...)
+	}
+	for _, adr := range card.Addresses {
+		labeled(adr.Group, adr.Label, vcard.ADR, vcard.JoinComponents(adr.POBox, adr.Extended, adr.Street, adr.City, adr.State, adr.Zip, adr.Country), typeParams(adr.Type)...)
+	}
+	for _, impp := range card.InstantMessaging {
+		add(vcard.IMPP, impp)
+	}
+	for _, profile := range card.SocialProfiles {
+		var params []vcard.Param
+		if profile.Type != "" {
+			params = append(params, &vcard.BaseParam{Name: vcard.SERVICE_TYPE_PARAM, Val: []string{profile.Type}})
+		}
+		add(vcard.SOCIALPROFILE, profile.URL, params...)
+	}
+	if card.URL != "" {
+		add(vcard.URL, card.URL)
+	}
+	for _, item := range card.Items {
+		labeled(vcard.ITEM_GROUP+strconv.Itoa(item.ItemNumber), item.Label, vcard.PropName(item.ItemName), item.ItemValue, typeParams(item.Type)...)
+	}
+	if len(card.Categories) > 0 {
+		add(vcard.CATEGORIES, vcard.JoinValues(card.Categories...))
+	}
+	text(vcard.NOTE, card.Notes)
+	addImage(v, vcard.PHOTO, card.Photo)
+	addImage(v, vcard.LOGO, card.Logos)
+	addImage(v, vcard.SOUND, card.Sound)
+
+	for _, xf := range card.ExtendedFields {
+		prop := vcard.Property{
+			Group: xf.Group,
+			Name:  vcard.PropName(xf.Type),
+			Value: vcard.PropValue(xf.Data),
+		}
+		for _, name := range sortedKeys(xf.Params) {
+			prop.Params = append(prop.Params, &vcard.BaseParam{
+				Name: vcard.ParamName(name),
+				Val:  xf.Params[name],
+			})
+		}
+		v.AddProperty(prop)
+	}
+	for _, key := range sortedKeys(card.CustomFields) {
+		name := strings.ToUpper(key)
+		if !strings.HasPrefix(name, vcard.X) {
+			name = vcard.X + name
+		}
+		text(vcard.PropName(name), card.CustomFields[key])
+	}
+
+	if !card.Revision.IsZero() {
+		add(vcard.REV, card.Revision.UTC().Format("20060102T150405Z"))
+	}
+	return v
+}
+
+// Hands out itemN groups for labeled properties. The numbers a card
+// came with aren't kept, after a merge two cards can both have an item1.
+// Groups of the ExtendedFields are left alone and never handed out.
+type groups struct {
+	used map[string]bool
+	next int
+}
+
+func newGroups(card *contact.ContactCard) *groups {
+	g := &groups{used: make(map[string]bool)}
+	for _, xf := range card.ExtendedFields {
+		g.used[strings.ToLower(xf.Group)] = true
+	}
+	return g
+}
+
+// Returns the group to write a property in. Other groups than itemN are
+// kept, an itemN group without a label links nothing and is dropped.
+func (g *groups) assign(group, label string) string {
+	isItem := strings.HasPrefix(strings.ToLower(group), vcard.ITEM_GROUP)
+	switch {
+	case group != "" && !isItem:
+		return group
+	case label == "":
+		return ""
+	}
+	for {
+		g.next++
+		group = vcard.ITEM_GROUP + strconv.Itoa(g.next)
+		if !g.used[group] {
+			g.used[group] = true
+			return group
+		}
+	}
+}
+
+// FN is required, fall back to the name parts
+func fullName(card *contact.ContactCard) string {
+	if card.FullName != "" {
+		return card.FullName
+	}
+	parts := []string{card.Prefix, card.FirstName, card.MiddleName, card.LastName, card.Suffix}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+func typeParams(types []string) []vcard.Param {
+	if len(types) == 0 {
+		return nil
+	}
+	return []vcard.Param{&vcard.BaseParam{
+		Name: vcard.TYPE_PARAM,
+		Val:  types,
+	}}
+}
+
+func addImage(v *vcard.VCard, name vcard.PropName, img contact.Image) {
+	switch img := img.(type) {
+	case contact.EncodedImage:
+		if img == "" {
+			return
+		}
+		value := string(img)
+		if _, _, ok := contact.SplitDataURI(value); !ok {
+			value = "data:" + contact.SniffMediaType(value) + ";base64," + value
+		}
+		v.AddProperty(vcard.Property{Name: name, Value: vcard.PropValue(value)})
+	case contact.ImageURL:
+		if img == "" {
+			return
+		}
+		v.AddProperty(vcard.Property{Name: name, Value: vcard.PropValue(img)})
+	}
+}
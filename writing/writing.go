@@ -0,0 +1,486 @@
+package writing
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/parsing"
+	"ContactCleaner/vcard"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// max octets on a line, not counting the CRLF
+// https://tools.ietf.org/html/rfc6350#section-3.2
+const maxLineLength = 75
+
+const crlf = "\r\n"
+
+var ErrUnsupportedVersion = errors.New("unsupported vCard version")
+
+type Writer struct {
+	w       io.Writer
+	version string
+}
+
+// Creates a new Writer that writes vCards to w as the given
+// VERSION, one of vcard.VERSION21, VERSION30 or VERSION40.
+func NewWriter(w io.Writer, version string) *Writer {
+	return &Writer{
+		w:       w,
+		version: version,
+	}
+}
+
+// Write encodes card and writes it out.
+func (wr *Writer) Write(card *contact.ContactCard) error {
+	return wr.WriteVCard(FromContact(card))
+}
+
+// WriteVCard writes every property of v, converting parameters and
+// values to the writer's version along the way.
+func (wr *Writer) WriteVCard(v *vcard.VCard) error {
+	switch wr.version {
+	case vcard.VERSION21, vcard.VERSION30, vcard.VERSION40:
+	default:
+		return ErrUnsupportedVersion
+	}
+
+	var sb strings.Builder
+	sb.WriteString(vcard.BEGIN + vcard.COLON + "VCARD" + crlf)
+	sb.WriteString(vcard.VERSION + vcard.COLON + wr.version + crlf)
+	for _, prop := range v.Properties {
+		switch prop.Name {
+		case vcard.BEGIN, vcard.END, vcard.VERSION:
+			continue
+		}
+		sb.WriteString(wr.encodeProperty(prop))
+	}
+	sb.WriteString(vcard.END + vcard.COLON + "VCARD" + crlf)
+
+	_, err := io.WriteString(wr.w, sb.String())
+	return err
+}
+
+// parameters RFC 6350 added, 3.0 and 2.1 don't have them
+var params40 = map[vcard.ParamName]bool{
+	vcard.MEDIATYPE_PARAM: true,
+	vcard.ALTID_PARAM:     true,
+	vcard.PID_PARAM:       true,
+	vcard.CALSCALE_PARAM:  true,
+	vcard.SORTAS_PARAM:    true,
+	vcard.GEO_PARAM:       true,
+	vcard.TZ_PARAM:        true,
+	vcard.INDEX_PARAM:     true,
+	vcard.LEVEL_PARAM:     true,
+	vcard.LABEL_PARAM:     true,
+}
+
+// a parameter on its way out
+type param struct {
+	name string
+	vals []string
+}
+
+// Encodes a single property as folded content line(s), CRLF included.
+func (wr *Writer) encodeProperty(prop vcard.Property) string {
+	params, value, qp := wr.convert(prop)
+
+	var sb strings.Builder
+	if prop.Group != "" {
+		sb.WriteString(prop.Group + vcard.DOT)
+	}
+	sb.WriteString(string(prop.Name))
+	for _, p := range params {
+		sb.WriteString(vcard.SEMICOLON)
+		sb.WriteString(wr.encodeParam(p))
+	}
+	sb.WriteString(vcard.COLON)
+
+	if qp {
+		return foldQuotedPrintable(sb.String(), value)
+	}
+	sb.WriteString(value)
+	return fold(sb.String())
+}
+
+// Converts the parameters and value of prop to what the writer's
+// version expects. Returns true if the value has to be written
+// as quoted-printable (2.1 only).
+func (wr *Writer) convert(prop vcard.Property) ([]param, string, bool) {
+	var params []param
+	var types []string
+	var encoding, mediaType string
+	pref := "" // the PREF value, 1 for TYPE=pref
+
+	for _, p := range prop.Params {
+		name := strings.ToUpper(string(p.GetName()))
+		vals := p.GetVal()
+		switch name {
+		case string(vcard.TYPE_PARAM):
+			for _, t := range vals {
+				if strings.EqualFold(t, "pref") {
+					if pref == "" {
+						pref = "1"
+					}
+					continue
+				}
+				if wr.version == vcard.VERSION40 && prop.Name == vcard.EMAIL && isAddressFormat(t) {
+					// 4.0 only has internet addresses
+					continue
+				}
+				types = append(types, t)
+			}
+		case string(vcard.PREF_PARAM):
+			if len(vals) > 0 {
+				pref = vals[0]
+			}
+		case string(vcard.ENCODING_PARAM):
+			if len(vals) > 0 {
+				encoding = strings.ToLower(vals[0])
+			}
+		case string(vcard.CHARSET_PARAM):
+			// everything is written as UTF-8
+		case string(vcard.MEDIATYPE_PARAM):
+			if len(vals) > 0 {
+				mediaType = vals[0]
+			}
+		default:
+			if wr.version != vcard.VERSION40 && params40[vcard.ParamName(name)] {
+				continue
+			}
+			params = append(params, param{name: name, vals: vals})
+		}
+	}
+
+	value := string(prop.Value)
+	qp := false
+
+	if isDateProp(prop.Name) && !isText(params) {
+		// the basic form, 19850415, is the only one 4.0 allows and
+		// ISO 8601 enough for 3.0 and 2.1
+		if d, err := parsing.ParseDateOrTime(value); err == nil {
+			value = d.String()
+		}
+	}
+
+	switch {
+	case isBinaryProp(prop.Name):
+		inline := encoding == "b" || encoding == "base64"
+		data := value
+		if inline {
+			// the old TYPE=JPEG style media type
+			types, mediaType = splitMediaType(prop.Name, types, mediaType)
+		} else if mt, d, ok := contact.SplitDataURI(value); ok {
+			inline = true
+			data = d
+			if mediaType == "" {
+				mediaType = mt
+			}
+		}
+		params, value = wr.convertBinary(params, &types, inline, mediaType, data, value)
+
+	case prop.Name == vcard.TEL && wr.version != vcard.VERSION40:
+		if strings.HasPrefix(strings.ToLower(value), "tel:") {
+			value = value[len("tel:"):]
+			params = removeParam(params, string(vcard.VALUE_PARAM))
+		}
+
+	case wr.version == vcard.VERSION21:
+		// commas aren't escaped in 2.1 and line breaks need quoted-printable
+		value = strings.ReplaceAll(value, `\,`, vcard.COMMA)
+		if strings.Contains(value, `\n`) || strings.Contains(value, `\N`) || !isASCII(value) {
+			value = strings.NewReplacer(`\n`, crlf, `\N`, crlf, `\\`, `\`).Replace(value)
+			qp = true
+			params = append(params,
+				param{name: "ENCODING", vals: []string{"QUOTED-PRINTABLE"}},
+				param{name: "CHARSET", vals: []string{"UTF-8"}},
+			)
+		}
+	}
+
+	if mediaType != "" && !isBinaryProp(prop.Name) && wr.version == vcard.VERSION40 {
+		params = append(params, param{name: string(vcard.MEDIATYPE_PARAM), vals: []string{mediaType}})
+	}
+
+	if pref != "" {
+		switch wr.version {
+		case vcard.VERSION40:
+			params = append(params, param{name: string(vcard.PREF_PARAM), vals: []string{pref}})
+		default:
+			types = append(types, "pref")
+		}
+	}
+	if len(types) > 0 {
+		// TYPE goes first, it's what most readers look at
+		params = append([]param{{name: string(vcard.TYPE_PARAM), vals: types}}, params...)
+	}
+	return params, value, qp
+}
+
+// EMAIL;TYPE=internet and x400 of 3.0 and 2.1.
+func isAddressFormat(t string) bool {
+	return strings.EqualFold(t, string(vcard.INTERNET)) || strings.EqualFold(t, string(vcard.X400))
+}
+
+// Writes inline data and URIs the way each version expects.
+// 4.0 uses data: URIs, 3.0 ENCODING=b and 2.1 ENCODING=BASE64.
+func (wr *Writer) convertBinary(params []param, types *[]string, inline bool, mediaType, data, value string) ([]param, string) {
+	if !inline {
+		switch wr.version {
+		case vcard.VERSION40:
+			if mediaType != "" {
+				params = append(params, param{name: string(vcard.MEDIATYPE_PARAM), vals: []string{mediaType}})
+			}
+		case vcard.VERSION30:
+			params = setParam(params, string(vcard.VALUE_PARAM), "uri")
+		case vcard.VERSION21:
+			params = setParam(params, string(vcard.VALUE_PARAM), "URL")
+		}
+		return params, value
+	}
+
+	params = removeParam(params, string(vcard.VALUE_PARAM))
+	if wr.version == vcard.VERSION40 {
+		if mediaType == "" {
+			mediaType = contact.SniffMediaType(data)
+		}
+		return params, "data:" + mediaType + ";base64," + data
+	}
+
+	if mediaType == "" {
+		mediaType = contact.SniffMediaType(data)
+	}
+	if _, sub, found := strings.Cut(mediaType, "/"); found {
+		*types = append(*types, strings.ToUpper(sub))
+	}
+	if wr.version == vcard.VERSION30 {
+		params = append(params, param{name: "ENCODING", vals: []string{"b"}})
+	} else {
+		params = append(params, param{name: "ENCODING", vals: []string{"BASE64"}})
+	}
+	return params, data
+}
+
+// DataURI turns 3.0 and 2.1 inline data, ENCODING=b, into a 4.0 data:
+// URI, for the formats that are always 4.0 like jCard.
+func DataURI(prop vcard.Property) vcard.Property {
+	encoded := false
+	for _, enc := range prop.GetParam(vcard.ENCODING_PARAM) {
+		if strings.EqualFold(enc, "b") || strings.EqualFold(enc, "base64") {
+			encoded = true
+		}
+	}
+	if !encoded {
+		return prop
+	}
+	mediaType := ""
+	var params []vcard.Param
+	for _, p := range prop.Params {
+		switch vcard.ParamName(strings.ToUpper(string(p.GetName()))) {
+		case vcard.ENCODING_PARAM, vcard.VALUE_PARAM:
+			continue
+		case vcard.TYPE_PARAM:
+			// the old TYPE=JPEG media type
+			var types []string
+			for _, t := range p.GetVal() {
+				switch strings.ToLower(t) {
+				case "work", "home", "pref":
+				default:
+					if mediaType == "" {
+						mediaType = vcard.MediaTypeFor(prop.Name, t)
+						continue
+					}
+				}
+				types = append(types, t)
+			}
+			if len(types) > 0 {
+				params = append(params, &vcard.BaseParam{Name: vcard.TYPE_PARAM, Val: types})
+			}
+			continue
+		}
+		params = append(params, p)
+	}
+	if mediaType == "" {
+		mediaType = contact.SniffMediaType(string(prop.Value))
+	}
+	prop.Params = params
+	prop.Value = vcard.PropValue("data:" + mediaType + ";base64," + string(prop.Value))
+	return prop
+}
+
+func (wr *Writer) encodeParam(p param) string {
+	if wr.version == vcard.VERSION21 {
+		// TEL;HOME;VOICE:...
+		if p.name == string(vcard.TYPE_PARAM) {
+			vals := make([]string, len(p.vals))
+			for i, val := range p.vals {
+				vals[i] = strings.ToUpper(val)
+			}
+			return strings.Join(vals, vcard.SEMICOLON)
+		}
+		return p.name + vcard.EQUAL + strings.Join(p.vals, vcard.COMMA)
+	}
+
+	if len(p.vals) == 0 {
+		return p.name
+	}
+	vals := make([]string, len(p.vals))
+	for i, val := range p.vals {
+		vals[i] = encodeParamValue(val)
+	}
+	return p.name + vcard.EQUAL + strings.Join(vals, vcard.COMMA)
+}
+
+// Caret encodes a parameter value and quotes it if needed.
+// https://tools.ietf.org/html/rfc6868
+func encodeParamValue(val string) string {
+	val = strings.NewReplacer("^", "^^", "\r\n", "^n", "\n", "^n", `"`, "^'").Replace(val)
+	if strings.ContainsAny(val, ":;,") {
+		return `"` + val + `"`
+	}
+	return val
+}
+
+// Folds a content line at 75 octets without splitting a UTF-8 sequence.
+// Continuation lines start with a single space.
+func fold(line string) string {
+	if len(line) <= maxLineLength {
+		return line + crlf
+	}
+	var sb strings.Builder
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		sb.WriteString(line[:cut])
+		sb.WriteString(crlf + " ")
+		line = line[cut:]
+		// the leading space counts towards the limit
+		limit = maxLineLength - 1
+	}
+	sb.WriteString(line)
+	sb.WriteString(crlf)
+	return sb.String()
+}
+
+// Encodes value as quoted-printable after prefix. Long lines are
+// broken with soft line breaks ("=" at the end of the line) instead
+// of folding.
+func foldQuotedPrintable(prefix, value string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	lineLen := len(prefix)
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		var token string
+		switch {
+		case c == '\r' && i+1 < len(value) && value[i+1] == '\n':
+			token = "=0D=0A"
+			i++
+		case c == ' ' || c == '\t':
+			// whitespace at the end of a line would get stripped
+			if i == len(value)-1 {
+				token = quotedByte(c)
+			} else {
+				token = string(c)
+			}
+		case c < 33 || c > 126 || c == '=':
+			token = quotedByte(c)
+		default:
+			token = string(c)
+		}
+		// leave room for the soft line break
+		if lineLen+len(token) > maxLineLength-1 {
+			sb.WriteString(vcard.EQUAL + crlf)
+			lineLen = 0
+		}
+		sb.WriteString(token)
+		lineLen += len(token)
+	}
+	sb.WriteString(crlf)
+	return sb.String()
+}
+
+func quotedByte(c byte) string {
+	const hex = "0123456789ABCDEF"
+	return string([]byte{'=', hex[c>>4], hex[c&0x0f]})
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+func isDateProp(name vcard.PropName) bool {
+	switch name {
+	case vcard.BDAY, vcard.ANNIVERSARY, vcard.DEATHDATE:
+		return true
+	}
+	return false
+}
+
+// Returns true for VALUE=text.
+func isText(params []param) bool {
+	for _, p := range params {
+		if p.name == string(vcard.VALUE_PARAM) && len(p.vals) > 0 && strings.EqualFold(p.vals[0], "text") {
+			return true
+		}
+	}
+	return false
+}
+
+func isBinaryProp(name vcard.PropName) bool {
+	switch name {
+	case vcard.PHOTO, vcard.LOGO, vcard.SOUND, vcard.KEY:
+		return true
+	}
+	return false
+}
+
+// Pulls the old style media type (TYPE=JPEG) out of the types.
+func splitMediaType(name vcard.PropName, types []string, mediaType string) ([]string, string) {
+	var rest []string
+	for _, t := range types {
+		switch strings.ToLower(t) {
+		case "work", "home":
+			rest = append(rest, t)
+		default:
+			if mediaType == "" {
+				mediaType = vcard.MediaTypeFor(name, t)
+			}
+		}
+	}
+	return rest, mediaType
+}
+
+func removeParam(params []param, name string) []param {
+	var rest []param
+	for _, p := range params {
+		if p.name != name {
+			rest = append(rest, p)
+		}
+	}
+	return rest
+}
+
+func setParam(params []param, name, val string) []param {
+	return append(removeParam(params, name), param{name: name, vals: []string{val}})
+}
+
+// sorted keys so the output is stable
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
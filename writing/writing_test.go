@@ -0,0 +1,254 @@
+package writing
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/parsing"
+	"ContactCleaner/vcard"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func testCard() *contact.ContactCard {
+	return &contact.ContactCard{
+		Revision:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Birthday:     &contact.DateOrTime{Year: 1985, Month: 4, Day: 15},
+		Anniversary:  &contact.DateOrTime{Month: 6, Day: 1},
+		DeathDate:    &contact.DateOrTime{Text: "circa 2080"},
+		UID:          "urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1",
+		FullName:     "Dr. Taco Cat, Esq.",
+		FirstName:    "Taco",
+		LastName:     "Cat",
+		MiddleName:   "Al Pastor",
+		Prefix:       "Dr.",
+		Suffix:       "Esq.",
+		PhoneticLast: "Kyatto",
+		Nickname:     "Tac",
+		Organization: "Tacos; Burritos, Inc.",
+		Titles:       "Head of Tacos",
+		URL:          "https://example.com/taco",
+		Notes:        "Likes tacos.\nAnd burritos, with salsa; lots of it.\\ " + strings.Repeat("really ", 20),
+		Categories:   []string{"friends", "food, mostly"},
+		Telephones: []contact.Telephone{
+			{Type: []string{"cell"}, Number: "+1 111 555 1212", Label: "Boat", Group: "item2"},
+			{Type: []string{"work", "voice"}, Number: "(111) 555-1313"},
+			{Type: []string{"home"}, Number: "020 7946 0200", Region: "GB"},
+		},
+		Emails: []contact.EmailAddr{
+			{Type: []string{"work"}, Address: "taco@example.com", Label: "Other", Group: "item3"},
+		},
+		Addresses: []contact.Address{
+			{Type: []string{"home"}, Street: "123 Main Street", City: "Any Town", State: "CA", Zip: "91921-1234", Country: "U.S.A."},
+		},
+		InstantMessaging: []string{"xmpp:taco@example.com", "skype:taco.cat"},
+		SocialProfiles: []contact.SocialMediaProfile{
+			{Type: "twitter", URL: "https://twitter.com/tacocat"},
+		},
+		CustomFields: map[string]string{"X-FAVORITE-FOOD": "tacos, always"},
+		Items: []contact.Item{
+			{ItemNumber: 4, ItemName: "X-ABRELATEDNAMES", ItemValue: "Burrito Cat", Label: "Spouse"},
+		},
+		Photo: contact.EncodedImage("data:image/png;base64,iVBORw0KGgoAAAANSUhEUg=="),
+		Logos: contact.ImageURL("https://example.com/logo.gif"),
+		Sound: contact.EncodedImage("data:audio/ogg;base64,T2dnUw=="),
+		ExtendedFields: []contact.XField{
+			{Type: "X-CUSTOM", Params: map[string][]string{"TYPE": {"work"}}, Data: "taco.cat"},
+			{Group: "item1", Type: "X-ABLABEL", Data: "Tacos"},
+			{Type: "GEO", Data: "geo:37.386013,-122.082932"},
+		},
+	}
+}
+
+func roundTrip(t *testing.T, card *contact.ContactCard, version string) (string, *contact.ContactCard) {
+	var sb strings.Builder
+	if err := NewWriter(&sb, version).Write(card); err != nil {
+		t.Fatalf("Unexpected error writing %s: %v", version, err)
+	}
+	out, err := parsing.NewParser(strings.NewReader(sb.String())).Next()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing %s: %v\n%s", version, err, sb.String())
+	}
+	return sb.String(), out
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, version := range []string{vcard.VERSION40, vcard.VERSION30} {
+		card := testCard()
+		text, out := roundTrip(t, card, version)
+		card.Version = version
+		if !reflect.DeepEqual(card, out) {
+			t.Errorf("%s round trip mismatch\nexpected %+v\ngot      %+v\n%s", version, card, out, text)
+		}
+	}
+}
+
+// ORG units are components, a round trip mustn't escape them into the name
+func TestOrganizationUnits(t *testing.T) {
+	for _, version := range []string{vcard.VERSION40, vcard.VERSION30} {
+		card := &contact.ContactCard{FullName: "Taco Cat", Organization: contact.JoinOrg("Acme, Inc", "Sales; East", "West")}
+		text, out := roundTrip(t, card, version)
+		if !strings.Contains(text, "\r\nORG:Acme\\, Inc;Sales\\; East;West\r\n") {
+			t.Errorf("%s: expected the units as components in\n%s", version, text)
+		}
+		if out.Organization != card.Organization {
+			t.Errorf("%s: expected %q, got %q", version, card.Organization, out.Organization)
+		}
+	}
+
+	// a ; in the name stays in the name
+	card, err := parsing.NewParser(strings.NewReader("BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Taco Cat\r\nORG:Acme\\; Inc;Sales\r\nEND:VCARD\r\n")).Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if units := contact.OrgUnits(card.Organization); len(units) != 2 || units[0] != "Acme; Inc" || units[1] != "Sales" {
+		t.Errorf("Unexpected units %q", units)
+	}
+	if text, _ := roundTrip(t, card, vcard.VERSION40); !strings.Contains(text, "\r\nORG:Acme\\; Inc;Sales\r\n") {
+		t.Errorf("Expected the escaped ; in\n%s", text)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	// two cards merged together can both have an item1
+	card := &contact.ContactCard{
+		FullName: "Taco Cat",
+		Telephones: []contact.Telephone{
+			{Number: "111", Label: "Boat", Group: "item1"},
+			{Number: "222", Group: "item1"},
+			{Number: "333", Group: "home"},
+		},
+		Emails: []contact.EmailAddr{
+			{Address: "taco@example.com", Label: "Other", Group: "item1"},
+		},
+		ExtendedFields: []contact.XField{
+			{Group: "item2", Type: "X-CUSTOM", Data: "x"},
+		},
+	}
+	var sb strings.Builder
+	if err := NewWriter(&sb, vcard.VERSION40).Write(card); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, line := range []string{
+		"item1.TEL:111\r\nitem1.X-ABLABEL:Boat\r\n",
+		"\r\nTEL:222\r\n",
+		"home.TEL:333\r\n",
+		"item3.EMAIL:taco@example.com\r\nitem3.X-ABLABEL:_$!<Other>!$_\r\n",
+		"item2.X-CUSTOM:x\r\n",
+	} {
+		if !strings.Contains(sb.String(), line) {
+			t.Errorf("Expected %q in\n%s", line, sb.String())
+		}
+	}
+}
+
+func TestFolding(t *testing.T) {
+	text, _ := roundTrip(t, testCard(), vcard.VERSION40)
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line longer than 75 octets: %q", line)
+		}
+	}
+	if !strings.Contains(text, "\r\n ") {
+		t.Errorf("Expected folded lines in output:\n%s", text)
+	}
+}
+
+func TestFoldingKeepsUTF8(t *testing.T) {
+	line := "NOTE:" + strings.Repeat("é", 60)
+	for _, l := range strings.Split(fold(line), "\r\n") {
+		if !utf8.ValidString(strings.TrimPrefix(l, " ")) {
+			t.Errorf("Fold split a UTF-8 sequence: %q", l)
+		}
+	}
+}
+
+func TestVersionDifferences(t *testing.T) {
+	v := vcard.NewVCard()
+	v.AddProperty(vcard.Property{Name: vcard.FN, Value: "Taco Cat"})
+	v.AddProperty(vcard.Property{
+		Name:   vcard.TEL,
+		Params: []vcard.Param{&vcard.BaseParam{Name: vcard.TYPE_PARAM, Val: []string{"home", "voice"}}, &vcard.BaseParam{Name: vcard.PREF_PARAM, Val: []string{"1"}}},
+		Value:  "tel:+1-111-555-1212",
+	})
+	v.AddProperty(vcard.Property{Name: vcard.PHOTO, Value: "data:image/jpeg;base64,/9j/4AAQ"})
+	v.AddProperty(vcard.Property{Name: vcard.NOTE, Value: `Señor\, Taco`})
+	v.AddProperty(vcard.Property{Name: vcard.BDAY, Value: "19850415"})
+	v.AddProperty(vcard.Property{
+		Name:   vcard.EMAIL,
+		Params: []vcard.Param{&vcard.BaseParam{Name: vcard.TYPE_PARAM, Val: []string{"INTERNET", "work"}}},
+		Value:  "taco@example.com",
+	})
+	v.AddProperty(vcard.Property{
+		Name:   vcard.URL,
+		Params: []vcard.Param{&vcard.BaseParam{Name: vcard.MEDIATYPE_PARAM, Val: []string{"text/html"}}, &vcard.BaseParam{Name: vcard.ALTID_PARAM, Val: []string{"1"}}},
+		Value:  "https://example.com",
+	})
+
+	tests := []struct {
+		version  string
+		expected []string
+	}{
+		{vcard.VERSION40, []string{
+			"TEL;TYPE=home,voice;PREF=1:tel:+1-111-555-1212\r\n",
+			"PHOTO:data:image/jpeg;base64,/9j/4AAQ\r\n",
+			`NOTE:Señor\, Taco` + "\r\n",
+			"BDAY:19850415\r\n",
+			"EMAIL;TYPE=work:taco@example.com\r\n",
+			"URL;ALTID=1;MEDIATYPE=text/html:https://example.com\r\n",
+		}},
+		{vcard.VERSION30, []string{
+			"TEL;TYPE=home,voice,pref:+1-111-555-1212\r\n",
+			"PHOTO;TYPE=JPEG;ENCODING=b:/9j/4AAQ\r\n",
+			`NOTE:Señor\, Taco` + "\r\n",
+			"BDAY:19850415\r\n",
+			"EMAIL;TYPE=INTERNET,work:taco@example.com\r\n",
+			"URL:https://example.com\r\n",
+		}},
+		{vcard.VERSION21, []string{
+			"TEL;HOME;VOICE;PREF:+1-111-555-1212\r\n",
+			"PHOTO;JPEG;ENCODING=BASE64:/9j/4AAQ\r\n",
+			"NOTE;ENCODING=QUOTED-PRINTABLE;CHARSET=UTF-8:Se=C3=B1or, Taco\r\n",
+			"BDAY:19850415\r\n",
+			"EMAIL;INTERNET;WORK:taco@example.com\r\n",
+			"URL:https://example.com\r\n",
+		}},
+	}
+	for _, test := range tests {
+		var sb strings.Builder
+		if err := NewWriter(&sb, test.version).WriteVCard(v); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, line := range test.expected {
+			if !strings.Contains(sb.String(), line) {
+				t.Errorf("%s: expected %q in\n%s", test.version, line, sb.String())
+			}
+		}
+	}
+}
+
+// 3.0 cards often have the extended form, 4.0 only allows the basic one
+func TestDatesTo40(t *testing.T) {
+	input := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Taco Cat\r\nBDAY:1985-04-15\r\nANNIVERSARY:--06-01\r\nDEATHDATE:2080-01-02T10:30:00Z\r\nEND:VCARD\r\n"
+	v, err := parsing.NewParser(strings.NewReader(input)).NextVCard()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var sb strings.Builder
+	if err := NewWriter(&sb, vcard.VERSION40).WriteVCard(v); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, line := range []string{"BDAY:19850415\r\n", "ANNIVERSARY:--0601\r\n", "DEATHDATE:20800102T103000Z\r\n"} {
+		if !strings.Contains(sb.String(), line) {
+			t.Errorf("Expected %q in\n%s", line, sb.String())
+		}
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	var sb strings.Builder
+	if err := NewWriter(&sb, "5.0").Write(testCard()); err != ErrUnsupportedVersion {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+}
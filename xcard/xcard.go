@@ -0,0 +1,399 @@
+// Package xcard reads and writes vCards as xCard, the XML format
+// of RFC 6351.
+//
+//	<vcards xmlns="urn:ietf:params:xml:ns:vcard-4.0">
+//	  <vcard>
+//	    <fn><text>Taco Cat</text></fn>
+//	    <n><surname>Cat</surname><given>Taco</given>...</n>
+//	    <tel>
+//	      <parameters><type><text>work</text></type></parameters>
+//	      <uri>tel:+1-111-555-1212</uri>
+//	    </tel>
+//	  </vcard>
+//	</vcards>
+//
+// https://tools.ietf.org/html/rfc6351
+package xcard
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/parsing"
+	"ContactCleaner/vcard"
+	"ContactCleaner/writing"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Namespace is the XML namespace of every xCard element.
+const Namespace = "urn:ietf:params:xml:ns:vcard-4.0"
+
+var ErrInvalidXCard = errors.New("invalid xCard")
+
+const (
+	vcardsTag     = "vcards"
+	vcardTag      = "vcard"
+	groupTag      = "group"
+	parametersTag = "parameters"
+	nameAttr      = "name"
+)
+
+// The element names of the components of the structured properties.
+// ORG has none, its components are all <text>.
+var components = map[vcard.PropName][]string{
+	vcard.N:            {"surname", "given", "additional", "prefix", "suffix"},
+	vcard.ADR:          {"pobox", "ext", "street", "locality", "region", "code", "country"},
+	vcard.GENDER:       {"sex", "identity"},
+	vcard.CLIENTPIDMAP: {"sourceid", "uri"},
+}
+
+// Any XML element, xCard properties are told apart by name so they
+// can't be struct fields.
+type element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []element  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+func leaf(name, text string) element {
+	return element{XMLName: xml.Name{Local: name}, Text: text}
+}
+
+// Marshal encodes v as an xCard document. xCard is always vCard 4.0,
+// the VERSION is set to 4.0 and inline data from older versions
+// becomes a data: URI.
+func Marshal(v *vcard.VCard) ([]byte, error) {
+	return MarshalAll([]*vcard.VCard{v})
+}
+
+// MarshalAll encodes cards as one xCard document.
+func MarshalAll(cards []*vcard.VCard) ([]byte, error) {
+	root := element{
+		XMLName: xml.Name{Local: vcardsTag},
+		Attrs:   []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: Namespace}},
+	}
+	for _, v := range cards {
+		root.Children = append(root.Children, toXML(v))
+	}
+	b, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// Unmarshal decodes the first vCard of an xCard document.
+func Unmarshal(data []byte) (*vcard.VCard, error) {
+	cards, err := UnmarshalAll(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("%w: no <vcard> element", ErrInvalidXCard)
+	}
+	return cards[0], nil
+}
+
+// UnmarshalAll decodes every vCard of an xCard document. Elements
+// outside the vCard namespace, extensions of other schemas, are skipped.
+func UnmarshalAll(data []byte) ([]*vcard.VCard, error) {
+	var root element
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidXCard, err)
+	}
+	if root.XMLName.Space != Namespace || root.XMLName.Local != vcardsTag {
+		return nil, fmt.Errorf("%w: root is not <vcards xmlns=%q>", ErrInvalidXCard, Namespace)
+	}
+
+	var cards []*vcard.VCard
+	for _, e := range root.Children {
+		if !inNamespace(e, vcardTag) {
+			continue
+		}
+		v, err := fromXML(e)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, v)
+	}
+	return cards, nil
+}
+
+// MarshalContacts encodes cards as one xCard document.
+func MarshalContacts(cards []*contact.ContactCard) ([]byte, error) {
+	vs := make([]*vcard.VCard, len(cards))
+	for i, card := range cards {
+		vs[i] = writing.FromContact(card)
+	}
+	return MarshalAll(vs)
+}
+
+// UnmarshalContacts decodes every vCard of an xCard document.
+func UnmarshalContacts(data []byte) ([]*contact.ContactCard, error) {
+	vs, err := UnmarshalAll(data)
+	if err != nil {
+		return nil, err
+	}
+	var cards []*contact.ContactCard
+	for _, v := range vs {
+		card, err := parsing.ToContact(v)
+		if err != nil {
+			return cards, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
+
+// Consecutive properties of the same group go into one <group>.
+func toXML(v *vcard.VCard) element {
+	card := element{XMLName: xml.Name{Local: vcardTag}}
+	card.Children = append(card.Children, element{
+		XMLName:  xml.Name{Local: "version"},
+		Children: []element{leaf("text", vcard.VERSION40)},
+	})
+	for _, prop := range v.Properties {
+		if prop.Name == vcard.VERSION || prop.Name == vcard.BEGIN || prop.Name == vcard.END {
+			continue
+		}
+		e := propToXML(prop)
+		if prop.Group == "" {
+			card.Children = append(card.Children, e)
+			continue
+		}
+		last := len(card.Children) - 1
+		if last >= 0 && card.Children[last].XMLName.Local == groupTag && groupName(card.Children[last]) == prop.Group {
+			card.Children[last].Children = append(card.Children[last].Children, e)
+			continue
+		}
+		card.Children = append(card.Children, element{
+			XMLName:  xml.Name{Local: groupTag},
+			Attrs:    []xml.Attr{{Name: xml.Name{Local: nameAttr}, Value: prop.Group}},
+			Children: []element{e},
+		})
+	}
+	return card
+}
+
+// <name><parameters>...</parameters><type>value</type></name>
+func propToXML(prop vcard.Property) element {
+	prop = writing.DataURI(prop)
+	valueType := prop.ValueType()
+	e := element{XMLName: xml.Name{Local: strings.ToLower(string(prop.Name))}}
+
+	params := element{XMLName: xml.Name{Local: parametersTag}}
+	for _, p := range prop.Params {
+		name := vcard.ParamName(strings.ToUpper(string(p.GetName())))
+		if name == vcard.VALUE_PARAM {
+			continue
+		}
+		param := element{XMLName: xml.Name{Local: strings.ToLower(string(name))}}
+		for _, val := range p.GetVal() {
+			param.Children = append(param.Children, leaf(paramType(name, val), val))
+		}
+		params.Children = append(params.Children, param)
+	}
+	if len(params.Children) > 0 {
+		e.Children = append(e.Children, params)
+	}
+
+	value := string(prop.Value)
+	switch {
+	case components[prop.Name] != nil && valueType == "text":
+		// every component is there, even when N or ADR leaves it off
+		comps := vcard.SplitUnescaped(value, ';')
+		for i, name := range components[prop.Name] {
+			comp := ""
+			if i < len(comps) {
+				comp = comps[i]
+			}
+			for _, v := range vcard.SplitUnescaped(comp, ',') {
+				e.Children = append(e.Children, leaf(name, vcard.Unescape(v)))
+			}
+		}
+
+	case vcard.STRUCTURED[prop.Name] && valueType == "text":
+		for _, comp := range vcard.SplitUnescaped(value, ';') {
+			e.Children = append(e.Children, leaf(valueType, vcard.Unescape(comp)))
+		}
+
+	case vcard.MULTI_VALUED[prop.Name] && valueType == "text":
+		for _, v := range prop.Values() {
+			e.Children = append(e.Children, leaf(valueType, v))
+		}
+
+	case vcard.IsDateType(valueType):
+		// the element is the type the value actually is
+		if d, err := parsing.ParseDateOrTime(value); err == nil {
+			if valueType == "date-and-or-time" {
+				valueType = d.ValueType()
+			}
+			e.Children = append(e.Children, leaf(valueType, xmlDate(d)))
+			break
+		}
+		e.Children = append(e.Children, leaf("text", vcard.Unescape(value)))
+
+	case valueType == "text" || valueType == "unknown":
+		e.Children = append(e.Children, leaf(valueType, vcard.Unescape(value)))
+
+	default:
+		e.Children = append(e.Children, leaf(valueType, value))
+	}
+	return e
+}
+
+// PREF is an integer, LANGUAGE a language tag, GEO and TZ can be a URI.
+func paramType(name vcard.ParamName, val string) string {
+	switch name {
+	case vcard.PREF_PARAM:
+		return "integer"
+	case vcard.LANGUAGE_PARAM:
+		return "language-tag"
+	case vcard.GEO_PARAM, vcard.TZ_PARAM:
+		if vcard.HasScheme(val) {
+			return "uri"
+		}
+	}
+	return "text"
+}
+
+func groupName(e element) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Local == nameAttr {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func inNamespace(e element, local string) bool {
+	return e.XMLName.Space == Namespace && e.XMLName.Local == local
+}
+
+func fromXML(card element) (*vcard.VCard, error) {
+	v := vcard.NewVCard()
+	for _, e := range card.Children {
+		if e.XMLName.Space != Namespace {
+			continue
+		}
+		if e.XMLName.Local != groupTag {
+			prop, err := propFromXML(e)
+			if err != nil {
+				return nil, err
+			}
+			v.AddProperty(prop)
+			continue
+		}
+		group := groupName(e)
+		if group == "" {
+			return nil, fmt.Errorf("%w: <group> without a name", ErrInvalidXCard)
+		}
+		for _, child := range e.Children {
+			if child.XMLName.Space != Namespace {
+				continue
+			}
+			prop, err := propFromXML(child)
+			if err != nil {
+				return nil, err
+			}
+			prop.Group = group
+			v.AddProperty(prop)
+		}
+	}
+	return v, nil
+}
+
+func propFromXML(e element) (vcard.Property, error) {
+	prop := vcard.Property{Name: vcard.PropName(strings.ToUpper(e.XMLName.Local))}
+	var values []element
+	for _, child := range e.Children {
+		if child.XMLName.Space != Namespace {
+			continue
+		}
+		if child.XMLName.Local != parametersTag {
+			values = append(values, child)
+			continue
+		}
+		for _, p := range child.Children {
+			var vals []string
+			for _, val := range p.Children {
+				vals = append(vals, val.Text)
+			}
+			prop.Params = append(prop.Params, &vcard.BaseParam{Name: vcard.ParamName(strings.ToUpper(p.XMLName.Local)), Val: vals})
+		}
+	}
+	if len(values) == 0 {
+		return prop, fmt.Errorf("%w: <%s> has no value", ErrInvalidXCard, e.XMLName.Local)
+	}
+
+	valueType := values[0].XMLName.Local
+	if names := components[prop.Name]; names != nil && isComponent(names, values) {
+		// the same component can be there more than once, a list
+		comps := make([]string, len(names))
+		for i, name := range names {
+			var vals []string
+			for _, val := range values {
+				if val.XMLName.Local == name {
+					vals = append(vals, val.Text)
+				}
+			}
+			comps[i] = vcard.JoinValues(vals...)
+		}
+		prop.Value = vcard.PropValue(strings.Join(comps, vcard.SEMICOLON))
+		return prop, nil
+	}
+
+	parts := make([]string, len(values))
+	for i, val := range values {
+		parts[i] = valueFromXML(valueType, val.Text)
+	}
+	sep := vcard.COMMA
+	if vcard.STRUCTURED[prop.Name] {
+		sep = vcard.SEMICOLON
+	}
+	prop.Value = vcard.PropValue(strings.Join(parts, sep))
+
+	if !prop.ImpliesType(valueType) {
+		prop.Params = append(prop.Params, &vcard.BaseParam{Name: vcard.VALUE_PARAM, Val: []string{valueType}})
+	}
+	return prop, nil
+}
+
+// Components can come in any order, it's a structured value if one of
+// them is there.
+func isComponent(names []string, values []element) bool {
+	for _, val := range values {
+		for _, name := range names {
+			if val.XMLName.Local == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A time on its own has no T in xCard, 103000 for T103000.
+func xmlDate(d contact.DateOrTime) string {
+	if !d.HasDate() {
+		return strings.TrimPrefix(d.String(), "T")
+	}
+	return d.String()
+}
+
+// Turns one xCard value back into the escaped vCard form.
+func valueFromXML(valueType, text string) string {
+	switch {
+	case vcard.IsDateType(valueType):
+		if valueType == "time" && !strings.HasPrefix(text, "T") {
+			text = "T" + text
+		}
+		if d, err := parsing.ParseDateOrTime(text); err == nil {
+			return d.String()
+		}
+	case valueType == "text" || valueType == "unknown":
+		return vcard.Escape(text)
+	}
+	return text
+}
@@ -0,0 +1,240 @@
+package xcard
+
+import (
+	"ContactCleaner/contact"
+	"ContactCleaner/parsing"
+	"ContactCleaner/vcard"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const input = "BEGIN:VCARD\r\n" +
+	"VERSION:3.0\r\n" +
+	"FN:Dr. Taco Cat\r\n" +
+	"N:Cat;Taco;Al,Pastor;Dr.;\r\n" +
+	"ORG:Tacos\\, Inc.;Salsa\r\n" +
+	"CATEGORIES:friends,food\\, mostly\r\n" +
+	"item1.EMAIL;TYPE=work:taco@example.com\r\n" +
+	"item1.X-ABLabel:Tacos\r\n" +
+	"TEL;TYPE=work,voice;PREF=1:tel:+1-111-555-1212\r\n" +
+	"BDAY:--0415\r\n" +
+	"ANNIVERSARY;VALUE=text:circa 2010\r\n" +
+	"PHOTO;ENCODING=b;TYPE=PNG:iVBORw0KGgo=\r\n" +
+	"NOTE:Likes <tacos> & burritos.\r\n" +
+	"X-CUSTOM;X-PARAM=a,b:custom\r\n" +
+	"END:VCARD\r\n"
+
+var space = regexp.MustCompile(`>\s+<`)
+
+func TestMarshal(t *testing.T) {
+	v, err := parsing.NewParser(strings.NewReader(input)).NextVCard()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := space.ReplaceAllString(string(b), "><")
+
+	expected := []string{
+		`<vcards xmlns="urn:ietf:params:xml:ns:vcard-4.0"><vcard>`,
+		`<version><text>4.0</text></version>`,
+		`<fn><text>Dr. Taco Cat</text></fn>`,
+		`<n><surname>Cat</surname><given>Taco</given><additional>Al</additional><additional>Pastor</additional><prefix>Dr.</prefix><suffix></suffix></n>`,
+		`<org><text>Tacos, Inc.</text><text>Salsa</text></org>`,
+		`<categories><text>friends</text><text>food, mostly</text></categories>`,
+		`<group name="item1"><email><parameters><type><text>work</text></type></parameters><text>taco@example.com</text></email><x-ablabel><unknown>Tacos</unknown></x-ablabel></group>`,
+		`<tel><parameters><type><text>work</text><text>voice</text></type><pref><integer>1</integer></pref></parameters><uri>tel:+1-111-555-1212</uri></tel>`,
+		`<bday><date>--0415</date></bday>`,
+		`<anniversary><text>circa 2010</text></anniversary>`,
+		`<photo><uri>data:image/png;base64,iVBORw0KGgo=</uri></photo>`,
+		`<note><text>Likes &lt;tacos&gt; &amp; burritos.</text></note>`,
+		`<x-custom><parameters><x-param><text>a</text><text>b</text></x-param></parameters><unknown>custom</unknown></x-custom>`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("Expected %s in\n%s", e, out)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<vcards xmlns="urn:ietf:params:xml:ns:vcard-4.0" xmlns:crm="http://example.com/crm">
+  <vcard>
+    <version><text>4.0</text></version>
+    <fn><text>Dr. Taco Cat</text></fn>
+    <n>
+      <surname>Cat</surname>
+      <given>Taco</given>
+      <additional>Al</additional>
+      <additional>Pastor</additional>
+      <prefix>Dr.</prefix>
+      <suffix/>
+    </n>
+    <categories><text>friends</text><text>food, mostly</text></categories>
+    <group name="item1">
+      <email>
+        <parameters><type><text>work</text></type></parameters>
+        <text>taco@example.com</text>
+      </email>
+      <x-ablabel><unknown>Tacos</unknown></x-ablabel>
+    </group>
+    <tel>
+      <parameters>
+        <type><text>work</text><text>voice</text></type>
+        <pref><integer>1</integer></pref>
+      </parameters>
+      <uri>tel:+1-111-555-1212</uri>
+    </tel>
+    <bday><date-time>19850415T103000Z</date-time></bday>
+    <anniversary><text>circa 2010</text></anniversary>
+    <note><text>Likes tacos.
+And burritos; with salsa.</text></note>
+    <x-count><integer>42</integer></x-count>
+    <crm:account-id>1234</crm:account-id>
+  </vcard>
+</vcards>`
+	v, err := Unmarshal([]byte(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		"VERSION:4.0",
+		"FN:Dr. Taco Cat",
+		"N:Cat;Taco;Al,Pastor;Dr.;",
+		`CATEGORIES:friends,food\, mostly`,
+		"item1.EMAIL;TYPE=work:taco@example.com",
+		"item1.X-ABLABEL:Tacos",
+		"TEL;TYPE=work,voice;PREF=1:tel:+1-111-555-1212",
+		"BDAY:19850415T103000Z",
+		"ANNIVERSARY;VALUE=text:circa 2010",
+		`NOTE:Likes tacos.\nAnd burritos\; with salsa.`,
+		"X-COUNT;VALUE=integer:42",
+	}
+	if len(v.Properties) != len(expected) {
+		t.Fatalf("Expected %d properties, got %d", len(expected), len(v.Properties))
+	}
+	for i, prop := range v.Properties {
+		if got := line(prop); got != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], got)
+		}
+	}
+}
+
+// a simple line for comparing, without escaping the params
+func line(prop vcard.Property) string {
+	var sb strings.Builder
+	if prop.Group != "" {
+		sb.WriteString(prop.Group + vcard.DOT)
+	}
+	sb.WriteString(string(prop.Name))
+	for _, p := range prop.Params {
+		sb.WriteString(vcard.SEMICOLON + string(p.GetName()) + vcard.EQUAL + strings.Join(p.GetVal(), vcard.COMMA))
+	}
+	return sb.String() + vcard.COLON + string(prop.Value)
+}
+
+// Readers find the components by position, each one has to be there.
+func TestComponents(t *testing.T) {
+	v := vcard.NewVCard()
+	v.AddProperty(vcard.Property{Name: vcard.N, Value: "Cat;Taco"})
+	v.AddProperty(vcard.Property{Name: vcard.ADR, Value: ";;123 Main Street"})
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := space.ReplaceAllString(string(b), "><")
+	for _, e := range []string{
+		`<n><surname>Cat</surname><given>Taco</given><additional></additional><prefix></prefix><suffix></suffix></n>`,
+		`<adr><pobox></pobox><ext></ext><street>123 Main Street</street><locality></locality><region></region><code></code><country></country></adr>`,
+	} {
+		if !strings.Contains(out, e) {
+			t.Errorf("Expected %s in\n%s", e, out)
+		}
+	}
+
+	// and they can come in any order
+	data := `<vcards xmlns="urn:ietf:params:xml:ns:vcard-4.0"><vcard>
+		<n><given>Taco</given><surname>Cat</surname><prefix/><additional/><suffix/></n>
+		<adr><parameters><type><text>home</text></type></parameters><street>123 Main Street</street><locality>Any Town</locality><pobox/></adr>
+	</vcard></vcards>`
+	v, err = Unmarshal([]byte(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, e := range []string{"N:Cat;Taco;;;", "ADR;TYPE=home:;;123 Main Street;Any Town;;;"} {
+		if got := line(v.Properties[i]); got != e {
+			t.Errorf("Expected %q, got %q", e, got)
+		}
+	}
+}
+
+// A time on its own is written without the T and gets it back on read.
+func TestTimeRoundTrip(t *testing.T) {
+	v := vcard.NewVCard()
+	v.AddProperty(vcard.Property{Name: vcard.BDAY, Params: []vcard.Param{&vcard.BaseParam{Name: vcard.VALUE_PARAM, Val: []string{"time"}}}, Value: "T103000"})
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if out := space.ReplaceAllString(string(b), "><"); !strings.Contains(out, "<time>103000</time>") {
+		t.Errorf("Expected <time>103000</time> in\n%s", out)
+	}
+	v, err = Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if prop, ok := v.GetProperty(vcard.BDAY); !ok || prop.Value != "T103000" {
+		t.Errorf("Expected BDAY T103000, got %+v", prop)
+	}
+}
+
+func TestContactsRoundTrip(t *testing.T) {
+	cards := []*contact.ContactCard{
+		{
+			Version:    vcard.VERSION40,
+			FullName:   "Taco Cat",
+			FirstName:  "Taco",
+			LastName:   "Cat",
+			Birthday:   &contact.DateOrTime{Month: 4, Day: 15},
+			Revision:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Categories: []string{"friends", "food, mostly"},
+			Telephones: []contact.Telephone{{Type: []string{"cell"}, Number: "+1 111 555 1212", Label: "Boat", Group: "item1"}},
+			Emails:     []contact.EmailAddr{{Type: []string{"work"}, Address: "taco@example.com"}},
+			Addresses:  []contact.Address{{Type: []string{"home"}, Street: "123 Main Street", City: "Any Town", Country: "U.S.A."}},
+			Notes:      "Likes <tacos>.\nAnd burritos; with salsa.",
+		},
+		{Version: vcard.VERSION40, FullName: "Burrito Cat"},
+	}
+	b, err := MarshalContacts(cards)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err := UnmarshalContacts(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cards, out) {
+		t.Errorf("Round trip mismatch\nexpected %+v\ngot      %+v\n%s", cards, out, b)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, data := range []string{
+		`not xml`,
+		`<vcards><vcard/></vcards>`,
+		`<vcards xmlns="urn:ietf:params:xml:ns:vcard-4.0"></vcards>`,
+		`<vcards xmlns="urn:ietf:params:xml:ns:vcard-4.0"><vcard><fn/></vcard></vcards>`,
+		`<vcards xmlns="urn:ietf:params:xml:ns:vcard-4.0"><vcard><group><fn><text>Taco</text></fn></group></vcard></vcards>`,
+	} {
+		if _, err := Unmarshal([]byte(data)); !errors.Is(err, ErrInvalidXCard) {
+			t.Errorf("%s: expected ErrInvalidXCard, got %v", data, err)
+		}
+	}
+}